@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,6 +17,66 @@ type Config struct {
 	Port               string
 	AdminUsername      string
 	AdminPassword      string
+
+	// Sessions
+	SessionTTL         time.Duration
+	SessionIdleTimeout time.Duration
+	SessionStorePath   string
+
+	// Users; ADMIN_USERNAME and ADMIN_PASSWORD seed the first admin
+	UserStorePath string
+
+	// Personal API tokens
+	APITokenStorePath string
+
+	// OpenID Connect single sign-on, enabled when issuer, client ID and redirect URL are set
+	OIDCIssuerURL      string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCRedirectURL    string
+	OIDCScopes         []string
+	OIDCProviderName   string
+	OIDCUsernameClaim  string
+	OIDCGroupsClaim    string
+	OIDCAdminGroups    []string
+	OIDCOperatorGroups []string
+	OIDCViewerGroups   []string
+	OIDCDefaultRole    string
+
+	// Cloudflare Access, enabled when team domain and audience are set
+	// Replaces local logins: users are identified by the Access JWT header
+	CFAccessTeamDomain     string
+	CFAccessAudience       string
+	CFAccessCertsURL       string
+	CFAccessAdminEmails    []string
+	CFAccessOperatorEmails []string
+	CFAccessViewerEmails   []string
+	CFAccessDefaultRole    string
+
+	// Cookie attributes: COOKIE_SECURE is auto, true or false, COOKIE_SAMESITE is lax or strict
+	// auto marks cookies Secure when the request arrived over HTTPS, directly or per X-Forwarded-Proto
+	CookieSecure   string
+	CookieSameSite string
+
+	// Login brute-force protection: failures allowed per username and per source IP before lockouts start
+	LoginMaxAttempts      int
+	LoginMaxAttemptsPerIP int
+	LoginMaxLockout       time.Duration
+
+	// Proxies whose X-Forwarded-For and CF-Connecting-IP headers are trusted for the client IP
+	TrustedProxies []string
+
+	// Audit trail
+	AuditLogPath string
+
+	// Origins allowed to call the API from a browser; empty means same-origin only
+	CORSAllowedOrigins []string
+
+	// Docker label-driven auto-exposure
+	DockerAutoExpose    bool
+	AutoExposeStorePath string
+	DefaultAccountID    string
+	DefaultTunnelID     string
 }
 
 func LoadConfig() *Config {
@@ -23,12 +86,57 @@ func LoadConfig() *Config {
 	}
 
 	config := &Config{
-		CloudflareAPIToken: os.Getenv("CLOUDFLARE_API_TOKEN"),
-		CloudflareAPIKey:   os.Getenv("CLOUDFLARE_API_KEY"),
-		CloudflareEmail:    os.Getenv("CLOUDFLARE_EMAIL"),
-		Port:               getEnvOrDefault("PORT", "8080"),
-		AdminUsername:      getEnvOrDefault("ADMIN_USERNAME", "admin"),
-		AdminPassword:      getEnvOrDefault("ADMIN_PASSWORD", "password123"),
+		CloudflareAPIToken:     os.Getenv("CLOUDFLARE_API_TOKEN"),
+		CloudflareAPIKey:       os.Getenv("CLOUDFLARE_API_KEY"),
+		CloudflareEmail:        os.Getenv("CLOUDFLARE_EMAIL"),
+		Port:                   getEnvOrDefault("PORT", "8080"),
+		AdminUsername:          getEnvOrDefault("ADMIN_USERNAME", "admin"),
+		AdminPassword:          getEnvOrDefault("ADMIN_PASSWORD", "password123"),
+		SessionTTL:             getDurationOrDefault("SESSION_TTL", 7*24*time.Hour),
+		SessionIdleTimeout:     getDurationOrDefault("SESSION_IDLE_TIMEOUT", 24*time.Hour),
+		SessionStorePath:       os.Getenv("SESSION_STORE_PATH"),
+		UserStorePath:          os.Getenv("USER_STORE_PATH"),
+		APITokenStorePath:      os.Getenv("API_TOKEN_STORE_PATH"),
+		OIDCIssuerURL:          os.Getenv("OIDC_ISSUER_URL"),
+		OIDCClientID:           os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:       os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:        os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes:             getListOrDefault("OIDC_SCOPES", []string{"openid", "profile", "email", "groups"}),
+		OIDCProviderName:       getEnvOrDefault("OIDC_PROVIDER_NAME", "SSO"),
+		OIDCUsernameClaim:      getEnvOrDefault("OIDC_USERNAME_CLAIM", "preferred_username"),
+		OIDCGroupsClaim:        getEnvOrDefault("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCAdminGroups:        getListOrDefault("OIDC_ADMIN_GROUPS", nil),
+		OIDCOperatorGroups:     getListOrDefault("OIDC_OPERATOR_GROUPS", nil),
+		OIDCViewerGroups:       getListOrDefault("OIDC_VIEWER_GROUPS", nil),
+		OIDCDefaultRole:        os.Getenv("OIDC_DEFAULT_ROLE"),
+		CFAccessTeamDomain:     os.Getenv("CF_ACCESS_TEAM_DOMAIN"),
+		CFAccessAudience:       os.Getenv("CF_ACCESS_AUD"),
+		CFAccessCertsURL:       os.Getenv("CF_ACCESS_CERTS_URL"),
+		CFAccessAdminEmails:    getListOrDefault("CF_ACCESS_ADMIN_EMAILS", nil),
+		CFAccessOperatorEmails: getListOrDefault("CF_ACCESS_OPERATOR_EMAILS", nil),
+		CFAccessViewerEmails:   getListOrDefault("CF_ACCESS_VIEWER_EMAILS", nil),
+		CFAccessDefaultRole:    os.Getenv("CF_ACCESS_DEFAULT_ROLE"),
+		CookieSecure:           strings.ToLower(getEnvOrDefault("COOKIE_SECURE", "auto")),
+		CookieSameSite:         strings.ToLower(getEnvOrDefault("COOKIE_SAMESITE", "lax")),
+		LoginMaxAttempts:       getIntOrDefault("LOGIN_MAX_ATTEMPTS", 5),
+		LoginMaxAttemptsPerIP:  getIntOrDefault("LOGIN_MAX_ATTEMPTS_PER_IP", 20),
+		LoginMaxLockout:        getDurationOrDefault("LOGIN_MAX_LOCKOUT", 15*time.Minute),
+		TrustedProxies:         getListOrDefault("TRUSTED_PROXIES", nil),
+		AuditLogPath:           os.Getenv("AUDIT_LOG_PATH"),
+		CORSAllowedOrigins:     getListOrDefault("CORS_ALLOWED_ORIGINS", nil),
+		DockerAutoExpose:       os.Getenv("DOCKER_AUTO_EXPOSE") == "true",
+		AutoExposeStorePath:    os.Getenv("DOCKER_AUTO_EXPOSE_STORE_PATH"),
+		DefaultAccountID:       os.Getenv("CLOUDFLARE_ACCOUNT_ID"),
+		DefaultTunnelID:        os.Getenv("CLOUDFLARE_TUNNEL_ID"),
+	}
+
+	if config.CookieSecure != "auto" && config.CookieSecure != "true" && config.CookieSecure != "false" {
+		log.Printf("Invalid COOKIE_SECURE %q, using auto", config.CookieSecure)
+		config.CookieSecure = "auto"
+	}
+	if config.CookieSameSite != "lax" && config.CookieSameSite != "strict" {
+		log.Printf("Invalid COOKIE_SAMESITE %q, using lax", config.CookieSameSite)
+		config.CookieSameSite = "lax"
 	}
 
 	// Validate required configuration
@@ -39,9 +147,62 @@ func LoadConfig() *Config {
 	return config
 }
 
+// CFAccessEnabled reports whether users are authenticated by Cloudflare Access instead of local logins
+func (c *Config) CFAccessEnabled() bool {
+	return c.CFAccessTeamDomain != "" && c.CFAccessAudience != ""
+}
+
+// OIDCEnabled reports whether single sign-on through an OpenID Connect provider is configured
+func (c *Config) OIDCEnabled() bool {
+	return c.OIDCIssuerURL != "" && c.OIDCClientID != "" && c.OIDCRedirectURL != ""
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// getDurationOrDefault parses a duration such as 24h or 30m, falling back to the default when unset or invalid
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration %q for %s, using %s", value, key, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getIntOrDefault parses an integer, falling back to the default when unset or invalid
+func getIntOrDefault(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		log.Printf("Invalid number %q for %s, using %d", value, key, defaultValue)
+		return defaultValue
+	}
+	return number
+}
+
+// getListOrDefault splits a comma-separated value, falling back to the default when unset
+func getListOrDefault(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+	"cfProxyHub/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APITokenHandler handles personal API token HTTP requests
+type APITokenHandler struct {
+	tokens *services.APITokenStore
+}
+
+// NewAPITokenHandler creates a new API token handler instance
+func NewAPITokenHandler(tokens *services.APITokenStore) *APITokenHandler {
+	return &APITokenHandler{
+		tokens: tokens,
+	}
+}
+
+// ListTokens handles GET /api/tokens
+// Admins can pass all=true to list the tokens of every user
+func (h *APITokenHandler) ListTokens(c *gin.Context) {
+	username := middleware.CurrentUsername(c)
+	if c.Query("all") == "true" {
+		if !middleware.CurrentRole(c).Includes(models.RoleAdmin) {
+			utils.ErrorResponse(c, "Listing the tokens of all users requires the admin role", http.StatusForbidden)
+			return
+		}
+		username = ""
+	}
+
+	tokens := h.tokens.List(username)
+	response := models.APITokensResponse{
+		Success: true,
+		Message: "API tokens retrieved successfully",
+		Data:    tokens,
+		Total:   len(tokens),
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// CreateToken handles POST /api/tokens
+// The token is only returned in this response
+func (h *APITokenHandler) CreateToken(c *gin.Context) {
+	var req models.APITokenCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		utils.ErrorResponse(c, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username := middleware.CurrentUsername(c)
+	secret, token, err := h.tokens.Create(username, req)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to create API token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s created API token %s (%s)", username, token.ID, token.Name)
+	response := models.APITokenCreateResponse{
+		Success: true,
+		Message: "API token created successfully, copy it now as it won't be shown again",
+		Token:   secret,
+		Data:    *token,
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// RevokeToken handles DELETE /api/tokens/{id}
+// Users can revoke their own tokens, admins any token
+func (h *APITokenHandler) RevokeToken(c *gin.Context) {
+	id := c.Param("id")
+	username := middleware.CurrentUsername(c)
+
+	owner := username
+	if middleware.CurrentRole(c).Includes(models.RoleAdmin) {
+		owner = ""
+	}
+
+	if err := h.tokens.Revoke(id, owner); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrAPITokenNotFound) {
+			status = http.StatusNotFound
+		}
+		utils.ErrorResponse(c, "Failed to revoke API token: "+err.Error(), status)
+		return
+	}
+
+	log.Printf("User %s revoked API token %s", username, id)
+	utils.SuccessResponse(c, gin.H{
+		"success": true,
+		"message": "API token revoked successfully",
+		"id":      id,
+	})
+}
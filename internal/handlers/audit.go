@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+	"cfProxyHub/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAuditLimit is how many events a query returns when it sets no limit
+const defaultAuditLimit = 500
+
+// auditCSVHeader are the columns of the CSV export
+var auditCSVHeader = []string{"id", "time", "username", "source_ip", "action", "method", "path", "status", "outcome", "targets", "message", "before", "after"}
+
+// AuditHandler handles audit log HTTP requests
+type AuditHandler struct {
+	audit *services.AuditLog
+}
+
+// NewAuditHandler creates a new audit handler instance
+func NewAuditHandler(audit *services.AuditLog) *AuditHandler {
+	return &AuditHandler{
+		audit: audit,
+	}
+}
+
+// ListEvents handles GET /api/audit
+// Filters: username, action, outcome, target, since and until (RFC 3339), limit
+// format=csv downloads the matching events as CSV instead of JSON
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		utils.ErrorResponse(c, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events := h.audit.Query(filter)
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		response := models.AuditEventsResponse{
+			Success: true,
+			Message: "Audit events retrieved successfully",
+			Data:    events,
+			Total:   len(events),
+		}
+		utils.SuccessResponse(c, response)
+	case "csv":
+		writeAuditCSV(c, events)
+	default:
+		utils.ErrorResponse(c, "format must be json or csv", http.StatusBadRequest)
+	}
+}
+
+// parseAuditFilter reads the query filters
+func parseAuditFilter(c *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		Username: strings.TrimSpace(c.Query("username")),
+		Action:   strings.TrimSpace(c.Query("action")),
+		Outcome:  strings.TrimSpace(c.Query("outcome")),
+		Target:   strings.TrimSpace(c.Query("target")),
+		Limit:    defaultAuditLimit,
+	}
+
+	switch filter.Outcome {
+	case "", models.AuditOutcomeSuccess, models.AuditOutcomeFailure, models.AuditOutcomeDenied:
+	default:
+		return filter, fmt.Errorf("outcome must be success, failure or denied")
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		raw := c.Query(bound.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 time such as 2024-01-02T15:04:05Z", bound.name)
+		}
+		*bound.value = parsed
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return filter, fmt.Errorf("limit must be a positive number, or 0 for all events")
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// writeAuditCSV sends the events as a CSV download
+func writeAuditCSV(c *gin.Context, events []models.AuditEvent) {
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405") + ".csv"
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(auditCSVHeader)
+	for _, event := range events {
+		status := ""
+		if event.Status != 0 {
+			status = strconv.Itoa(event.Status)
+		}
+		row := []string{
+			event.ID,
+			event.Time.Format(time.RFC3339),
+			event.Username,
+			event.SourceIP,
+			event.Action,
+			event.Method,
+			event.Path,
+			status,
+			event.Outcome,
+			formatAuditTargets(event.Targets),
+			event.Message,
+			auditJSON(event.Before),
+			auditJSON(event.After),
+		}
+		for i, cell := range row {
+			row[i] = csvSafeCell(cell)
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+}
+
+// csvSafeCell keeps spreadsheets from evaluating a cell as a formula
+// Usernames, messages and paths come from clients, so cells starting with a formula character get a leading quote
+func csvSafeCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// formatAuditTargets renders target IDs as key=value pairs in a stable order
+func formatAuditTargets(targets map[string]string) string {
+	pairs := make([]string, 0, len(targets))
+	for key, value := range targets {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// auditJSON renders a before or after state for a CSV cell
+func auditJSON(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
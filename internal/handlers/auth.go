@@ -2,7 +2,13 @@ package handlers
 
 import (
 	"cfProxyHub/internal/config"
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,96 +16,182 @@ import (
 
 // LoginHandler handles user login
 type LoginHandler struct {
-	config *config.Config
+	config   *config.Config
+	sessions *services.SessionStore
+	users    *services.UserStore
+	oidc     *services.OIDCProvider
+	limiter  *services.LoginLimiter
+	audit    *services.AuditLog
+
+	challenges *services.LoginChallengeStore
 }
 
-// NewLoginHandler creates a new login handler
-func NewLoginHandler(cfg *config.Config) *LoginHandler {
+// NewLoginHandler creates a new login handler using the stores of the authenticator
+func NewLoginHandler(cfg *config.Config, auth *middleware.Authenticator) *LoginHandler {
 	return &LoginHandler{
-		config: cfg,
+		config:   cfg,
+		sessions: auth.Sessions,
+		users:    auth.Users,
+		oidc:     auth.OIDC,
+		limiter:  auth.Limiter,
+		audit:    auth.Audit,
+
+		challenges: auth.Challenges,
 	}
 }
 
 // LoginForm displays the login form
+// Behind Cloudflare Access users are already signed in, so it redirects to the dashboard
 func (h *LoginHandler) LoginForm(c *gin.Context) {
-	c.HTML(http.StatusOK, "login.html", gin.H{
+	if h.config.CFAccessEnabled() {
+		c.Redirect(http.StatusFound, "/")
+		return
+	}
+	h.renderLogin(c, http.StatusOK, "")
+}
+
+// renderLogin renders the login page with an optional error
+func (h *LoginHandler) renderLogin(c *gin.Context, status int, message string) {
+	data := gin.H{
 		"title": "Login",
-	})
+	}
+	if message != "" {
+		data["error"] = message
+	}
+	if h.oidc != nil {
+		data["oidc_name"] = h.oidc.Name()
+	}
+	c.HTML(status, "login.html", data)
 }
 
 // Login processes the login form submission
 func (h *LoginHandler) Login(c *gin.Context) {
+	if h.config.CFAccessEnabled() {
+		c.Redirect(http.StatusFound, "/")
+		return
+	}
+
 	username := c.PostForm("username")
 	password := c.PostForm("password")
 
-	// TODO: Implement actual authentication logic here
-	// This is a placeholder - replace with your actual authentication
-	if h.authenticateUser(username, password) {
-		// Create session token (you should implement proper session management)
-		sessionToken := h.generateSessionToken(username)
-
-		// Set session cookie
-		c.SetCookie(
-			"session_token", // name
-			sessionToken,    // value
-			3600*24*7,       // maxAge (7 days)
-			"/",             // path
-			"",              // domain
-			false,           // secure (set to true in production with HTTPS)
-			true,            // httpOnly
-		)
-
-		// Redirect to dashboard/home page
-		c.Redirect(http.StatusFound, "/")
+	user, err := h.authenticateUser(c, username, password)
+	var locked *services.LoginLockedError
+	if errors.As(err, &locked) {
+		setRetryAfter(c, locked.RetryAfter)
+		h.renderLogin(c, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+		return
+	}
+	if err != nil {
+		// Authentication failed
+		h.renderLogin(c, http.StatusUnauthorized, "Invalid username or password")
 		return
 	}
 
-	// Authentication failed
-	c.HTML(http.StatusUnauthorized, "login.html", gin.H{
-		"title": "Login",
-		"error": "Invalid username or password",
-	})
+	// Users with two-factor authentication continue on the login page with their code
+	if needed, enroll := h.needsSecondFactor(user); needed {
+		if err := h.startChallenge(c, user, enroll); err != nil {
+			h.renderLogin(c, http.StatusInternalServerError, "Failed to start two-factor login")
+			return
+		}
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"title":          "Login",
+			"two_factor":     true,
+			"two_factor_new": enroll,
+		})
+		return
+	}
+
+	if err := h.startSession(c, user); err != nil {
+		h.renderLogin(c, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	// Redirect to dashboard/home page
+	c.Redirect(http.StatusFound, "/")
 }
 
 // Logout handles user logout
 func (h *LoginHandler) Logout(c *gin.Context) {
-	// Clear the session cookie
-	c.SetCookie(
-		"session_token",
-		"",
-		-1, // maxAge negative to delete
-		"/",
-		"",
-		false,
-		true,
-	)
+	if h.config.CFAccessEnabled() {
+		// Ends the Cloudflare Access session of the application
+		c.Redirect(http.StatusFound, "/cdn-cgi/access/logout")
+		return
+	}
+	h.endSession(c)
 
 	// Redirect to login page
 	c.Redirect(http.StatusFound, "/login")
 }
 
-// authenticateUser validates user credentials
-func (h *LoginHandler) authenticateUser(username, password string) bool {
-	// Check against credentials from .env file
-	return username == h.config.AdminUsername && password == h.config.AdminPassword
+// authenticateUser validates user credentials against the user store
+// Attempts are throttled per client IP and username, and failures are recorded in the audit log
+func (h *LoginHandler) authenticateUser(c *gin.Context, username, password string) (*models.User, error) {
+	ip := c.ClientIP()
+	if err := h.limiter.Check(ip, username); err != nil {
+		h.recordLogin(c, username, models.AuditOutcomeDenied, err.Error())
+		return nil, err
+	}
+
+	user, err := h.users.Authenticate(username, password)
+	if err != nil {
+		message := err.Error()
+		if lockout := h.limiter.Failure(ip, username); lockout > 0 {
+			message += ", locked out for " + lockout.String()
+		}
+		h.recordLogin(c, username, models.AuditOutcomeFailure, message)
+		return nil, err
+	}
+
+	// With a second factor pending the lockout is only reset once the code is verified, otherwise
+	// logging in again with the password would reset it between code guesses
+	if needed, _ := h.needsSecondFactor(user); !needed {
+		h.limiter.Success(username)
+	}
+	h.recordLogin(c, username, models.AuditOutcomeSuccess, "")
+	return user, nil
+}
+
+// recordLogin adds a password login attempt to the audit log
+func (h *LoginHandler) recordLogin(c *gin.Context, username, outcome, message string) {
+	h.audit.Record(models.AuditEvent{
+		Username: username,
+		SourceIP: c.ClientIP(),
+		Action:   models.AuditActionLogin,
+		Outcome:  outcome,
+		Message:  message,
+	})
+}
+
+// setRetryAfter tells the client how many seconds to wait before retrying
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	seconds := int(wait.Seconds())
+	if wait > time.Duration(seconds)*time.Second {
+		seconds++
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
 }
 
-// generateSessionToken creates a session token for the user
-func (h *LoginHandler) generateSessionToken(username string) string {
-	// Verify the username matches admin username from config
-	if username != h.config.AdminUsername {
-		// This should never happen as we validate in authenticateUser
-		// but adding as an extra security measure
-		return ""
+// startSession creates a server-side session for the user and sets its cookie
+func (h *LoginHandler) startSession(c *gin.Context, user *models.User) error {
+	token, _, err := h.sessions.Create(user.Username, user.Role, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Printf("Failed to create session for %s: %v", user.Username, err)
+		return err
 	}
 
-	// In a real application, you would:
-	// 1. Generate a cryptographically secure random token
-	// 2. Store it in database/redis with expiration
-	// 3. Associate it with the user
+	middleware.SetCookie(c, h.config, "session_token", token, int(h.sessions.TTL().Seconds()), true)
+	return nil
+}
+
+// endSession revokes the session of the request and clears its cookie
+func (h *LoginHandler) endSession(c *gin.Context) {
+	if token, err := c.Cookie("session_token"); err == nil {
+		if err := h.sessions.Revoke(token); err != nil {
+			log.Printf("Failed to revoke session: %v", err)
+		}
+	}
 
-	// For demo purposes, create a simple token with timestamp
-	return username + "_" + time.Now().Format("20060102150405")
+	middleware.SetCookie(c, h.config, "session_token", "", -1, true) // maxAge negative to delete
 }
 
 // LoginAPI handles API login requests and returns JSON responses
@@ -109,6 +201,14 @@ func (h *LoginHandler) LoginAPI(c *gin.Context) {
 		Password string `json:"password" binding:"required"`
 	}
 
+	if h.config.CFAccessEnabled() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Local login disabled",
+			"message": "Sign in through Cloudflare Access",
+		})
+		return
+	}
+
 	// Bind JSON request
 	if err := c.ShouldBindJSON(&loginRequest); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -119,51 +219,69 @@ func (h *LoginHandler) LoginAPI(c *gin.Context) {
 	}
 
 	// Authenticate user
-	if h.authenticateUser(loginRequest.Username, loginRequest.Password) {
-		// Create session token
-		sessionToken := h.generateSessionToken(loginRequest.Username)
-
-		// Set session cookie
-		c.SetCookie(
-			"session_token", // name
-			sessionToken,    // value
-			3600*24*7,       // maxAge (7 days)
-			"/",             // path
-			"",              // domain
-			false,           // secure (set to true in production with HTTPS)
-			true,            // httpOnly
-		)
-
-		// Return success response
+	user, err := h.authenticateUser(c, loginRequest.Username, loginRequest.Password)
+	var locked *services.LoginLockedError
+	if errors.As(err, &locked) {
+		setRetryAfter(c, locked.RetryAfter)
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "Too many failed login attempts",
+			"message": locked.Error(),
+		})
+		return
+	}
+	if err != nil {
+		// Authentication failed
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Authentication failed",
+			"message": "Invalid username or password",
+		})
+		return
+	}
+
+	// Users with two-factor authentication get a session only after POST /api/auth/login/2fa
+	if needed, enroll := h.needsSecondFactor(user); needed {
+		if err := h.startChallenge(c, user, enroll); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Session error",
+				"message": "Failed to start two-factor login",
+			})
+			return
+		}
+		message := "Enter the code from your authenticator app"
+		if enroll {
+			message = "Two-factor authentication is required for your account, set it up to continue"
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"message": "Login successful",
-			"user": gin.H{
-				"username": loginRequest.Username,
-			},
+			"success":             false,
+			"two_factor_required": true,
+			"enroll":              enroll,
+			"message":             message,
 		})
 		return
 	}
 
-	// Authentication failed
-	c.JSON(http.StatusUnauthorized, gin.H{
-		"error":   "Authentication failed",
-		"message": "Invalid username or password",
+	if err := h.startSession(c, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Session error",
+			"message": "Failed to create session",
+		})
+		return
+	}
+
+	// Return success response
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Login successful",
+		"user": gin.H{
+			"username": user.Username,
+			"role":     user.Role,
+		},
 	})
 }
 
 // LogoutAPI handles API logout requests and returns JSON responses
 func (h *LoginHandler) LogoutAPI(c *gin.Context) {
-	// Clear the session cookie
-	c.SetCookie(
-		"session_token",
-		"",
-		-1, // maxAge negative to delete
-		"/",
-		"",
-		false,
-		true,
-	)
+	h.endSession(c)
 
 	// Return success response
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+	"cfProxyHub/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CloudflareDNSHandler handles DNS record HTTP requests
+type CloudflareDNSHandler struct {
+	cfService *services.CloudflareService
+}
+
+// NewCloudflareDNSHandler creates a new DNS record handler instance
+func NewCloudflareDNSHandler(cfService *services.CloudflareService) *CloudflareDNSHandler {
+	return &CloudflareDNSHandler{
+		cfService: cfService,
+	}
+}
+
+// ListDNSRecords handles GET /api/cloudflare/zones/{zoneId}/dns_records
+// Query parameters: type, name, content, search, proxied, page, per_page, order, direction
+func (h *CloudflareDNSHandler) ListDNSRecords(c *gin.Context) {
+	zoneID := c.Param("zoneId")
+	if zoneID == "" {
+		utils.ErrorResponse(c, "Zone ID is required", http.StatusBadRequest)
+		return
+	}
+
+	filter := models.DNSRecordFilter{
+		Type:      strings.ToUpper(c.Query("type")),
+		Name:      c.Query("name"),
+		Content:   c.Query("content"),
+		Search:    c.Query("search"),
+		Order:     c.Query("order"),
+		Direction: c.Query("direction"),
+		Page:      1,
+		PerPage:   100,
+	}
+
+	if page := c.Query("page"); page != "" {
+		parsed, err := strconv.Atoi(page)
+		if err != nil || parsed < 1 {
+			utils.ErrorResponse(c, "page must be a positive number", http.StatusBadRequest)
+			return
+		}
+		filter.Page = parsed
+	}
+	if perPage := c.Query("per_page"); perPage != "" {
+		parsed, err := strconv.Atoi(perPage)
+		if err != nil || parsed < 5 || parsed > 5000 {
+			utils.ErrorResponse(c, "per_page must be between 5 and 5000", http.StatusBadRequest)
+			return
+		}
+		filter.PerPage = parsed
+	}
+	if proxied := c.Query("proxied"); proxied != "" {
+		parsed, err := strconv.ParseBool(proxied)
+		if err != nil {
+			utils.ErrorResponse(c, "proxied must be true or false", http.StatusBadRequest)
+			return
+		}
+		filter.Proxied = &parsed
+	}
+	switch filter.Order {
+	case "", "type", "name", "content", "ttl", "proxied":
+	default:
+		utils.ErrorResponse(c, "order must be one of type, name, content, ttl, proxied", http.StatusBadRequest)
+		return
+	}
+	switch filter.Direction {
+	case "", "asc", "desc":
+	default:
+		utils.ErrorResponse(c, "direction must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	records, info, err := h.cfService.ListDNSRecords(ctx, zoneID, filter)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to fetch DNS records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.DNSRecordsResponse{
+		Success:    true,
+		Message:    "DNS records retrieved successfully",
+		Data:       records,
+		Total:      info.TotalCount,
+		ResultInfo: &info,
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// GetDNSRecord handles GET /api/cloudflare/zones/{zoneId}/dns_records/{recordId}
+func (h *CloudflareDNSHandler) GetDNSRecord(c *gin.Context) {
+	zoneID := c.Param("zoneId")
+	recordID := c.Param("recordId")
+	if zoneID == "" || recordID == "" {
+		utils.ErrorResponse(c, "Zone ID and record ID are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	record, err := h.cfService.GetDNSRecord(ctx, zoneID, recordID)
+	if err != nil {
+		utils.ErrorResponse(c, "DNS record not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	response := models.DNSRecordResponse{
+		Success: true,
+		Message: "DNS record retrieved successfully",
+		Data:    *record,
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// CreateDNSRecord handles POST /api/cloudflare/zones/{zoneId}/dns_records
+func (h *CloudflareDNSHandler) CreateDNSRecord(c *gin.Context) {
+	zoneID := c.Param("zoneId")
+	if zoneID == "" {
+		utils.ErrorResponse(c, "Zone ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req models.DNSRecordInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		utils.ErrorResponse(c, "Invalid DNS record: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	record, err := h.cfService.CreateDNSRecord(ctx, zoneID, req.ToNewParams())
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to create DNS record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.SetAuditTarget(c, "recordId", record.ID)
+
+	response := models.DNSRecordResponse{
+		Success: true,
+		Message: "DNS record created successfully",
+		Data:    *record,
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// UpdateDNSRecord handles PUT /api/cloudflare/zones/{zoneId}/dns_records/{recordId}
+// The record is overwritten with the request body
+func (h *CloudflareDNSHandler) UpdateDNSRecord(c *gin.Context) {
+	zoneID := c.Param("zoneId")
+	recordID := c.Param("recordId")
+	if zoneID == "" || recordID == "" {
+		utils.ErrorResponse(c, "Zone ID and record ID are required", http.StatusBadRequest)
+		return
+	}
+
+	var req models.DNSRecordInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		utils.ErrorResponse(c, "Invalid DNS record: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	record, err := h.cfService.UpdateDNSRecord(ctx, zoneID, recordID, req.ToUpdateParams())
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to update DNS record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.DNSRecordResponse{
+		Success: true,
+		Message: "DNS record updated successfully",
+		Data:    *record,
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// DeleteDNSRecord handles DELETE /api/cloudflare/zones/{zoneId}/dns_records/{recordId}
+func (h *CloudflareDNSHandler) DeleteDNSRecord(c *gin.Context) {
+	zoneID := c.Param("zoneId")
+	recordID := c.Param("recordId")
+	if zoneID == "" || recordID == "" {
+		utils.ErrorResponse(c, "Zone ID and record ID are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := h.cfService.DeleteDNSRecord(ctx, zoneID, recordID); err != nil {
+		utils.ErrorResponse(c, "Failed to delete DNS record: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.DNSRecordDeleteResult{
+		Success: true,
+		Message: "DNS record deleted successfully",
+		ID:      recordID,
+	}
+	utils.SuccessResponse(c, response)
+}
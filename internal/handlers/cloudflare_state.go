@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+	"cfProxyHub/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// CloudflareStateHandler handles the declarative desired-state endpoints
+type CloudflareStateHandler struct {
+	cfService *services.CloudflareService
+}
+
+// NewCloudflareStateHandler creates a new desired-state handler instance
+func NewCloudflareStateHandler(cfService *services.CloudflareService) *CloudflareStateHandler {
+	return &CloudflareStateHandler{
+		cfService: cfService,
+	}
+}
+
+// PlanState handles POST /api/cloudflare/state/plan
+// Accepts a desired state document as JSON or YAML and returns the changes needed to reach it
+func (h *CloudflareStateHandler) PlanState(c *gin.Context) {
+	state, err := bindDesiredState(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid desired state document: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	plan, err := h.cfService.PlanDesiredState(ctx, state)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to plan desired state: "+err.Error(), publicHostnameErrorStatus(err))
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message": "Plan created successfully",
+		"plan":    plan,
+	})
+}
+
+// ApplyState handles POST /api/cloudflare/state/apply?plan=<fingerprint>
+// Plans the desired state document again and executes the changes if they are still those of the reviewed plan
+func (h *CloudflareStateHandler) ApplyState(c *gin.Context) {
+	fingerprint := strings.TrimSpace(c.Query("plan"))
+	if fingerprint == "" {
+		utils.ErrorResponse(c, "The plan fingerprint is required: plan the document first and pass its fingerprint as ?plan=", http.StatusBadRequest)
+		return
+	}
+
+	state, err := bindDesiredState(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid desired state document: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	result, err := h.applyState(ctx, c, state, fingerprint)
+	var missing *stateScopeError
+	if errors.As(err, &missing) {
+		utils.ErrorResponse(c, err.Error(), http.StatusForbidden)
+		return
+	}
+	var drift *services.StatePlanDriftError
+	if errors.As(err, &drift) {
+		utils.ErrorResponseWithData(c, "Nothing was applied: "+err.Error(), http.StatusConflict, gin.H{
+			"plan": drift.Plan,
+		})
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to apply desired state: "+err.Error(), publicHostnameErrorStatus(err))
+		return
+	}
+
+	// Every change with its before and after is recorded, under the IDs of the tunnels and zones it touched
+	middleware.SetAuditChange(c, nil, result)
+	for _, change := range result.Plan.Changes {
+		middleware.SetAuditTarget(c, "account_id:"+change.AccountID, change.AccountID)
+		if change.TunnelID != "" {
+			middleware.SetAuditTarget(c, "tunnel_id:"+change.TunnelID, change.TunnelID)
+		}
+		if change.ZoneID != "" {
+			middleware.SetAuditTarget(c, "zone_id:"+change.ZoneID, change.ZoneID)
+		}
+	}
+
+	message := "Desired state applied successfully"
+	if result.Failed > 0 {
+		message = "Desired state applied with errors"
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message": message,
+		"result":  result,
+	})
+}
+
+// ExportState handles GET /api/cloudflare/accounts/:accountId/state
+// Returns the current tunnels and ingress of the account as a desired state document (?format=yaml for YAML)
+func (h *CloudflareStateHandler) ExportState(c *gin.Context) {
+	accountID := c.Param("accountId")
+	if accountID == "" {
+		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	state, err := h.cfService.ExportDesiredState(ctx, accountID)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to export state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if c.Query("format") == "yaml" {
+		c.YAML(http.StatusOK, state)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":    "State exported successfully",
+		"account_id": accountID,
+		"state":      state,
+	})
+}
+
+// stateScopeError is returned when an API token lacks a scope needed for the changes of a plan
+type stateScopeError struct {
+	scope string
+}
+
+func (e *stateScopeError) Error() string {
+	return "Applying this plan requires an API token with the " + e.scope + " scope"
+}
+
+// applyState applies a reviewed plan, checking first that an API token has the scopes of its changes
+// Besides state:write, ingress changes need hostnames:write and DNS record changes need dns:write
+func (h *CloudflareStateHandler) applyState(ctx context.Context, c *gin.Context, state models.DesiredState, fingerprint string) (models.StateApplyResult, error) {
+	if token, ok := middleware.CurrentAPIToken(c); ok {
+		plan, err := h.cfService.PlanDesiredState(ctx, state)
+		if err != nil {
+			return models.StateApplyResult{}, err
+		}
+		if plan.Fingerprint != fingerprint {
+			return models.StateApplyResult{}, &services.StatePlanDriftError{Expected: fingerprint, Plan: plan}
+		}
+		for _, scope := range stateChangeScopes(plan) {
+			if !token.HasScope(scope) {
+				return models.StateApplyResult{}, &stateScopeError{scope: scope}
+			}
+		}
+	}
+
+	return h.cfService.ApplyDesiredState(ctx, state, fingerprint)
+}
+
+// stateChangeScopes returns the API token scopes needed for the changes of a plan
+func stateChangeScopes(plan models.StatePlan) []string {
+	var ingress, dns bool
+	for _, change := range plan.Changes {
+		switch change.Kind {
+		case models.PlanKindIngress:
+			ingress = true
+		case models.PlanKindDNSRecord:
+			dns = true
+		}
+	}
+
+	var scopes []string
+	if ingress {
+		scopes = append(scopes, models.ScopeHostnamesWrite)
+	}
+	if dns {
+		scopes = append(scopes, models.ScopeDNSWrite)
+	}
+	return scopes
+}
+
+// bindDesiredState decodes the request body as YAML or JSON depending on the content type
+func bindDesiredState(c *gin.Context) (models.DesiredState, error) {
+	var state models.DesiredState
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return state, err
+	}
+
+	contentType := c.ContentType()
+	if strings.Contains(contentType, "yaml") || c.Query("format") == "yaml" {
+		err = yaml.Unmarshal(body, &state)
+	} else {
+		err = json.Unmarshal(body, &state)
+	}
+
+	return state, err
+}
@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"cfProxyHub/internal/middleware"
 	"cfProxyHub/internal/models"
 	"cfProxyHub/internal/services"
 	"cfProxyHub/pkg/utils"
@@ -15,14 +19,62 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// hostnamePattern matches fully qualified hostnames, optionally with a leading wildcard label
+var hostnamePattern = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9-]{2,63}$`)
+
+// publicHostnameRequest is the body of the public hostname create and update endpoints
+type publicHostnameRequest struct {
+	Hostname      string                      `json:"hostname"`
+	Service       string                      `json:"service"`
+	Path          string                      `json:"path,omitempty"`
+	OriginRequest *models.OriginRequestConfig `json:"originRequest,omitempty"`
+}
+
+// validate checks the required fields, the service and the origin request options
+func (r *publicHostnameRequest) validate() error {
+	r.Hostname = strings.ToLower(strings.TrimSpace(r.Hostname))
+	r.Service = strings.TrimSpace(r.Service)
+
+	if r.Hostname == "" {
+		return fmt.Errorf("Hostname is required")
+	}
+	if !hostnamePattern.MatchString(r.Hostname) {
+		return fmt.Errorf("Invalid hostname: %s", r.Hostname)
+	}
+	if r.Service == "" {
+		return fmt.Errorf("Service is required")
+	}
+	if err := models.ValidateIngressService(r.Service); err != nil {
+		return fmt.Errorf("Invalid service: %w", err)
+	}
+	if r.OriginRequest != nil {
+		if err := r.OriginRequest.Validate(r.Service); err != nil {
+			return fmt.Errorf("Invalid originRequest: %w", err)
+		}
+	}
+	return nil
+}
+
+// toRule converts the request to the ingress rule written to the tunnel configuration
+func (r publicHostnameRequest) toRule() models.PublicHostnameRule {
+	return models.IngressRule{
+		Hostname:      r.Hostname,
+		Path:          r.Path,
+		Service:       r.Service,
+		OriginRequest: r.OriginRequest,
+	}.ToRule()
+}
+
 type CloudflareTunnelHandler struct {
 	cfService *services.CloudflareService
+	lifecycle *services.TunnelLifecycle
 }
 
 // NewCloudflareTunnelHandler creates a new Cloudflare Tunnel handler
-func NewCloudflareTunnelHandler(cfService *services.CloudflareService) *CloudflareTunnelHandler {
+func NewCloudflareTunnelHandler(cfService *services.CloudflareService, lifecycle *services.TunnelLifecycle) *CloudflareTunnelHandler {
 	return &CloudflareTunnelHandler{
 		cfService: cfService,
+		lifecycle: lifecycle,
 	}
 }
 
@@ -80,6 +132,107 @@ func (h *CloudflareTunnelHandler) GetTunnelByID(c *gin.Context) {
 	})
 }
 
+// GetTunnelsHealth handles the GET /api/cloudflare/accounts/:accountId/tunnels/health endpoint
+func (h *CloudflareTunnelHandler) GetTunnelsHealth(c *gin.Context) {
+	accountID := c.Param("accountId")
+	if accountID == "" {
+		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tunnels, err := h.cfService.GetCloudflareTunnelsHealth(ctx, accountID)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to fetch tunnel health: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summary := map[string]int{
+		models.TunnelHealthHealthy:  0,
+		models.TunnelHealthDegraded: 0,
+		models.TunnelHealthDown:     0,
+		models.TunnelHealthInactive: 0,
+		models.TunnelHealthUnknown:  0,
+	}
+	for _, tunnel := range tunnels {
+		summary[tunnel.Health]++
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":    "Tunnel health retrieved successfully",
+		"account_id": accountID,
+		"tunnels":    tunnels,
+		"summary":    summary,
+		"total":      len(tunnels),
+	})
+}
+
+// GetTunnelConnections handles the GET /api/cloudflare/accounts/:accountId/tunnels/:tunnel_id/connections endpoint
+func (h *CloudflareTunnelHandler) GetTunnelConnections(c *gin.Context) {
+	accountID := c.Param("accountId")
+	tunnelID := c.Param("tunnel_id")
+
+	if accountID == "" {
+		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
+		return
+	}
+	if tunnelID == "" {
+		utils.ErrorResponse(c, "Tunnel ID is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	connections, err := h.cfService.GetCloudflareTunnelConnections(ctx, accountID, tunnelID)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to fetch tunnel connections: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":     "Tunnel connections retrieved successfully",
+		"account_id":  accountID,
+		"tunnel_id":   tunnelID,
+		"connections": connections,
+		"total":       len(connections),
+	})
+}
+
+// GetTunnelHealth handles the GET /api/cloudflare/accounts/:accountId/tunnels/:tunnel_id/health endpoint
+func (h *CloudflareTunnelHandler) GetTunnelHealth(c *gin.Context) {
+	accountID := c.Param("accountId")
+	tunnelID := c.Param("tunnel_id")
+
+	if accountID == "" {
+		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
+		return
+	}
+	if tunnelID == "" {
+		utils.ErrorResponse(c, "Tunnel ID is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	health, connections, err := h.cfService.GetCloudflareTunnelHealth(ctx, accountID, tunnelID)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to fetch tunnel health: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":     "Tunnel health retrieved successfully",
+		"account_id":  accountID,
+		"tunnel_id":   tunnelID,
+		"health":      health,
+		"connections": connections,
+	})
+}
+
 // CreateTunnel handles the POST /api/cloudflare/accounts/:accountId/tunnels endpoint
 func (h *CloudflareTunnelHandler) CreateTunnel(c *gin.Context) {
 	accountID := c.Param("accountId")
@@ -117,6 +270,8 @@ func (h *CloudflareTunnelHandler) CreateTunnel(c *gin.Context) {
 		return
 	}
 
+	middleware.SetAuditTarget(c, "tunnel_id", tunnel.ID)
+
 	utils.SuccessResponse(c, gin.H{
 		"message":    "Tunnel created successfully",
 		"account_id": accountID,
@@ -181,19 +336,119 @@ func (h *CloudflareTunnelHandler) DeleteTunnel(c *gin.Context) {
 		return
 	}
 
+	if c.Query("force") == "true" {
+		h.forceDeleteTunnel(c, accountID, tunnelID)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	err := h.cfService.DeleteCloudflareTunnel(ctx, accountID, tunnelID)
+	// With cascade the CNAME records of the tunnel's hostnames are deleted too
+	var result *models.TunnelDeleteResult
+	var err error
+	if c.Query("cascade") == "true" {
+		if token, ok := middleware.CurrentAPIToken(c); ok && !token.HasScope(models.ScopeDNSWrite) {
+			utils.ErrorResponse(c, "Cascading delete requires an API token with the "+models.ScopeDNSWrite+" scope", http.StatusForbidden)
+			return
+		}
+		result, err = h.cfService.DeleteCloudflareTunnelWithDNS(ctx, accountID, tunnelID)
+	} else {
+		err = h.cfService.DeleteCloudflareTunnel(ctx, accountID, tunnelID)
+	}
 	if err != nil {
+		if errors.Is(err, services.ErrTunnelHasConnections) {
+			utils.ErrorResponse(c, "Failed to delete tunnel: cloudflared connectors are still connected. Stop them and clean up the tunnel's connections, or delete with force=true", http.StatusConflict)
+			return
+		}
 		utils.ErrorResponse(c, "Failed to delete tunnel: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	utils.SuccessResponse(c, gin.H{
+	response := gin.H{
 		"message":    "Tunnel deleted successfully",
 		"account_id": accountID,
 		"tunnel_id":  tunnelID,
+	}
+	if result != nil {
+		middleware.SetAuditChange(c, nil, result)
+		response["result"] = result
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// forceDeleteTunnel deletes a tunnel together with its cloudflared containers, connections and CNAME records
+// Removing containers and DNS records needs the docker:write and dns:write scopes on top of the tunnel delete permissions
+func (h *CloudflareTunnelHandler) forceDeleteTunnel(c *gin.Context, accountID, tunnelID string) {
+	if token, ok := middleware.CurrentAPIToken(c); ok {
+		for _, scope := range []string{models.ScopeDockerWrite, models.ScopeDNSWrite} {
+			if !token.HasScope(scope) {
+				utils.ErrorResponse(c, "Force delete requires an API token with the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	// Stopping cloudflared containers takes a while
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	result, err := h.lifecycle.ForceDelete(ctx, accountID, tunnelID)
+	middleware.SetAuditChange(c, nil, result)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrTunnelHasConnections) {
+			status = http.StatusConflict
+		}
+		utils.ErrorResponseWithData(c, "Failed to delete tunnel: "+err.Error(), status, gin.H{
+			"account_id": accountID,
+			"tunnel_id":  tunnelID,
+			"result":     result,
+		})
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":    "Tunnel force deleted successfully",
+		"account_id": accountID,
+		"tunnel_id":  tunnelID,
+		"result":     result,
+	})
+}
+
+// CleanupTunnelConnections handles the DELETE /api/cloudflare/accounts/:accountId/tunnels/:tunnel_id/connections endpoint
+// The optional connector_id query parameter limits the cleanup to one connector
+func (h *CloudflareTunnelHandler) CleanupTunnelConnections(c *gin.Context) {
+	accountID := c.Param("accountId")
+	tunnelID := c.Param("tunnel_id")
+	connectorID := strings.TrimSpace(c.Query("connector_id"))
+
+	if accountID == "" {
+		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
+		return
+	}
+	if tunnelID == "" {
+		utils.ErrorResponse(c, "Tunnel ID is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := h.cfService.CleanupCloudflareTunnelConnections(ctx, accountID, tunnelID, connectorID); err != nil {
+		utils.ErrorResponse(c, "Failed to clean up tunnel connections: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	message := "Tunnel connections cleaned up successfully"
+	if connectorID != "" {
+		message = "Connector connections cleaned up successfully"
+	}
+	utils.SuccessResponse(c, gin.H{
+		"message":      message,
+		"account_id":   accountID,
+		"tunnel_id":    tunnelID,
+		"connector_id": connectorID,
 	})
 }
 
@@ -228,6 +483,48 @@ func (h *CloudflareTunnelHandler) GetTunnelToken(c *gin.Context) {
 	})
 }
 
+// RotateTunnelSecret handles the POST /api/cloudflare/accounts/:accountId/tunnels/:tunnel_id/rotate-secret endpoint
+// Revokes every token of the tunnel and recreates its managed cloudflared containers with the new one
+func (h *CloudflareTunnelHandler) RotateTunnelSecret(c *gin.Context) {
+	accountID := c.Param("accountId")
+	tunnelID := c.Param("tunnel_id")
+
+	if accountID == "" {
+		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
+		return
+	}
+	if tunnelID == "" {
+		utils.ErrorResponse(c, "Tunnel ID is required", http.StatusBadRequest)
+		return
+	}
+	if token, ok := middleware.CurrentAPIToken(c); ok && !token.HasScope(models.ScopeDockerWrite) {
+		utils.ErrorResponse(c, "Rotating the secret requires an API token with the "+models.ScopeDockerWrite+" scope", http.StatusForbidden)
+		return
+	}
+
+	// Recreating cloudflared containers pulls their image
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	result, err := h.lifecycle.RotateSecret(ctx, accountID, tunnelID)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to rotate tunnel secret: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The audit log records what was recreated, never the new token
+	audited := *result
+	audited.Token = ""
+	middleware.SetAuditChange(c, nil, audited)
+
+	utils.SuccessResponse(c, gin.H{
+		"message":    "Tunnel secret rotated successfully",
+		"account_id": accountID,
+		"tunnel_id":  tunnelID,
+		"result":     result,
+	})
+}
+
 // GetPublicHostnamesByTunnelID handles the GET /api/cloudflare/accounts/:accountId/tunnels/:tunnel_id/hostnames endpoint
 func (h *CloudflareTunnelHandler) GetPublicHostnamesByTunnelID(c *gin.Context) {
 	accountID := c.Param("accountId")
@@ -245,18 +542,25 @@ func (h *CloudflareTunnelHandler) GetPublicHostnamesByTunnelID(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	hostnames, err := h.cfService.GetCloudflareTunnelPublicHostnames(ctx, accountID, tunnelID)
+	config, err := h.cfService.GetCloudflareTunnelConfiguration(ctx, accountID, tunnelID)
 	if err != nil {
 		utils.ErrorResponse(c, "Failed to fetch public hostnames: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	hostnames := config.Config.Ingress
+	if hostnames == nil {
+		hostnames = []models.PublicHostnameIngress{}
+	}
+
+	c.Header("ETag", configETag(config.Version))
 	utils.SuccessResponse(c, gin.H{
 		"message":    "Public hostnames retrieved successfully",
 		"account_id": accountID,
 		"tunnel_id":  tunnelID,
 		"hostnames":  hostnames,
 		"total":      len(hostnames),
+		"version":    config.Version,
 	})
 }
 
@@ -276,36 +580,33 @@ func (h *CloudflareTunnelHandler) CreatePublicHostname(c *gin.Context) {
 		return
 	}
 
-	// Create a simple struct to receive the JSON data
-	var requestData struct {
-		Hostname string `json:"hostname"`
-		Service  string `json:"service"`
-		Path     string `json:"path,omitempty"`
-	}
+	var requestData publicHostnameRequest
 
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Validate required fields
-	if requestData.Hostname == "" {
-		utils.ErrorResponse(c, "Hostname is required", http.StatusBadRequest)
-		return
-	}
-	if requestData.Service == "" {
-		utils.ErrorResponse(c, "Service is required", http.StatusBadRequest)
+	if err := requestData.validate(); err != nil {
+		utils.ErrorResponse(c, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Create the hostname parameter using the helper function
-	hostnameParam := models.NewPublicHostnameIngressParam(requestData.Hostname, requestData.Service, requestData.Path)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	before := h.currentIngress(ctx, accountID, tunnelID)
+
+	ctx, ok := withIfMatch(ctx, c)
+	if !ok {
+		return
+	}
+
 	// Use the new function that creates both tunnel config and DNS record
-	result, err := h.cfService.CreateCloudflareTunnelPublicHostnameWithDNS(ctx, accountID, tunnelID, requestData.Hostname, hostnameParam)
+	result, err := h.cfService.CreateCloudflareTunnelPublicHostnameWithDNS(ctx, accountID, tunnelID, requestData.Hostname, requestData.toRule())
+	if respondConfigConflict(c, err) {
+		return
+	}
 	if err != nil {
 		// Log the full error for debugging
 		fmt.Printf("Error creating public hostname: %v\n", err)
@@ -314,7 +615,7 @@ func (h *CloudflareTunnelHandler) CreatePublicHostname(c *gin.Context) {
 
 		// Provide more specific error messages
 		errorMessage := "Failed to create public hostname"
-		if strings.Contains(err.Error(), "already exists") {
+		if errors.Is(err, services.ErrHostnameExists) || strings.Contains(err.Error(), "already exists") {
 			errorMessage = "A hostname with this name already exists"
 		} else if strings.Contains(err.Error(), "invalid") {
 			errorMessage = "Invalid hostname configuration"
@@ -324,26 +625,31 @@ func (h *CloudflareTunnelHandler) CreatePublicHostname(c *gin.Context) {
 			errorMessage = "Domain validation failed: " + err.Error()
 		}
 
-		utils.ErrorResponse(c, errorMessage+": "+err.Error(), http.StatusInternalServerError)
+		utils.ErrorResponse(c, errorMessage+": "+err.Error(), publicHostnameErrorStatus(err))
 		return
 	}
 
+	middleware.SetAuditChange(c, before, result.Config.Ingress)
+	c.Header("ETag", configETag(result.Version))
 	utils.SuccessResponse(c, gin.H{
 		"message":    "Public hostname created successfully",
 		"account_id": accountID,
 		"tunnel_id":  tunnelID,
 		"hostname":   requestData.Hostname,
 		"config":     result,
+		"version":    result.Version,
 	})
 }
 
 // UpdatePublicHostname handles the PUT /api/cloudflare/accounts/:accountId/tunnels/:tunnel_id/hostnames/:hostname endpoint
+// The optional path query parameter selects the rule among several paths of the hostname, no path selects the rule without one
 func (h *CloudflareTunnelHandler) UpdatePublicHostname(c *gin.Context) {
 	accountID := c.Param("accountId")
 	tunnelID := c.Param("tunnel_id")
 	targetHostname := c.Param("hostname")
+	targetPath := c.Query("path")
 
-	log.Printf("UpdatePublicHostname called with accountID: %s, tunnelID: %s, targetHostname: %s", accountID, tunnelID, targetHostname)
+	log.Printf("UpdatePublicHostname called with accountID: %s, tunnelID: %s, targetHostname: %s, targetPath: %s", accountID, tunnelID, targetHostname, targetPath)
 
 	if accountID == "" {
 		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
@@ -358,12 +664,7 @@ func (h *CloudflareTunnelHandler) UpdatePublicHostname(c *gin.Context) {
 		return
 	}
 
-	// Create a simple struct to receive the JSON data
-	var requestData struct {
-		Hostname string `json:"hostname"`
-		Service  string `json:"service"`
-		Path     string `json:"path,omitempty"`
-	}
+	var requestData publicHostnameRequest
 
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		log.Printf("Error binding JSON: %v", err)
@@ -373,49 +674,57 @@ func (h *CloudflareTunnelHandler) UpdatePublicHostname(c *gin.Context) {
 
 	log.Printf("Request data: hostname=%s, service=%s, path=%s", requestData.Hostname, requestData.Service, requestData.Path)
 
-	// Validate required fields
-	if requestData.Hostname == "" {
-		utils.ErrorResponse(c, "Hostname is required", http.StatusBadRequest)
-		return
-	}
-	if requestData.Service == "" {
-		utils.ErrorResponse(c, "Service is required", http.StatusBadRequest)
+	if err := requestData.validate(); err != nil {
+		utils.ErrorResponse(c, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Create the hostname parameter using the helper function
-	hostnameParam := models.NewPublicHostnameIngressParam(requestData.Hostname, requestData.Service, requestData.Path)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	before := h.currentIngress(ctx, accountID, tunnelID)
+
+	ctx, ok := withIfMatch(ctx, c)
+	if !ok {
+		return
+	}
+
 	log.Printf("Calling UpdateCloudflareTunnelPublicHostnameWithDNS with targetHostname: %s, newHostname: %s", targetHostname, requestData.Hostname)
 
 	// Use the new function that updates both tunnel config and DNS record
-	result, err := h.cfService.UpdateCloudflareTunnelPublicHostnameWithDNS(ctx, accountID, tunnelID, targetHostname, requestData.Hostname, hostnameParam)
+	result, err := h.cfService.UpdateCloudflareTunnelPublicHostnameWithDNS(ctx, accountID, tunnelID, targetHostname, targetPath, requestData.Hostname, requestData.toRule())
+	if respondConfigConflict(c, err) {
+		return
+	}
 	if err != nil {
 		log.Printf("Error updating public hostname: %v", err)
-		utils.ErrorResponse(c, "Failed to update public hostname: "+err.Error(), http.StatusInternalServerError)
+		utils.ErrorResponse(c, "Failed to update public hostname: "+err.Error(), publicHostnameErrorStatus(err))
 		return
 	}
 
 	log.Printf("Successfully updated public hostname")
 
+	middleware.SetAuditChange(c, before, result.Config.Ingress)
+	c.Header("ETag", configETag(result.Version))
 	utils.SuccessResponse(c, gin.H{
 		"message":         "Public hostname updated successfully",
 		"account_id":      accountID,
 		"tunnel_id":       tunnelID,
 		"target_hostname": targetHostname,
+		"target_path":     targetPath,
 		"new_hostname":    requestData.Hostname,
 		"config":          result,
+		"version":         result.Version,
 	})
 }
 
 // DeletePublicHostname handles the DELETE /api/cloudflare/accounts/:accountId/tunnels/:tunnel_id/hostnames/:hostname endpoint
+// The optional path query parameter selects the rule among several paths of the hostname, no path selects the rule without one
 func (h *CloudflareTunnelHandler) DeletePublicHostname(c *gin.Context) {
 	accountID := c.Param("accountId")
 	tunnelID := c.Param("tunnel_id")
 	targetHostname := c.Param("hostname")
+	targetPath := c.Query("path")
 
 	if accountID == "" {
 		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
@@ -433,18 +742,102 @@ func (h *CloudflareTunnelHandler) DeletePublicHostname(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	before := h.currentIngress(ctx, accountID, tunnelID)
+
+	ctx, ok := withIfMatch(ctx, c)
+	if !ok {
+		return
+	}
+
 	// Use the new function that deletes both tunnel config and DNS record
-	result, err := h.cfService.DeleteCloudflareTunnelPublicHostnameWithDNS(ctx, accountID, tunnelID, targetHostname)
+	result, err := h.cfService.DeleteCloudflareTunnelPublicHostnameWithDNS(ctx, accountID, tunnelID, targetHostname, targetPath)
+	if respondConfigConflict(c, err) {
+		return
+	}
 	if err != nil {
-		utils.ErrorResponse(c, "Failed to delete public hostname: "+err.Error(), http.StatusInternalServerError)
+		utils.ErrorResponse(c, "Failed to delete public hostname: "+err.Error(), publicHostnameErrorStatus(err))
 		return
 	}
 
+	middleware.SetAuditChange(c, before, result.Config.Ingress)
+	c.Header("ETag", configETag(result.Version))
 	utils.SuccessResponse(c, gin.H{
 		"message":          "Public hostname deleted successfully",
 		"account_id":       accountID,
 		"tunnel_id":        tunnelID,
 		"deleted_hostname": targetHostname,
+		"deleted_path":     targetPath,
 		"config":           result,
+		"version":          result.Version,
+	})
+}
+
+// currentIngress returns the tunnel's ingress rules to record as the audit log's before state
+// A failure to read them only leaves the before state out of the audit event
+func (h *CloudflareTunnelHandler) currentIngress(ctx context.Context, accountID, tunnelID string) interface{} {
+	config, err := h.cfService.GetCloudflareTunnelConfiguration(ctx, accountID, tunnelID)
+	if err != nil {
+		log.Printf("Failed to read the ingress of tunnel %s for the audit log: %v", tunnelID, err)
+		return nil
+	}
+	return config.Config.Ingress
+}
+
+// publicHostnameErrorStatus maps hostname validation failures to client errors
+func publicHostnameErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrZoneNotFound):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrHostnameExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrHostnameNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// configETag formats a tunnel configuration version as an entity tag
+func configETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// withIfMatch makes the tunnel configuration edit conditional on the version in the If-Match header
+// Responds with 400 and returns false if the header doesn't hold a configuration version
+func withIfMatch(ctx context.Context, c *gin.Context) (context.Context, bool) {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return ctx, true
+	}
+
+	tag := strings.TrimPrefix(ifMatch, "W/")
+	tag = strings.Trim(tag, `"`)
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid If-Match header: expected a configuration version such as \"12\"", http.StatusBadRequest)
+		return ctx, false
+	}
+
+	return services.WithExpectedConfigVersion(ctx, version), true
+}
+
+// respondConfigConflict responds with 409 and the current hostnames if the configuration moved underneath the caller
+func respondConfigConflict(c *gin.Context, err error) bool {
+	var conflict *services.TunnelConfigConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+
+	hostnames := conflict.Current.Config.Ingress
+	if hostnames == nil {
+		hostnames = []models.PublicHostnameIngress{}
+	}
+
+	c.Header("ETag", configETag(conflict.Current.Version))
+	utils.ErrorResponseWithData(c, "Tunnel configuration was changed by someone else: "+err.Error(), http.StatusConflict, gin.H{
+		"tunnel_id": conflict.TunnelID,
+		"version":   conflict.Current.Version,
+		"hostnames": hostnames,
 	})
+	return true
 }
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+	"cfProxyHub/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTunnelDNSReport handles the GET /api/cloudflare/accounts/:accountId/tunnels/dns/report endpoint
+// Reports orphaned tunnel CNAMEs and ingress hostnames without one, without changing anything
+func (h *CloudflareTunnelHandler) GetTunnelDNSReport(c *gin.Context) {
+	accountID := c.Param("accountId")
+	if accountID == "" {
+		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Every zone's records and every tunnel's ingress are read
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	report, err := h.cfService.ScanTunnelDNS(ctx, accountID)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to scan tunnel DNS records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":    "Tunnel DNS records scanned successfully",
+		"account_id": accountID,
+		"report":     report,
+	})
+}
+
+// RepairTunnelDNS handles the POST /api/cloudflare/accounts/:accountId/tunnels/dns/repair endpoint
+// The body {"kinds": [...], "ids": [...]} selects the findings to repair by kind or by the IDs of a report
+func (h *CloudflareTunnelHandler) RepairTunnelDNS(c *gin.Context) {
+	accountID := c.Param("accountId")
+	if accountID == "" {
+		utils.ErrorResponse(c, "Account ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Kinds []string `json:"kinds"`
+		IDs   []string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(request.Kinds) == 0 && len(request.IDs) == 0 {
+		utils.ErrorResponse(c, "Select the findings to repair with kinds or the ids of a report", http.StatusBadRequest)
+		return
+	}
+	for _, kind := range request.Kinds {
+		if !slices.Contains(models.TunnelDNSKinds, kind) {
+			utils.ErrorResponse(c, "Invalid kind: "+kind, http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	result, err := h.cfService.RepairTunnelDNS(ctx, accountID, request.Kinds, request.IDs)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to repair tunnel DNS records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	middleware.SetAuditChange(c, nil, result.Results)
+
+	message := "Tunnel DNS records repaired successfully"
+	if result.Failed > 0 {
+		message = "Tunnel DNS records repaired with errors"
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":    message,
+		"account_id": accountID,
+		"result":     result,
+	})
+}
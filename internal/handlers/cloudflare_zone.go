@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"cfProxyHub/internal/middleware"
 	"cfProxyHub/internal/models"
 	"cfProxyHub/internal/services"
 	"cfProxyHub/pkg/utils"
@@ -26,6 +28,8 @@ func NewCloudflareZoneHandler(cfService *services.CloudflareService) *Cloudflare
 }
 
 // GetZonesByAccountID handles GET /api/cloudflare/accounts/{accountId}/zones
+// Query parameters: search, status, active_only, summary, page, per_page, order, direction
+// Without page or per_page every matching zone is returned
 func (h *CloudflareZoneHandler) GetZonesByAccountID(c *gin.Context) {
 	accountID := c.Param("accountId")
 	if accountID == "" {
@@ -33,24 +37,26 @@ func (h *CloudflareZoneHandler) GetZonesByAccountID(c *gin.Context) {
 		return
 	}
 
-	// Get optional query parameters
-	activeOnly := c.Query("active_only") == "true"
-	searchTerm := c.Query("search")
+	filter, err := parseZoneFilter(c, c.Query("active_only") == "true")
+	if err != nil {
+		utils.ErrorResponse(c, err.Error(), http.StatusBadRequest)
+		return
+	}
+	paged := c.Query("page") != "" || c.Query("per_page") != ""
 	summaryOnly := c.Query("summary") == "true"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	var zones []models.Zone
-	var err error
+	var info *models.ResultInfo
 
-	// Choose the appropriate service method based on query parameters
-	if searchTerm != "" {
-		zones, err = h.cfService.SearchZones(ctx, accountID, searchTerm)
-	} else if activeOnly {
-		zones, err = h.cfService.GetActiveZones(ctx, accountID)
+	if paged {
+		var pageInfo models.ResultInfo
+		zones, pageInfo, err = h.cfService.ListZones(ctx, accountID, filter)
+		info = &pageInfo
 	} else {
-		zones, err = h.cfService.GetZonesByAccountID(ctx, accountID)
+		zones, err = h.cfService.ListAllZones(ctx, accountID, filter)
 	}
 
 	if err != nil {
@@ -58,27 +64,83 @@ func (h *CloudflareZoneHandler) GetZonesByAccountID(c *gin.Context) {
 		return
 	}
 
+	total := len(zones)
+	if info != nil {
+		total = info.TotalCount
+	}
+
 	// Return summary or full data based on query parameter
 	if summaryOnly {
 		summaries := models.NewZoneSummariesFromZones(zones)
 		response := models.ZoneSummaryResponse{
-			Success: true,
-			Message: "Zones retrieved successfully",
-			Data:    summaries,
-			Total:   len(summaries),
+			Success:    true,
+			Message:    "Zones retrieved successfully",
+			Data:       summaries,
+			Total:      total,
+			ResultInfo: info,
 		}
 		utils.SuccessResponse(c, response)
 	} else {
 		response := models.ZonesResponse{
-			Success: true,
-			Message: "Zones retrieved successfully",
-			Data:    zones,
-			Total:   len(zones),
+			Success:    true,
+			Message:    "Zones retrieved successfully",
+			Data:       zones,
+			Total:      total,
+			ResultInfo: info,
 		}
 		utils.SuccessResponse(c, response)
 	}
 }
 
+// parseZoneFilter reads the zone listing query parameters
+// activeOnly selects active zones unless an explicit status is given
+func parseZoneFilter(c *gin.Context, activeOnly bool) (models.ZoneFilter, error) {
+	filter := models.ZoneFilter{
+		Name:      c.Query("search"),
+		Status:    c.Query("status"),
+		Order:     c.Query("order"),
+		Direction: c.Query("direction"),
+		Page:      1,
+		PerPage:   50,
+	}
+	if filter.Status == "" && activeOnly {
+		filter.Status = "active"
+	}
+
+	if page := c.Query("page"); page != "" {
+		parsed, err := strconv.Atoi(page)
+		if err != nil || parsed < 1 {
+			return filter, fmt.Errorf("page must be a positive number")
+		}
+		filter.Page = parsed
+	}
+	if perPage := c.Query("per_page"); perPage != "" {
+		parsed, err := strconv.Atoi(perPage)
+		if err != nil || parsed < 5 || parsed > 50 {
+			return filter, fmt.Errorf("per_page must be between 5 and 50")
+		}
+		filter.PerPage = parsed
+	}
+
+	switch filter.Status {
+	case "", "initializing", "pending", "active", "moved":
+	default:
+		return filter, fmt.Errorf("status must be one of initializing, pending, active, moved")
+	}
+	switch filter.Order {
+	case "", "name", "status", "account.id", "account.name", "plan.id":
+	default:
+		return filter, fmt.Errorf("order must be one of name, status, account.id, account.name, plan.id")
+	}
+	switch filter.Direction {
+	case "", "asc", "desc":
+	default:
+		return filter, fmt.Errorf("direction must be asc or desc")
+	}
+
+	return filter, nil
+}
+
 // GetZoneByID handles GET /api/cloudflare/zones/{zoneId}
 func (h *CloudflareZoneHandler) GetZoneByID(c *gin.Context) {
 	zoneID := c.Param("zoneId")
@@ -136,7 +198,7 @@ func (h *CloudflareZoneHandler) GetZoneByName(c *gin.Context) {
 }
 
 // GetZonesForDropdown handles GET /api/cloudflare/accounts/{accountId}/zones/dropdown
-// Returns zone summaries optimized for dropdown usage
+// Returns zone summaries optimized for dropdown usage, every zone unless a page is requested
 func (h *CloudflareZoneHandler) GetZonesForDropdown(c *gin.Context) {
 	accountID := c.Param("accountId")
 	if accountID == "" {
@@ -144,52 +206,47 @@ func (h *CloudflareZoneHandler) GetZonesForDropdown(c *gin.Context) {
 		return
 	}
 
-	// Get optional query parameters
-	searchTerm := c.Query("search")
-	limitStr := c.Query("limit")
 	activeOnly := c.Query("active_only") != "false" // Default to true for dropdown
-
-	// Parse limit parameter
-	limit := 50 // Default limit
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
-			limit = parsedLimit
-		}
+	filter, err := parseZoneFilter(c, activeOnly)
+	if err != nil {
+		utils.ErrorResponse(c, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	var zones []models.Zone
-	var err error
+	// A dropdown has to offer every zone, so without a page all pages are fetched
+	if c.Query("page") == "" {
+		zones, err := h.cfService.ListAllZones(ctx, accountID, filter)
+		if err != nil {
+			utils.ErrorResponse(c, "Failed to fetch zones: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	// Choose the appropriate service method
-	if searchTerm != "" {
-		zones, err = h.cfService.SearchZones(ctx, accountID, searchTerm)
-	} else if activeOnly {
-		zones, err = h.cfService.GetActiveZones(ctx, accountID)
-	} else {
-		zones, err = h.cfService.GetZonesByAccountID(ctx, accountID)
+		utils.SuccessResponse(c, gin.H{
+			"message": "Zones retrieved successfully",
+			"zones":   models.NewZoneSummariesFromZones(zones),
+			"total":   len(zones),
+		})
+		return
 	}
 
+	zones, info, err := h.cfService.ListZones(ctx, accountID, filter)
 	if err != nil {
 		utils.ErrorResponse(c, "Failed to fetch zones: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Apply limit
-	if len(zones) > limit {
-		zones = zones[:limit]
-	}
-
 	// Convert to summaries for dropdown
 	summaries := models.NewZoneSummariesFromZones(zones)
 
 	// Use standard response format for consistency
 	utils.SuccessResponse(c, gin.H{
-		"message": "Zones retrieved successfully",
-		"zones":   summaries,
-		"total":   len(summaries),
+		"message":     "Zones retrieved successfully",
+		"zones":       summaries,
+		"total":       info.TotalCount,
+		"result_info": info,
 	})
 }
 
@@ -222,6 +279,8 @@ func (h *CloudflareZoneHandler) CreateZone(c *gin.Context) {
 		return
 	}
 
+	middleware.SetAuditTarget(c, "zoneId", zone.ID)
+
 	response := models.ZoneResponse{
 		Success: true,
 		Message: "Zone created successfully",
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"cfProxyHub/internal/middleware"
 	"cfProxyHub/internal/services"
 	"cfProxyHub/pkg/utils"
 
@@ -80,6 +81,8 @@ func (h *DockerHandler) CreateContainer(c *gin.Context) {
 		return
 	}
 
+	middleware.SetAuditTarget(c, "id", id)
+
 	utils.SuccessResponse(c, gin.H{
 		"id":      id,
 		"message": "Container created successfully",
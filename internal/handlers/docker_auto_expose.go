@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"cfProxyHub/internal/services"
+	"cfProxyHub/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DockerAutoExposeHandler handles HTTP requests related to label-driven container exposure
+type DockerAutoExposeHandler struct {
+	exposer *services.DockerAutoExposer
+}
+
+// NewDockerAutoExposeHandler creates a new DockerAutoExposeHandler instance
+func NewDockerAutoExposeHandler(exposer *services.DockerAutoExposer) *DockerAutoExposeHandler {
+	return &DockerAutoExposeHandler{
+		exposer: exposer,
+	}
+}
+
+// ListExposures handles GET /api/docker/exposures
+func (h *DockerAutoExposeHandler) ListExposures(c *gin.Context) {
+	exposures := h.exposer.Exposures()
+
+	utils.SuccessResponse(c, gin.H{
+		"message":   "Exposed containers retrieved successfully",
+		"exposures": exposures,
+		"total":     len(exposures),
+	})
+}
+
+// SyncExposures handles POST /api/docker/exposures/sync
+// Triggers an immediate reconciliation instead of waiting for the next interval
+func (h *DockerAutoExposeHandler) SyncExposures(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if err := h.exposer.Sync(ctx); err != nil {
+		utils.ErrorResponse(c, "Failed to sync exposed containers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	exposures := h.exposer.Exposures()
+	utils.SuccessResponse(c, gin.H{
+		"message":   "Exposed containers synced successfully",
+		"exposures": exposures,
+		"total":     len(exposures),
+	})
+}
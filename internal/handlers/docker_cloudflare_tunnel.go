@@ -2,11 +2,10 @@ package handlers
 
 import (
 	"context"
-	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
+	"cfProxyHub/internal/middleware"
 	"cfProxyHub/internal/services"
 	"cfProxyHub/pkg/utils"
 
@@ -17,12 +16,14 @@ import (
 // DockerCloudflareTunnelHandler handles HTTP requests related to Cloudflare Tunnels in Docker
 type DockerCloudflareTunnelHandler struct {
 	dockerService *services.DockerService
+	dockerWatcher *services.DockerWatcher
 }
 
 // NewDockerCloudflareTunnelHandler creates a new DockerCloudflareTunnelHandler instance
-func NewDockerCloudflareTunnelHandler(dockerService *services.DockerService) *DockerCloudflareTunnelHandler {
+func NewDockerCloudflareTunnelHandler(dockerService *services.DockerService, dockerWatcher *services.DockerWatcher) *DockerCloudflareTunnelHandler {
 	return &DockerCloudflareTunnelHandler{
 		dockerService: dockerService,
+		dockerWatcher: dockerWatcher,
 	}
 }
 
@@ -48,68 +49,25 @@ func NormalizeContainerResponse(container types.Container) map[string]interface{
 	return result
 }
 
-// ListTunnels returns all Cloudflare Tunnel containers
+// ListTunnels returns all Cloudflare Tunnel containers from the watcher's cache
 func (h *DockerCloudflareTunnelHandler) ListTunnels(c *gin.Context) {
-	// Log the request for debugging
-	c.Header("X-Debug", "ListTunnels endpoint called")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*") // Add CORS header for debugging
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	// Check if Docker service is connected
-	if h.dockerService == nil {
+	if h.dockerWatcher == nil {
 		utils.ErrorResponse(c, "Docker service not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	// First check Docker connectivity
-	pingErr := h.dockerService.Ping(ctx)
-	if pingErr != nil {
-		c.Header("X-Debug-Docker", "Docker daemon connection failed")
-		utils.ErrorResponse(c, "Failed to connect to Docker daemon: "+pingErr.Error(), http.StatusInternalServerError)
+	// The cache is only trustworthy while the events stream is connected
+	status := h.dockerWatcher.Status()
+	if !status.Synced {
+		utils.ErrorResponse(c, "Failed to connect to Docker daemon: "+status.LastError, http.StatusServiceUnavailable)
 		return
 	}
 
-	// Try to find Cloudflare tunnel containers
-	tunnels, err := h.dockerService.FindCloudflareTunnelContainers(ctx)
-	if err != nil {
-		// Log the error
-		c.Error(err)
-		c.Header("X-Debug-Error", err.Error())
-
-		// Try listing all containers as a fallback
-		allContainers, allErr := h.dockerService.ListContainers(ctx)
-		if allErr != nil {
-			c.Header("X-Debug-AllError", allErr.Error())
-			utils.ErrorResponse(c, "Failed to list any containers: "+allErr.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// Filter the containers for potential Cloudflare tunnels based on image name
-		var possibleTunnels []types.Container
-		for _, container := range allContainers {
-			if strings.Contains(strings.ToLower(container.Image), "cloudflare") {
-				possibleTunnels = append(possibleTunnels, container)
-			}
-		}
-
-		// If we found any, return those
-		if len(possibleTunnels) > 0 {
-			c.Header("X-Debug-Info", "Returning filtered containers by image")
-			utils.SuccessResponse(c, possibleTunnels)
-			return
-		}
-
-		// Otherwise return all containers
-		c.Header("X-Debug-Info", "Returning all containers as fallback")
-		utils.SuccessResponse(c, allContainers)
-		return
-	}
+	tunnels := h.dockerWatcher.TunnelContainers()
 
 	// If no tunnels found, return empty array instead of null
-	if tunnels == nil || len(tunnels) == 0 {
-		c.Header("X-Debug-Info", "No Cloudflare tunnel containers found")
+	if len(tunnels) == 0 {
 		utils.SuccessResponse(c, []map[string]interface{}{})
 		return
 	}
@@ -120,7 +78,6 @@ func (h *DockerCloudflareTunnelHandler) ListTunnels(c *gin.Context) {
 		normalizedTunnels[i] = NormalizeContainerResponse(tunnel)
 	}
 
-	c.Header("X-Debug-Info", fmt.Sprintf("Found %d Cloudflare tunnel containers", len(tunnels)))
 	utils.SuccessResponse(c, normalizedTunnels)
 }
 
@@ -146,6 +103,7 @@ func (h *DockerCloudflareTunnelHandler) CreateTunnel(c *gin.Context) {
 		utils.ErrorResponse(c, "Failed to create Cloudflare tunnel: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	middleware.SetAuditTarget(c, "id", containerID)
 
 	// Start the container
 	if err := h.dockerService.StartContainer(ctx, containerID); err != nil {
@@ -338,57 +296,44 @@ func (h *DockerCloudflareTunnelHandler) RestartTunnel(c *gin.Context) {
 	})
 }
 
-// DockerDebugInfo returns diagnostic information about Docker
+// DockerDebugInfo returns diagnostic information about Docker from the watcher's cache
 func (h *DockerCloudflareTunnelHandler) DockerDebugInfo(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	status := h.dockerWatcher.Status()
 
 	debugInfo := map[string]interface{}{
 		"docker_status": "unknown",
 		"errors":        []string{},
 		"containers":    []interface{}{},
+		"watcher":       status,
 		"timestamp":     time.Now().String(),
 	}
 
 	// Check Docker connectivity
-	pingErr := h.dockerService.Ping(ctx)
-	if pingErr != nil {
+	if !status.Connected {
 		debugInfo["docker_status"] = "disconnected"
-		debugInfo["errors"] = append(debugInfo["errors"].([]string), "Docker connection error: "+pingErr.Error())
+		debugInfo["errors"] = append(debugInfo["errors"].([]string), "Docker connection error: "+status.LastError)
 		utils.SuccessResponse(c, debugInfo)
 		return
 	}
 
 	debugInfo["docker_status"] = "connected"
 
-	// Get all containers
-	containers, err := h.dockerService.ListContainers(ctx)
-	if err != nil {
-		debugInfo["errors"] = append(debugInfo["errors"].([]string), "Container listing error: "+err.Error())
-	} else {
-		// Add container info
-		simplifiedContainers := []map[string]interface{}{}
-		for _, container := range containers {
-			simplifiedContainers = append(simplifiedContainers, map[string]interface{}{
-				"id":     container.ID,
-				"names":  container.Names,
-				"image":  container.Image,
-				"state":  container.State,
-				"status": container.Status,
-				"labels": container.Labels,
-			})
-		}
-		debugInfo["containers"] = simplifiedContainers
-		debugInfo["container_count"] = len(containers)
-	}
-
-	// Try to find Cloudflare tunnels
-	tunnels, err := h.dockerService.FindCloudflareTunnelContainers(ctx)
-	if err != nil {
-		debugInfo["errors"] = append(debugInfo["errors"].([]string), "Tunnel detection error: "+err.Error())
-	} else {
-		debugInfo["tunnel_count"] = len(tunnels)
+	// Add container info
+	containers := h.dockerWatcher.Containers()
+	simplifiedContainers := []map[string]interface{}{}
+	for _, container := range containers {
+		simplifiedContainers = append(simplifiedContainers, map[string]interface{}{
+			"id":     container.ID,
+			"names":  container.Names,
+			"image":  container.Image,
+			"state":  container.State,
+			"status": container.Status,
+			"labels": container.Labels,
+		})
 	}
+	debugInfo["containers"] = simplifiedContainers
+	debugInfo["container_count"] = len(containers)
+	debugInfo["tunnel_count"] = status.TunnelCount
 
 	utils.SuccessResponse(c, debugInfo)
 }
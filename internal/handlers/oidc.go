@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie binds a login started at the identity provider to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+// OIDCLogin handles GET /auth/oidc/login by redirecting to the identity provider
+func (h *LoginHandler) OIDCLogin(c *gin.Context) {
+	if h.oidc == nil || h.config.CFAccessEnabled() {
+		h.renderLogin(c, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	state, url, err := h.oidc.StartLogin(ctx)
+	if err != nil {
+		log.Printf("Failed to start OIDC login: %v", err)
+		h.renderLogin(c, http.StatusBadGateway, "The identity provider is unavailable")
+		return
+	}
+
+	middleware.SetLaxCookie(c, h.config, oidcStateCookie, state, int((10 * time.Minute).Seconds()), "/auth/oidc")
+	c.Redirect(http.StatusFound, url)
+}
+
+// OIDCCallback handles GET /auth/oidc/callback, the redirect back from the identity provider
+// The user is created or updated with the role mapped from their groups, then logged in
+func (h *LoginHandler) OIDCCallback(c *gin.Context) {
+	if h.oidc == nil || h.config.CFAccessEnabled() {
+		h.renderLogin(c, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	// The state cookie is single use
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	middleware.SetLaxCookie(c, h.config, oidcStateCookie, "", -1, "/auth/oidc")
+
+	if errParam := c.Query("error"); errParam != "" {
+		log.Printf("OIDC login failed at the identity provider: %s %s", errParam, c.Query("error_description"))
+		h.renderLogin(c, http.StatusUnauthorized, "Single sign-on failed: "+errParam)
+		return
+	}
+
+	state := c.Query("state")
+	if state == "" || state != cookieState {
+		h.renderLogin(c, http.StatusBadRequest, "Single sign-on failed: invalid login state, please try again")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	identity, err := h.oidc.FinishLogin(ctx, state, c.Query("code"))
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		message := "Single sign-on failed"
+		if errors.Is(err, services.ErrOIDCInvalidState) || errors.Is(err, services.ErrOIDCNoRole) {
+			message += ": " + err.Error()
+		}
+		h.renderLogin(c, http.StatusUnauthorized, message)
+		return
+	}
+
+	user, err := h.users.Provision(identity.Username, identity.Role, "oidc")
+	if err != nil {
+		log.Printf("OIDC login of %s rejected: %v", identity.Username, err)
+		h.renderLogin(c, http.StatusForbidden, "Single sign-on failed: "+err.Error())
+		return
+	}
+
+	if err := h.startSession(c, user); err != nil {
+		h.renderLogin(c, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	log.Printf("User %s logged in through %s with role %s", user.Username, h.oidc.Name(), user.Role)
+	c.Redirect(http.StatusFound, "/")
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+	"cfProxyHub/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+// loginChallengeCookie carries a password login waiting for its two-factor code
+const loginChallengeCookie = "login_challenge"
+
+// twoFactorCodeRequest is the body of the endpoints taking a TOTP or recovery code
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// totpQRCode renders a provisioning URI as a PNG data URI for authenticator apps to scan
+// Without it the secret can still be entered by hand, so failures are only logged
+func totpQRCode(uri string) string {
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		log.Printf("Failed to render two-factor QR code: %v", err)
+		return ""
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+}
+
+// needsSecondFactor reports whether a user who passed the password check still needs a TOTP code
+// enroll is set when the policy requires two-factor authentication the user hasn't set up yet
+func (h *LoginHandler) needsSecondFactor(user *models.User) (needed bool, enroll bool) {
+	if user.TOTPEnabled {
+		return true, false
+	}
+	if h.users.TOTPRequired(user) {
+		return true, true
+	}
+	return false, false
+}
+
+// startChallenge remembers a password login until its two-factor code arrives
+func (h *LoginHandler) startChallenge(c *gin.Context, user *models.User, enroll bool) error {
+	token, err := h.challenges.Create(user.Username, enroll)
+	if err != nil {
+		log.Printf("Failed to create login challenge for %s: %v", user.Username, err)
+		return err
+	}
+	middleware.SetCookie(c, h.config, loginChallengeCookie, token, 300, true)
+	return nil
+}
+
+// LoginTwoFactorEnroll handles POST /api/auth/login/2fa/enroll
+// Users the policy requires to use two-factor authentication set it up here during their first login
+func (h *LoginHandler) LoginTwoFactorEnroll(c *gin.Context) {
+	token, _ := c.Cookie(loginChallengeCookie)
+	challenge, ok := h.challenges.Get(token)
+	if !ok || !challenge.Enroll {
+		utils.ErrorResponse(c, "No two-factor enrollment pending, please log in again", http.StatusUnauthorized)
+		return
+	}
+
+	secret, uri, err := h.users.BeginTOTPEnrollment(challenge.Username)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to start two-factor enrollment: "+err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"success":          true,
+		"message":          "Add the secret to your authenticator app and enter the code it shows",
+		"secret":           secret,
+		"provisioning_uri": uri,
+		"qr_code":          totpQRCode(uri),
+	})
+}
+
+// LoginTwoFactor handles POST /api/auth/login/2fa, the second step of a password login
+// Codes are throttled like passwords; for enrollments the first valid code enables two-factor authentication
+func (h *LoginHandler) LoginTwoFactor(c *gin.Context) {
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, _ := c.Cookie(loginChallengeCookie)
+	challenge, ok := h.challenges.Get(token)
+	if !ok {
+		utils.ErrorResponse(c, "Login expired, please log in again", http.StatusUnauthorized)
+		return
+	}
+
+	ip := c.ClientIP()
+	if err := h.limiter.Check(ip, challenge.Username); err != nil {
+		h.recordTwoFactor(c, challenge.Username, models.AuditOutcomeDenied, err.Error())
+		var locked *services.LoginLockedError
+		if errors.As(err, &locked) {
+			setRetryAfter(c, locked.RetryAfter)
+		}
+		utils.ErrorResponse(c, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	var recoveryCodes []string
+	var err error
+	if challenge.Enroll {
+		recoveryCodes, err = h.users.ConfirmTOTPEnrollment(challenge.Username, req.Code)
+	} else {
+		err = h.users.VerifySecondFactor(challenge.Username, req.Code)
+	}
+	if err != nil {
+		h.limiter.Failure(ip, challenge.Username)
+		h.challenges.Fail(token)
+		h.recordTwoFactor(c, challenge.Username, models.AuditOutcomeFailure, err.Error())
+		utils.ErrorResponse(c, "Invalid two-factor code", twoFactorErrorStatus(err))
+		return
+	}
+
+	h.challenges.Delete(token)
+	middleware.SetCookie(c, h.config, loginChallengeCookie, "", -1, true)
+	h.limiter.Success(challenge.Username)
+
+	user, err := h.users.Get(challenge.Username)
+	if err != nil {
+		utils.ErrorResponse(c, "User not found", http.StatusUnauthorized)
+		return
+	}
+	if err := h.startSession(c, user); err != nil {
+		utils.ErrorResponse(c, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	h.recordTwoFactor(c, user.Username, models.AuditOutcomeSuccess, "")
+
+	response := gin.H{
+		"success": true,
+		"message": "Login successful",
+		"user": gin.H{
+			"username": user.Username,
+			"role":     user.Role,
+		},
+	}
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// recordTwoFactor adds the second step of a login to the audit log
+func (h *LoginHandler) recordTwoFactor(c *gin.Context, username, outcome, message string) {
+	h.audit.Record(models.AuditEvent{
+		Username: username,
+		SourceIP: c.ClientIP(),
+		Action:   models.AuditActionLoginTwoFactor,
+		Outcome:  outcome,
+		Message:  message,
+	})
+}
+
+// TwoFactorHandler lets logged-in users manage their two-factor authentication
+type TwoFactorHandler struct {
+	users    *services.UserStore
+	sessions *services.SessionStore
+	audit    *services.AuditLog
+}
+
+// NewTwoFactorHandler creates a new two-factor handler instance
+func NewTwoFactorHandler(users *services.UserStore, sessions *services.SessionStore, audit *services.AuditLog) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		users:    users,
+		sessions: sessions,
+		audit:    audit,
+	}
+}
+
+// GetStatus handles GET /api/auth/2fa
+func (h *TwoFactorHandler) GetStatus(c *gin.Context) {
+	user, err := h.users.Get(middleware.CurrentUsername(c))
+	if err != nil {
+		utils.ErrorResponse(c, "User not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"success":             true,
+		"enabled":             user.TOTPEnabled,
+		"required":            h.users.TOTPRequired(user),
+		"recovery_codes_left": h.users.RecoveryCodesLeft(user.Username),
+	})
+}
+
+// Enroll handles POST /api/auth/2fa/enroll
+// Returns a new secret, its otpauth:// URI and that URI as a QR code; nothing changes until it is confirmed
+func (h *TwoFactorHandler) Enroll(c *gin.Context) {
+	secret, uri, err := h.users.BeginTOTPEnrollment(middleware.CurrentUsername(c))
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to start two-factor enrollment: "+err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"success":          true,
+		"message":          "Add the secret to your authenticator app and confirm with the code it shows",
+		"secret":           secret,
+		"provisioning_uri": uri,
+		"qr_code":          totpQRCode(uri),
+	})
+}
+
+// Confirm handles POST /api/auth/2fa/confirm
+// Enables two-factor authentication and returns the recovery codes, shown only once
+func (h *TwoFactorHandler) Confirm(c *gin.Context) {
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username := middleware.CurrentUsername(c)
+	codes, err := h.users.ConfirmTOTPEnrollment(username, req.Code)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to enable two-factor authentication: "+err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	h.record(c, username, "enabled")
+	utils.SuccessResponse(c, gin.H{
+		"success":        true,
+		"message":        "Two-factor authentication enabled, store the recovery codes somewhere safe",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable handles POST /api/auth/2fa/disable, which takes a current code
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username := middleware.CurrentUsername(c)
+	if user, err := h.users.Get(username); err == nil && h.users.TOTPRequired(user) {
+		utils.ErrorResponse(c, "Failed to disable two-factor authentication: "+services.ErrTOTPRequired.Error(), http.StatusForbidden)
+		return
+	}
+	if err := h.users.VerifySecondFactor(username, req.Code); err != nil {
+		utils.ErrorResponse(c, "Failed to disable two-factor authentication: "+err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+	if err := h.users.DisableTOTP(username, true); err != nil {
+		utils.ErrorResponse(c, "Failed to disable two-factor authentication: "+err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	h.record(c, username, "disabled")
+	utils.SuccessResponse(c, gin.H{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes handles POST /api/auth/2fa/recovery-codes, which takes a current code
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username := middleware.CurrentUsername(c)
+	if err := h.users.VerifySecondFactor(username, req.Code); err != nil {
+		utils.ErrorResponse(c, "Failed to regenerate recovery codes: "+err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+	codes, err := h.users.RegenerateRecoveryCodes(username)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to regenerate recovery codes: "+err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+
+	h.record(c, username, "recovery codes regenerated")
+	utils.SuccessResponse(c, gin.H{
+		"success":        true,
+		"message":        "Recovery codes regenerated, the old ones no longer work",
+		"recovery_codes": codes,
+	})
+}
+
+// GetPolicy handles GET /api/auth/2fa/policy
+func (h *TwoFactorHandler) GetPolicy(c *gin.Context) {
+	utils.SuccessResponse(c, gin.H{
+		"success":                true,
+		"require_for_privileged": h.users.TOTPRequiredByPolicy(),
+	})
+}
+
+// SetPolicy handles PUT /api/auth/2fa/policy
+// When required, admins and operators without two-factor authentication must enroll at their next login
+func (h *TwoFactorHandler) SetPolicy(c *gin.Context) {
+	var req struct {
+		RequireForPrivileged *bool `json:"require_for_privileged" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.users.SetTOTPRequiredByPolicy(*req.RequireForPrivileged); err != nil {
+		utils.ErrorResponse(c, "Failed to update two-factor policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if *req.RequireForPrivileged {
+		h.record(c, middleware.CurrentUsername(c), "required for admins and operators")
+	} else {
+		h.record(c, middleware.CurrentUsername(c), "no longer required")
+	}
+	utils.SuccessResponse(c, gin.H{
+		"success":                true,
+		"message":                "Two-factor policy updated",
+		"require_for_privileged": *req.RequireForPrivileged,
+	})
+}
+
+// ResetUser handles DELETE /api/users/{username}/2fa
+// Admins use it for users who lost their authenticator and recovery codes; the user is logged out
+func (h *TwoFactorHandler) ResetUser(c *gin.Context) {
+	username := c.Param("username")
+	if err := h.users.DisableTOTP(username, false); err != nil {
+		utils.ErrorResponse(c, "Failed to reset two-factor authentication: "+err.Error(), twoFactorErrorStatus(err))
+		return
+	}
+	if _, err := h.sessions.RevokeUser(username); err != nil {
+		log.Printf("Failed to revoke sessions of %s: %v", username, err)
+	}
+
+	h.record(c, username, "reset by "+middleware.CurrentUsername(c))
+	utils.SuccessResponse(c, gin.H{
+		"success":  true,
+		"message":  "Two-factor authentication reset",
+		"username": username,
+	})
+}
+
+// record adds a two-factor change to the audit log
+func (h *TwoFactorHandler) record(c *gin.Context, username, message string) {
+	h.audit.Record(models.AuditEvent{
+		Username: username,
+		SourceIP: c.ClientIP(),
+		Action:   models.AuditActionTwoFactor,
+		Outcome:  models.AuditOutcomeSuccess,
+		Message:  message,
+	})
+}
+
+// twoFactorErrorStatus maps two-factor errors to HTTP status codes
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidTOTPCode):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrTOTPNotLocal), errors.Is(err, services.ErrTOTPRequired):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrTOTPEnabled), errors.Is(err, services.ErrTOTPNotEnabled), errors.Is(err, services.ErrTOTPNotEnrolling):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+	"cfProxyHub/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserHandler handles user management HTTP requests
+type UserHandler struct {
+	users    *services.UserStore
+	sessions *services.SessionStore
+	tokens   *services.APITokenStore
+}
+
+// NewUserHandler creates a new user handler instance
+func NewUserHandler(users *services.UserStore, sessions *services.SessionStore, tokens *services.APITokenStore) *UserHandler {
+	return &UserHandler{
+		users:    users,
+		sessions: sessions,
+		tokens:   tokens,
+	}
+}
+
+// GetCurrentUser handles GET /api/users/me
+func (h *UserHandler) GetCurrentUser(c *gin.Context) {
+	user, err := h.users.Get(middleware.CurrentUsername(c))
+	if err != nil {
+		utils.ErrorResponse(c, "User not found", http.StatusNotFound)
+		return
+	}
+
+	response := models.UserResponse{
+		Success: true,
+		Message: "User retrieved successfully",
+		Data:    *user,
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// ListUsers handles GET /api/users
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	users := h.users.List()
+
+	response := models.UsersResponse{
+		Success: true,
+		Message: "Users retrieved successfully",
+		Data:    users,
+		Total:   len(users),
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// GetUser handles GET /api/users/{username}
+func (h *UserHandler) GetUser(c *gin.Context) {
+	user, err := h.users.Get(c.Param("username"))
+	if err != nil {
+		utils.ErrorResponse(c, "User not found", http.StatusNotFound)
+		return
+	}
+
+	response := models.UserResponse{
+		Success: true,
+		Message: "User retrieved successfully",
+		Data:    *user,
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// CreateUser handles POST /api/users
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req models.UserCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		utils.ErrorResponse(c, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.users.Create(req)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to create user: "+err.Error(), userErrorStatus(err))
+		return
+	}
+
+	log.Printf("User %s created user %s with role %s", middleware.CurrentUsername(c), user.Username, user.Role)
+	response := models.UserResponse{
+		Success: true,
+		Message: "User created successfully",
+		Data:    *user,
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// UpdateUser handles PUT /api/users/{username}
+// Changing the password or role logs the user out everywhere
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	username := c.Param("username")
+
+	var req models.UserUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		utils.ErrorResponse(c, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.users.Update(username, req)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to update user: "+err.Error(), userErrorStatus(err))
+		return
+	}
+	h.revokeSessions(username)
+
+	log.Printf("User %s updated user %s (role %s)", middleware.CurrentUsername(c), user.Username, user.Role)
+	response := models.UserResponse{
+		Success: true,
+		Message: "User updated successfully",
+		Data:    *user,
+	}
+	utils.SuccessResponse(c, response)
+}
+
+// DeleteUser handles DELETE /api/users/{username}
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	username := c.Param("username")
+
+	if err := h.users.Delete(username); err != nil {
+		utils.ErrorResponse(c, "Failed to delete user: "+err.Error(), userErrorStatus(err))
+		return
+	}
+	h.revokeSessions(username)
+	if _, err := h.tokens.RevokeUser(username); err != nil {
+		log.Printf("Failed to revoke API tokens of %s: %v", username, err)
+	}
+
+	log.Printf("User %s deleted user %s", middleware.CurrentUsername(c), username)
+	utils.SuccessResponse(c, gin.H{
+		"success":  true,
+		"message":  "User deleted successfully",
+		"username": username,
+	})
+}
+
+// revokeSessions logs a user out so changes to the account take effect immediately
+func (h *UserHandler) revokeSessions(username string) {
+	if _, err := h.sessions.RevokeUser(username); err != nil {
+		log.Printf("Failed to revoke sessions of %s: %v", username, err)
+	}
+}
+
+// userErrorStatus maps user store errors to HTTP status codes
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUserExists), errors.Is(err, services.ErrLastAdmin):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrPasswordNotLocal):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditBodyLimit caps how much of an error response is kept to extract its message
+const auditBodyLimit = 4096
+
+// auditSkipPaths are mutating endpoints not recorded by AuditMutations
+// Logins are recorded by their handlers with the attempted username, plans change nothing
+var auditSkipPaths = []string{
+	"/api/auth/login",
+	"/api/cloudflare/state/plan",
+}
+
+// auditWriter keeps the start of the response body so a failure's message can be recorded
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	if room := auditBodyLimit - w.body.Len(); room > 0 {
+		if len(data) < room {
+			room = len(data)
+		}
+		w.body.Write(data[:room])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// AuditMutations records every POST, PUT, PATCH and DELETE request to the API in the audit log
+// It runs before authentication, so requests rejected for missing credentials or permissions are recorded too
+func AuditMutations(audit *services.AuditLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auditedRequest(c.Request) {
+			c.Next()
+			return
+		}
+
+		writer := &auditWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		status := writer.Status()
+
+		event := models.AuditEvent{
+			Username: CurrentUsername(c),
+			SourceIP: c.ClientIP(),
+			Action:   c.Request.Method + " " + route,
+			Outcome:  auditOutcome(status),
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			Status:   status,
+		}
+		created, _ := c.Get("audit_targets")
+		createdIDs, _ := created.(map[string]string)
+		if len(c.Params)+len(createdIDs) > 0 {
+			event.Targets = make(map[string]string, len(c.Params)+len(createdIDs))
+			for _, param := range c.Params {
+				event.Targets[param.Key] = param.Value
+			}
+			for key, id := range createdIDs {
+				event.Targets[key] = id
+			}
+		}
+		if event.Outcome != models.AuditOutcomeSuccess {
+			event.Message = responseMessage(writer.body.Bytes())
+		}
+		event.Before, _ = c.Get("audit_before")
+		event.After, _ = c.Get("audit_after")
+
+		audit.Record(event)
+	}
+}
+
+// SetAuditChange attaches the state of the changed object before and after the request to its audit event
+func SetAuditChange(c *gin.Context, before, after interface{}) {
+	if before != nil {
+		c.Set("audit_before", before)
+	}
+	if after != nil {
+		c.Set("audit_after", after)
+	}
+}
+
+// SetAuditTarget adds the ID of an object the request created to its audit event
+func SetAuditTarget(c *gin.Context, key, id string) {
+	targets, _ := c.Get("audit_targets")
+	ids, ok := targets.(map[string]string)
+	if !ok {
+		ids = make(map[string]string)
+		c.Set("audit_targets", ids)
+	}
+	ids[key] = id
+}
+
+// auditedRequest reports whether a request mutates state through the API
+func auditedRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return false
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		return false
+	}
+	for _, path := range auditSkipPaths {
+		if r.URL.Path == path || strings.HasPrefix(r.URL.Path, path+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// auditOutcome classifies a response status
+func auditOutcome(status int) string {
+	switch {
+	case status >= 200 && status < 300:
+		return models.AuditOutcomeSuccess
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return models.AuditOutcomeDenied
+	default:
+		return models.AuditOutcomeFailure
+	}
+}
+
+// responseMessage extracts the message of a JSON error response
+func responseMessage(body []byte) string {
+	var response struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return ""
+	}
+	if response.Message != "" {
+		return response.Message
+	}
+	return response.Error
+}
@@ -1,33 +1,63 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+
 	"github.com/gin-gonic/gin"
 )
 
+// Authentication methods recorded in the request context
+const (
+	AuthMethodSession  = "session"
+	AuthMethodAPIToken = "api_token"
+	AuthMethodCFAccess = "cf_access"
+)
+
+// Authenticator holds the stores requests are authenticated against
+type Authenticator struct {
+	Sessions *services.SessionStore
+	Users    *services.UserStore
+	Tokens   *services.APITokenStore
+
+	// OIDC is the single sign-on provider logins can go through, nil when not configured
+	OIDC *services.OIDCProvider
+
+	// Access verifies Cloudflare Access JWTs, nil when not configured
+	// When set it replaces the session cookie check
+	Access *services.CFAccessVerifier
+
+	// Limiter throttles password logins, Audit records authentication events
+	Limiter *services.LoginLimiter
+	Audit   *services.AuditLog
+
+	// Challenges holds password logins waiting for their two-factor code
+	Challenges *services.LoginChallengeStore
+}
+
 // AuthMiddleware checks if the user is authenticated
 // If not authenticated, redirects to /login page
-// Authentication is based on session tokens validated against tokens created during login
-// Login credentials are verified against ADMIN_USERNAME and ADMIN_PASSWORD from .env
-func AuthMiddleware() gin.HandlerFunc {
+// Authentication is based on session tokens issued by the session store during login
+// Login credentials are verified against the user store, seeded from ADMIN_USERNAME and ADMIN_PASSWORD
+// With Cloudflare Access enabled the Access JWT header is checked instead, and there is no login page
+func (a *Authenticator) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Check if user is authenticated
-		// This can be done by checking session, JWT token, or any other auth method
-
-		// Example: Check for session cookie or token
-		session, err := c.Cookie("session_token")
-		if err != nil || session == "" {
-			// No session found, redirect to login
-			c.Redirect(http.StatusFound, "/login")
-			c.Abort()
+		if a.Access != nil {
+			if !a.authenticateCFAccess(c) {
+				c.String(http.StatusUnauthorized, "Cloudflare Access authentication required")
+				c.Abort()
+				return
+			}
+			c.Next()
 			return
 		}
 
-		// Validate the session token (you would implement this based on your auth system)
-		if !isValidSession(session) {
-			// Invalid session, redirect to login
+		if !a.authenticateSession(c) {
+			// No or invalid session, redirect to login
 			c.Redirect(http.StatusFound, "/login")
 			c.Abort()
 			return
@@ -38,25 +68,14 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-// isValidSession validates the session token
-func isValidSession(sessionToken string) bool {
-	// Basic validation: check if token is not empty and follows expected format
-	if sessionToken == "" {
-		return false
-	}
-
-	// For demo purposes, we'll accept tokens that contain an underscore
-	// (matching the format from generateSessionToken in auth handler)
-	// In production, implement proper token validation
-	return len(sessionToken) > 10 && strings.Contains(sessionToken, "_")
-}
-
 // RequireAuth is an alternative middleware that checks for authentication
 // and returns JSON error for API endpoints
-func RequireAuth() gin.HandlerFunc {
+// Besides the session cookie it accepts personal API tokens as Authorization: Bearer
+// With Cloudflare Access enabled the Access JWT header replaces the session cookie
+// State-changing requests authenticated by a cookie must carry the CSRF token
+func (a *Authenticator) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		session, err := c.Cookie("session_token")
-		if err != nil || session == "" || !isValidSession(session) {
+		if !a.authenticateUser(c) && !a.authenticateAPIToken(c) {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error":   "Unauthorized",
 				"message": "Authentication required",
@@ -64,6 +83,179 @@ func RequireAuth() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if !checkCSRF(c) {
+			return
+		}
 		c.Next()
 	}
 }
+
+// authenticateUser authenticates an interactive user, by Cloudflare Access if enabled or else by session
+func (a *Authenticator) authenticateUser(c *gin.Context) bool {
+	if a.Access != nil {
+		return a.authenticateCFAccess(c)
+	}
+	return a.authenticateSession(c)
+}
+
+// authenticateCFAccess checks the JWT Cloudflare Access puts in front of every request
+// The user is created on first sight and follows the role mapped from their email
+func (a *Authenticator) authenticateCFAccess(c *gin.Context) bool {
+	assertion := c.GetHeader("Cf-Access-Jwt-Assertion")
+	if assertion == "" {
+		return false
+	}
+
+	identity, err := a.Access.Verify(c.Request.Context(), assertion)
+	if err != nil {
+		log.Printf("Rejected Cloudflare Access token: %v", err)
+		return false
+	}
+	user, err := a.Users.Provision(identity.Email, identity.Role, services.CFAccessProvider)
+	if err != nil {
+		log.Printf("Rejected Cloudflare Access user %s: %v", identity.Email, err)
+		return false
+	}
+
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("auth_method", AuthMethodCFAccess)
+	return true
+}
+
+// authenticateSession looks up the session of the request's session cookie
+func (a *Authenticator) authenticateSession(c *gin.Context) bool {
+	token, err := c.Cookie("session_token")
+	if err != nil || token == "" {
+		return false
+	}
+
+	session, err := a.Sessions.Validate(token)
+	if err != nil {
+		return false
+	}
+
+	c.Set("username", session.Username)
+	c.Set("role", session.Role)
+	c.Set("auth_method", AuthMethodSession)
+	return true
+}
+
+// authenticateAPIToken checks a bearer token
+// The token acts with the current role of its owner, so demoting or deleting a user takes effect immediately
+func (a *Authenticator) authenticateAPIToken(c *gin.Context) bool {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return false
+	}
+
+	token, err := a.Tokens.Authenticate(strings.TrimSpace(header[7:]))
+	if err != nil {
+		return false
+	}
+	user, err := a.Users.Get(token.Username)
+	if err != nil {
+		return false
+	}
+
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("auth_method", AuthMethodAPIToken)
+	c.Set("api_token", *token)
+	return true
+}
+
+// RequireRole only lets users through whose role includes the required role
+// It must run after RequireAuth, which puts the role of the session into the context
+func RequireRole(required models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkRole(c, required) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope rejects API token requests whose token lacks the scope
+// Session requests are only limited by their role
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkScope(c, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// Require combines RequireRole and RequireScope for routes that need both
+func Require(role models.Role, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkRole(c, role) || !checkScope(c, scope) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkRole aborts the request unless its role includes the required role
+func checkRole(c *gin.Context, required models.Role) bool {
+	if CurrentRole(c).Includes(required) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Forbidden",
+		"message": "This action requires the " + string(required) + " role",
+	})
+	c.Abort()
+	return false
+}
+
+// checkScope aborts API token requests whose token lacks the scope
+func checkScope(c *gin.Context, scope string) bool {
+	if token, ok := CurrentAPIToken(c); !ok || token.HasScope(scope) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Forbidden",
+		"message": "This action requires an API token with the " + scope + " scope",
+	})
+	c.Abort()
+	return false
+}
+
+// RequireSession rejects requests authenticated with an API token
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") == AuthMethodAPIToken {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "This action requires logging in",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUsername returns the username of the authenticated request
+func CurrentUsername(c *gin.Context) string {
+	return c.GetString("username")
+}
+
+// CurrentRole returns the role of the authenticated request
+func CurrentRole(c *gin.Context) models.Role {
+	role, _ := c.Get("role")
+	r, _ := role.(models.Role)
+	return r
+}
+
+// CurrentAPIToken returns the API token the request was authenticated with, if any
+func CurrentAPIToken(c *gin.Context) (models.APIToken, bool) {
+	value, ok := c.Get("api_token")
+	if !ok {
+		return models.APIToken{}, false
+	}
+	token, ok := value.(models.APIToken)
+	return token, ok
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS answers cross-origin requests from the allowed origins only
+// Without allowed origins no CORS headers are sent, so browsers keep the API same-origin
+// A "*" entry allows any origin, but then without credentials
+func CORS(allowedOrigins []string) gin.HandlerFunc {
+	allowAny := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAny = true
+			continue
+		}
+		allowed[strings.TrimRight(origin, "/")] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || len(allowedOrigins) == 0 {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		switch {
+		case allowed[origin]:
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+		case allowAny:
+			header.Set("Access-Control-Allow-Origin", "*")
+		default:
+			// Not allowed: answer without CORS headers and let the browser block the response
+			c.Next()
+			return
+		}
+
+		// Clients read the configuration version from the ETag to send it back in If-Match
+		header.Set("Access-Control-Expose-Headers", "ETag")
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, "+CSRFHeaderName)
+			header.Set("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strings"
+
+	"cfProxyHub/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CSRF double-submit token: the cookie is readable by the page's scripts, which echo it in the header
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// contentSecurityPolicy allows the page's own assets, its inline scripts and the CDNs the templates use
+const contentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net https://cdn.datatables.net; " +
+	"style-src 'self' 'unsafe-inline' https://cdn.datatables.net; " +
+	"img-src 'self' data:; font-src 'self' data:; connect-src 'self'; " +
+	"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+// IsHTTPS reports whether the request arrived over HTTPS, directly or through a proxy setting X-Forwarded-Proto
+func IsHTTPS(c *gin.Context) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+	proto, _, _ := strings.Cut(c.GetHeader("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// secureCookies decides the Secure attribute from COOKIE_SECURE
+func secureCookies(c *gin.Context, cfg *config.Config) bool {
+	switch cfg.CookieSecure {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return IsHTTPS(c)
+}
+
+// SetCookie sets a cookie with the configured Secure and SameSite attributes
+func SetCookie(c *gin.Context, cfg *config.Config, name, value string, maxAge int, httpOnly bool) {
+	sameSite := http.SameSiteLaxMode
+	if cfg.CookieSameSite == "strict" {
+		sameSite = http.SameSiteStrictMode
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(name, value, maxAge, "/", "", secureCookies(c, cfg), httpOnly)
+}
+
+// SetLaxCookie sets a cookie that must survive a cross-site redirect back to the server, such as a login callback
+func SetLaxCookie(c *gin.Context, cfg *config.Config, name, value string, maxAge int, path string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, path, "", secureCookies(c, cfg), true)
+}
+
+// CSRFCookie hands every browser a CSRF token cookie if it doesn't have one yet
+func CSRFCookie(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, err := c.Cookie(CSRFCookieName); err != nil || token == "" {
+			raw := make([]byte, 32)
+			if _, err := rand.Read(raw); err != nil {
+				log.Printf("Failed to generate CSRF token: %v", err)
+			} else {
+				SetCookie(c, cfg, CSRFCookieName, base64.RawURLEncoding.EncodeToString(raw), 0, false)
+			}
+		}
+		c.Next()
+	}
+}
+
+// checkCSRF aborts state-changing requests authenticated by a cookie unless they echo the CSRF cookie in the header
+// API token requests can't be forged by another site and are exempt
+func checkCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if c.GetString("auth_method") == AuthMethodAPIToken {
+		return true
+	}
+
+	cookie, err := c.Cookie(CSRFCookieName)
+	header := c.GetHeader(CSRFHeaderName)
+	if err == nil && cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1 {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Forbidden",
+		"message": "Missing or invalid CSRF token",
+	})
+	c.Abort()
+	return false
+}
+
+// SecurityHeaders sets the headers protecting HTML pages against framing, MIME sniffing and injected content
+func SecurityHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		header.Set("Content-Security-Policy", contentSecurityPolicy)
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "same-origin")
+		c.Next()
+	}
+}
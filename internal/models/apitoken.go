@@ -0,0 +1,132 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// API token scopes
+// A token never grants more than the role of the user owning it; scopes narrow it further
+const (
+	ScopeAccountsRead   = "accounts:read"
+	ScopeZonesRead      = "zones:read"
+	ScopeZonesWrite     = "zones:write"
+	ScopeDNSRead        = "dns:read"
+	ScopeDNSWrite       = "dns:write"
+	ScopeTunnelsRead    = "tunnels:read"
+	ScopeTunnelsWrite   = "tunnels:write"
+	ScopeHostnamesRead  = "hostnames:read"
+	ScopeHostnamesWrite = "hostnames:write"
+	ScopeStateRead      = "state:read"
+	ScopeStateWrite     = "state:write"
+	ScopeDockerRead     = "docker:read"
+	ScopeDockerWrite    = "docker:write"
+	ScopeUsersRead      = "users:read"
+	ScopeUsersWrite     = "users:write"
+	ScopeAuditRead      = "audit:read"
+)
+
+// APITokenScopes lists every scope a token can be given
+var APITokenScopes = []string{
+	ScopeAccountsRead,
+	ScopeZonesRead, ScopeZonesWrite,
+	ScopeDNSRead, ScopeDNSWrite,
+	ScopeTunnelsRead, ScopeTunnelsWrite,
+	ScopeHostnamesRead, ScopeHostnamesWrite,
+	ScopeStateRead, ScopeStateWrite,
+	ScopeDockerRead, ScopeDockerWrite,
+	ScopeUsersRead, ScopeUsersWrite,
+	ScopeAuditRead,
+}
+
+const (
+	// DefaultAPITokenLifetimeDays is used when a token is created without a lifetime
+	DefaultAPITokenLifetimeDays = 90
+	// MaxAPITokenLifetimeDays is the longest lifetime a token can be created with
+	MaxAPITokenLifetimeDays = 365
+)
+
+// APIToken is a personal API token as returned by the API, without its secret
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// HasScope reports whether the token was given a scope
+func (t APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenCreateRequest is the body of the token creation endpoint
+type APITokenCreateRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+// Validate normalises and checks a token creation request
+func (r *APITokenCreateRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > 100 {
+		return fmt.Errorf("name must be 1-100 characters")
+	}
+	if len(r.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+
+	seen := make(map[string]bool)
+	scopes := make([]string, 0, len(r.Scopes))
+	for _, scope := range r.Scopes {
+		if !validScope(scope) {
+			return fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(APITokenScopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	r.Scopes = scopes
+
+	if r.ExpiresInDays == 0 {
+		r.ExpiresInDays = DefaultAPITokenLifetimeDays
+	}
+	if r.ExpiresInDays < 1 || r.ExpiresInDays > MaxAPITokenLifetimeDays {
+		return fmt.Errorf("expires_in_days must be between 1 and %d", MaxAPITokenLifetimeDays)
+	}
+	return nil
+}
+
+func validScope(scope string) bool {
+	for _, s := range APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenCreateResponse carries the secret of a new token, which is only ever shown once
+type APITokenCreateResponse struct {
+	Success bool     `json:"success"`
+	Message string   `json:"message"`
+	Token   string   `json:"token"`
+	Data    APIToken `json:"data"`
+}
+
+type APITokensResponse struct {
+	Success bool       `json:"success"`
+	Message string     `json:"message"`
+	Data    []APIToken `json:"data"`
+	Total   int        `json:"total"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Audit outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeDenied  = "denied"
+)
+
+// Audit actions
+const (
+	AuditActionLogin          = "auth.login"
+	AuditActionLoginTwoFactor = "auth.login_2fa"
+	AuditActionTwoFactor      = "auth.2fa"
+)
+
+// AuditEvent records who did what, from where and whether it worked
+type AuditEvent struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Username string    `json:"username,omitempty"`
+	SourceIP string    `json:"source_ip,omitempty"`
+	Action   string    `json:"action"`
+	Outcome  string    `json:"outcome"`
+	Message  string    `json:"message,omitempty"`
+
+	// Set on API requests: the route pattern, the concrete path and the response status
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Status int    `json:"status,omitempty"`
+	// Targets holds the IDs the request acted on, keyed by route parameter (accountId, zone_id, ...)
+	Targets map[string]string `json:"targets,omitempty"`
+	// Before and After capture the changed object where the handler provides it, e.g. a tunnel's ingress rules
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// AuditFilter narrows an audit query, zero values match everything
+type AuditFilter struct {
+	Username string
+	// Action matches events whose action contains it, case-insensitively
+	Action  string
+	Outcome string
+	// Target matches events with any target ID equal to it
+	Target string
+	Since  time.Time
+	Until  time.Time
+	// Limit keeps the most recent matching events
+	Limit int
+}
+
+// AuditEventsResponse is the response of the audit query endpoint
+type AuditEventsResponse struct {
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Data    []AuditEvent `json:"data"`
+	Total   int          `json:"total"`
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+)
+
+// DNS record types that can be managed through the API
+const (
+	DNSRecordTypeA     = "A"
+	DNSRecordTypeAAAA  = "AAAA"
+	DNSRecordTypeCNAME = "CNAME"
+	DNSRecordTypeTXT   = "TXT"
+	DNSRecordTypeMX    = "MX"
+	DNSRecordTypeSRV   = "SRV"
+	DNSRecordTypeCAA   = "CAA"
+)
+
+// SupportedDNSRecordTypes lists the record types accepted by DNSRecordInput
+var SupportedDNSRecordTypes = []string{
+	DNSRecordTypeA, DNSRecordTypeAAAA, DNSRecordTypeCNAME, DNSRecordTypeTXT,
+	DNSRecordTypeMX, DNSRecordTypeSRV, DNSRecordTypeCAA,
+}
+
+// ResultInfo describes the page of a paginated listing
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
+}
+
+// DNSRecordFilter selects the DNS records of a zone to list
+type DNSRecordFilter struct {
+	Type      string
+	Name      string
+	Content   string
+	Search    string
+	Proxied   *bool
+	Page      int
+	PerPage   int
+	Order     string
+	Direction string
+}
+
+// DNSRecordInput is the body of the DNS record create and update endpoints
+type DNSRecordInput struct {
+	Type     string         `json:"type"`
+	Name     string         `json:"name"`
+	Content  string         `json:"content,omitempty"`
+	TTL      int            `json:"ttl,omitempty"` // 1 = automatic
+	Proxied  bool           `json:"proxied,omitempty"`
+	Priority *int           `json:"priority,omitempty"`
+	Comment  string         `json:"comment,omitempty"`
+	Tags     []string       `json:"tags,omitempty"`
+	Data     *DNSRecordData `json:"data,omitempty"`
+}
+
+// DNSRecordData holds the structured content of SRV and CAA records
+type DNSRecordData struct {
+	// SRV
+	Weight int    `json:"weight,omitempty"`
+	Port   int    `json:"port,omitempty"`
+	Target string `json:"target,omitempty"`
+
+	// CAA
+	Flags int    `json:"flags,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+var (
+	dnsHostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9_*]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9_]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9])?\.?$`)
+	srvNamePattern     = regexp.MustCompile(`^_[a-zA-Z0-9-]+\._(tcp|udp|tls|sctp)(\..+)?$`)
+	dnsTagPattern      = regexp.MustCompile(`^[a-zA-Z0-9_.-]+:.*$`)
+)
+
+// Validate normalises the record type and checks the fields required by it
+func (r *DNSRecordInput) Validate() error {
+	r.Type = strings.ToUpper(strings.TrimSpace(r.Type))
+	r.Name = strings.TrimSpace(r.Name)
+	r.Content = strings.TrimSpace(r.Content)
+
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.TTL == 0 {
+		r.TTL = 1
+	}
+	if r.TTL != 1 && (r.TTL < 30 || r.TTL > 86400) {
+		return fmt.Errorf("ttl must be 1 (automatic) or between 30 and 86400 seconds")
+	}
+	if r.Proxied && r.Type != DNSRecordTypeA && r.Type != DNSRecordTypeAAAA && r.Type != DNSRecordTypeCNAME {
+		return fmt.Errorf("only A, AAAA and CNAME records can be proxied")
+	}
+	if r.Proxied && r.TTL != 1 {
+		return fmt.Errorf("proxied records must use automatic ttl (1)")
+	}
+	for _, tag := range r.Tags {
+		if !dnsTagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q: expected name:value", tag)
+		}
+	}
+
+	switch r.Type {
+	case DNSRecordTypeA:
+		if ip := net.ParseIP(r.Content); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("A record content must be an IPv4 address")
+		}
+	case DNSRecordTypeAAAA:
+		if ip := net.ParseIP(r.Content); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("AAAA record content must be an IPv6 address")
+		}
+	case DNSRecordTypeCNAME:
+		if !dnsHostnamePattern.MatchString(r.Content) {
+			return fmt.Errorf("CNAME record content must be a hostname")
+		}
+	case DNSRecordTypeTXT:
+		if r.Content == "" {
+			return fmt.Errorf("TXT record content is required")
+		}
+		if len(r.Content) > 2048 {
+			return fmt.Errorf("TXT record content must not exceed 2048 characters")
+		}
+	case DNSRecordTypeMX:
+		if !dnsHostnamePattern.MatchString(r.Content) {
+			return fmt.Errorf("MX record content must be a mail server hostname")
+		}
+		if err := validateDNSPriority(r.Priority); err != nil {
+			return err
+		}
+	case DNSRecordTypeSRV:
+		if !srvNamePattern.MatchString(r.Name) {
+			return fmt.Errorf("SRV record name must look like _service._proto[.name]")
+		}
+		if err := validateDNSPriority(r.Priority); err != nil {
+			return err
+		}
+		if r.Data == nil {
+			return fmt.Errorf("SRV record requires data with weight, port and target")
+		}
+		if r.Data.Weight < 0 || r.Data.Weight > 65535 {
+			return fmt.Errorf("SRV weight must be between 0 and 65535")
+		}
+		if r.Data.Port < 0 || r.Data.Port > 65535 {
+			return fmt.Errorf("SRV port must be between 0 and 65535")
+		}
+		if r.Data.Target != "." && !dnsHostnamePattern.MatchString(r.Data.Target) {
+			return fmt.Errorf("SRV target must be a hostname")
+		}
+	case DNSRecordTypeCAA:
+		if r.Data == nil {
+			return fmt.Errorf("CAA record requires data with flags, tag and value")
+		}
+		if r.Data.Flags < 0 || r.Data.Flags > 255 {
+			return fmt.Errorf("CAA flags must be between 0 and 255")
+		}
+		switch r.Data.Tag {
+		case "issue", "issuewild", "iodef":
+		default:
+			return fmt.Errorf("CAA tag must be issue, issuewild or iodef")
+		}
+		if strings.TrimSpace(r.Data.Value) == "" {
+			return fmt.Errorf("CAA value is required")
+		}
+	case "":
+		return fmt.Errorf("type is required")
+	default:
+		return fmt.Errorf("unsupported record type %s, expected one of %s", r.Type, strings.Join(SupportedDNSRecordTypes, ", "))
+	}
+
+	return nil
+}
+
+// validateDNSPriority checks the priority of MX and SRV records
+func validateDNSPriority(priority *int) error {
+	if priority == nil {
+		return fmt.Errorf("priority is required")
+	}
+	if *priority < 0 || *priority > 65535 {
+		return fmt.Errorf("priority must be between 0 and 65535")
+	}
+	return nil
+}
+
+// data returns the structured content sent for SRV and CAA records
+func (r DNSRecordInput) data() map[string]interface{} {
+	switch r.Type {
+	case DNSRecordTypeSRV:
+		return map[string]interface{}{
+			"priority": *r.Priority,
+			"weight":   r.Data.Weight,
+			"port":     r.Data.Port,
+			"target":   r.Data.Target,
+		}
+	case DNSRecordTypeCAA:
+		return map[string]interface{}{
+			"flags": r.Data.Flags,
+			"tag":   r.Data.Tag,
+			"value": r.Data.Value,
+		}
+	}
+	return nil
+}
+
+// ToNewParams converts a validated record to the record creation parameters
+func (r DNSRecordInput) ToNewParams() DNSRecordCreateRequest {
+	body := dns.RecordNewParamsBody{
+		Type:    cloudflare.F(dns.RecordNewParamsBodyType(r.Type)),
+		Name:    cloudflare.F(r.Name),
+		TTL:     cloudflare.F(dns.TTL(r.TTL)),
+		Proxied: cloudflare.F(r.Proxied),
+		Comment: cloudflare.F(r.Comment),
+		Tags:    cloudflare.F[interface{}](r.tags()),
+	}
+	if data := r.data(); data != nil {
+		body.Data = cloudflare.F[interface{}](data)
+	} else {
+		body.Content = cloudflare.F(r.Content)
+	}
+	if r.Priority != nil {
+		body.Priority = cloudflare.F(float64(*r.Priority))
+	}
+	return dns.RecordNewParams{Body: body}
+}
+
+// ToUpdateParams converts a validated record to the parameters overwriting an existing record
+func (r DNSRecordInput) ToUpdateParams() DNSRecordUpdateRequest {
+	body := dns.RecordUpdateParamsBody{
+		Type:    cloudflare.F(dns.RecordUpdateParamsBodyType(r.Type)),
+		Name:    cloudflare.F(r.Name),
+		TTL:     cloudflare.F(dns.TTL(r.TTL)),
+		Proxied: cloudflare.F(r.Proxied),
+		Comment: cloudflare.F(r.Comment),
+		Tags:    cloudflare.F[interface{}](r.tags()),
+	}
+	if data := r.data(); data != nil {
+		body.Data = cloudflare.F[interface{}](data)
+	} else {
+		body.Content = cloudflare.F(r.Content)
+	}
+	if r.Priority != nil {
+		body.Priority = cloudflare.F(float64(*r.Priority))
+	}
+	return dns.RecordUpdateParams{Body: body}
+}
+
+// tags returns the record tags, never nil so an update clears removed tags
+func (r DNSRecordInput) tags() []string {
+	if r.Tags == nil {
+		return []string{}
+	}
+	return r.Tags
+}
@@ -0,0 +1,334 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+	"github.com/cloudflare/cloudflare-go/v4/zero_trust"
+)
+
+// DesiredState is the declarative document describing tunnels, ingress and DNS records
+// It can be written as YAML or JSON and kept in version control
+type DesiredState struct {
+	Accounts []DesiredAccount `json:"accounts" yaml:"accounts"`
+}
+
+// DesiredAccount lists the tunnels and extra DNS records managed in one account
+type DesiredAccount struct {
+	ID      string          `json:"id" yaml:"id"`
+	Tunnels []DesiredTunnel `json:"tunnels,omitempty" yaml:"tunnels,omitempty"`
+	Zones   []DesiredZone   `json:"zones,omitempty" yaml:"zones,omitempty"`
+}
+
+// DesiredTunnel describes the complete ingress of a tunnel, identified by ID or name
+// Ingress rules not listed here are removed from the tunnel on apply
+type DesiredTunnel struct {
+	ID       string        `json:"id,omitempty" yaml:"id,omitempty"`
+	Name     string        `json:"name,omitempty" yaml:"name,omitempty"`
+	Ingress  []IngressRule `json:"ingress" yaml:"ingress"`
+	CatchAll string        `json:"catch_all,omitempty" yaml:"catch_all,omitempty"`
+}
+
+// IngressRule is a public hostname of a tunnel
+type IngressRule struct {
+	Hostname      string               `json:"hostname" yaml:"hostname"`
+	Path          string               `json:"path,omitempty" yaml:"path,omitempty"`
+	Service       string               `json:"service" yaml:"service"`
+	OriginRequest *OriginRequestConfig `json:"originRequest,omitempty" yaml:"originRequest,omitempty"`
+	// SkipDNS disables the automatic CNAME record for this hostname
+	SkipDNS bool `json:"skip_dns,omitempty" yaml:"skip_dns,omitempty"`
+}
+
+// OriginRequestConfig holds the per-rule origin request options understood by cloudflared
+// Timeouts are in seconds
+type OriginRequestConfig struct {
+	ConnectTimeout         int64                `json:"connectTimeout,omitempty" yaml:"connectTimeout,omitempty"`
+	TLSTimeout             int64                `json:"tlsTimeout,omitempty" yaml:"tlsTimeout,omitempty"`
+	TCPKeepAlive           int64                `json:"tcpKeepAlive,omitempty" yaml:"tcpKeepAlive,omitempty"`
+	NoHappyEyeballs        bool                 `json:"noHappyEyeballs,omitempty" yaml:"noHappyEyeballs,omitempty"`
+	KeepAliveConnections   int64                `json:"keepAliveConnections,omitempty" yaml:"keepAliveConnections,omitempty"`
+	KeepAliveTimeout       int64                `json:"keepAliveTimeout,omitempty" yaml:"keepAliveTimeout,omitempty"`
+	HTTPHostHeader         string               `json:"httpHostHeader,omitempty" yaml:"httpHostHeader,omitempty"`
+	OriginServerName       string               `json:"originServerName,omitempty" yaml:"originServerName,omitempty"`
+	CAPool                 string               `json:"caPool,omitempty" yaml:"caPool,omitempty"`
+	NoTLSVerify            bool                 `json:"noTLSVerify,omitempty" yaml:"noTLSVerify,omitempty"`
+	DisableChunkedEncoding bool                 `json:"disableChunkedEncoding,omitempty" yaml:"disableChunkedEncoding,omitempty"`
+	HTTP2Origin            bool                 `json:"http2Origin,omitempty" yaml:"http2Origin,omitempty"`
+	ProxyType              string               `json:"proxyType,omitempty" yaml:"proxyType,omitempty"`
+	BastionMode            bool                 `json:"bastionMode,omitempty" yaml:"bastionMode,omitempty"`
+	Access                 *OriginRequestAccess `json:"access,omitempty" yaml:"access,omitempty"`
+}
+
+// OriginRequestAccess enforces Cloudflare Access on the origin
+type OriginRequestAccess struct {
+	Required bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	TeamName string   `json:"teamName" yaml:"teamName"`
+	AUDTag   []string `json:"audTag" yaml:"audTag"`
+}
+
+// DesiredZone lists extra DNS records of a zone, identified by ID or name
+// With Prune set, records of the zone that are neither listed nor tunnel CNAMEs are deleted on apply
+type DesiredZone struct {
+	ID         string             `json:"id,omitempty" yaml:"id,omitempty"`
+	Name       string             `json:"name,omitempty" yaml:"name,omitempty"`
+	Prune      bool               `json:"prune,omitempty" yaml:"prune,omitempty"`
+	DNSRecords []DesiredDNSRecord `json:"dns_records" yaml:"dns_records"`
+}
+
+// DesiredDNSRecord is a DNS record that isn't derived from tunnel ingress
+type DesiredDNSRecord struct {
+	Type     string  `json:"type" yaml:"type"`
+	Name     string  `json:"name" yaml:"name"`
+	Content  string  `json:"content" yaml:"content"`
+	TTL      float64 `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Proxied  bool    `json:"proxied,omitempty" yaml:"proxied,omitempty"`
+	Priority float64 `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Comment  string  `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// Plan change actions
+const (
+	PlanActionCreate = "create"
+	PlanActionUpdate = "update"
+	PlanActionDelete = "delete"
+)
+
+// Plan change kinds
+const (
+	PlanKindIngress   = "ingress"
+	PlanKindDNSRecord = "dns_record"
+)
+
+// StatePlan lists the changes needed to reach a desired state
+// The fingerprint identifies the changes, an apply only runs if planning again yields the same one
+type StatePlan struct {
+	Changes     []PlanChange `json:"changes"`
+	Summary     PlanSummary  `json:"summary"`
+	Fingerprint string       `json:"fingerprint"`
+}
+
+// PlanSummary counts the changes of a plan by action
+type PlanSummary struct {
+	Create int `json:"create"`
+	Update int `json:"update"`
+	Delete int `json:"delete"`
+}
+
+// PlanChange is a single create/update/delete of an ingress rule or DNS record
+type PlanChange struct {
+	Action    string      `json:"action"`
+	Kind      string      `json:"kind"`
+	AccountID string      `json:"account_id"`
+	TunnelID  string      `json:"tunnel_id,omitempty"`
+	ZoneID    string      `json:"zone_id,omitempty"`
+	RecordID  string      `json:"record_id,omitempty"`
+	Key       string      `json:"key"`
+	Before    interface{} `json:"before,omitempty"`
+	After     interface{} `json:"after,omitempty"`
+}
+
+// StateApplyResult reports the outcome of every change of an applied plan
+type StateApplyResult struct {
+	Plan    StatePlan           `json:"plan"`
+	Results []PlanChangeOutcome `json:"results"`
+	Failed  int                 `json:"failed"`
+}
+
+// PlanChangeOutcome is the result of applying one change
+type PlanChangeOutcome struct {
+	Change  PlanChange `json:"change"`
+	Success bool       `json:"success"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// Add records a change and updates the summary
+func (p *StatePlan) Add(change PlanChange) {
+	p.Changes = append(p.Changes, change)
+	switch change.Action {
+	case PlanActionCreate:
+		p.Summary.Create++
+	case PlanActionUpdate:
+		p.Summary.Update++
+	case PlanActionDelete:
+		p.Summary.Delete++
+	}
+}
+
+// ToParam converts an ingress rule to the tunnel configuration update parameter
+func (r IngressRule) ToParam() PublicHostnameIngressParam {
+	if r.OriginRequest == nil {
+		return NewPublicHostnameIngressParam(r.Hostname, r.Service, r.Path)
+	}
+	return NewPublicHostnameIngressParamWithOriginRequest(r.Hostname, r.Service, r.Path, r.OriginRequest.ToParam())
+}
+
+// ToRule converts an ingress rule to a rule ready to be written, including options the SDK doesn't model
+func (r IngressRule) ToRule() PublicHostnameRule {
+	rule := NewPublicHostnameRule(r.ToParam())
+	if r.OriginRequest != nil {
+		rule.Extra = r.OriginRequest.ExtraFields()
+	}
+	return rule
+}
+
+// ExtraFields returns the raw JSON of origin request options the SDK doesn't model,
+// keyed by sjson path relative to the ingress rule
+func (o OriginRequestConfig) ExtraFields() map[string]json.RawMessage {
+	extra := make(map[string]json.RawMessage)
+	if o.BastionMode {
+		extra["originRequest.bastionMode"] = json.RawMessage("true")
+	}
+	return extra
+}
+
+// ToParam converts origin request options to the tunnel configuration update parameter
+// Only options that are set are sent, so cloudflared keeps its defaults for the rest
+func (o OriginRequestConfig) ToParam() zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequest {
+	param := zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequest{}
+	if o.ConnectTimeout != 0 {
+		param.ConnectTimeout = cloudflare.F(o.ConnectTimeout)
+	}
+	if o.TLSTimeout != 0 {
+		param.TLSTimeout = cloudflare.F(o.TLSTimeout)
+	}
+	if o.TCPKeepAlive != 0 {
+		param.TCPKeepAlive = cloudflare.F(o.TCPKeepAlive)
+	}
+	if o.NoHappyEyeballs {
+		param.NoHappyEyeballs = cloudflare.F(true)
+	}
+	if o.KeepAliveConnections != 0 {
+		param.KeepAliveConnections = cloudflare.F(o.KeepAliveConnections)
+	}
+	if o.KeepAliveTimeout != 0 {
+		param.KeepAliveTimeout = cloudflare.F(o.KeepAliveTimeout)
+	}
+	if o.HTTPHostHeader != "" {
+		param.HTTPHostHeader = cloudflare.F(o.HTTPHostHeader)
+	}
+	if o.OriginServerName != "" {
+		param.OriginServerName = cloudflare.F(o.OriginServerName)
+	}
+	if o.CAPool != "" {
+		param.CAPool = cloudflare.F(o.CAPool)
+	}
+	if o.NoTLSVerify {
+		param.NoTLSVerify = cloudflare.F(true)
+	}
+	if o.DisableChunkedEncoding {
+		param.DisableChunkedEncoding = cloudflare.F(true)
+	}
+	if o.HTTP2Origin {
+		param.HTTP2Origin = cloudflare.F(true)
+	}
+	if o.ProxyType != "" {
+		param.ProxyType = cloudflare.F(o.ProxyType)
+	}
+	if o.Access != nil {
+		param.Access = cloudflare.F(zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequestAccess{
+			Required: cloudflare.F(o.Access.Required),
+			TeamName: cloudflare.F(o.Access.TeamName),
+			AUDTag:   cloudflare.F(o.Access.AUDTag),
+		})
+	}
+	return param
+}
+
+// NewIngressRuleFromPublicHostname converts an existing ingress rule to its declarative form
+func NewIngressRuleFromPublicHostname(ingress PublicHostnameIngress) IngressRule {
+	rule := IngressRule{
+		Hostname: ingress.Hostname,
+		Path:     ingress.Path,
+		Service:  ingress.Service,
+	}
+
+	o := ingress.OriginRequest
+	origin := OriginRequestConfig{
+		ConnectTimeout:         o.ConnectTimeout,
+		TLSTimeout:             o.TLSTimeout,
+		TCPKeepAlive:           o.TCPKeepAlive,
+		NoHappyEyeballs:        o.NoHappyEyeballs,
+		KeepAliveConnections:   o.KeepAliveConnections,
+		KeepAliveTimeout:       o.KeepAliveTimeout,
+		HTTPHostHeader:         o.HTTPHostHeader,
+		OriginServerName:       o.OriginServerName,
+		CAPool:                 o.CAPool,
+		NoTLSVerify:            o.NoTLSVerify,
+		DisableChunkedEncoding: o.DisableChunkedEncoding,
+		HTTP2Origin:            o.HTTP2Origin,
+		ProxyType:              o.ProxyType,
+	}
+	if o.Access.TeamName != "" || len(o.Access.AUDTag) > 0 || o.Access.Required {
+		origin.Access = &OriginRequestAccess{
+			Required: o.Access.Required,
+			TeamName: o.Access.TeamName,
+			AUDTag:   o.Access.AUDTag,
+		}
+	}
+	if field, ok := o.JSON.ExtraFields["bastionMode"]; ok && field.Raw() == "true" {
+		origin.BastionMode = true
+	}
+	if !origin.IsZero() {
+		rule.OriginRequest = &origin
+	}
+
+	return rule
+}
+
+// IsZero reports whether no origin request option is set
+func (o OriginRequestConfig) IsZero() bool {
+	return o.ConnectTimeout == 0 && o.TLSTimeout == 0 && o.TCPKeepAlive == 0 && !o.NoHappyEyeballs &&
+		o.KeepAliveConnections == 0 && o.KeepAliveTimeout == 0 && o.HTTPHostHeader == "" &&
+		o.OriginServerName == "" && o.CAPool == "" && !o.NoTLSVerify && !o.DisableChunkedEncoding &&
+		!o.HTTP2Origin && o.ProxyType == "" && !o.BastionMode && o.Access == nil
+}
+
+// ToNewParams converts a desired DNS record to the record creation parameters
+func (r DesiredDNSRecord) ToNewParams() DNSRecordCreateRequest {
+	body := dns.RecordNewParamsBody{
+		Type:    cloudflare.F(dns.RecordNewParamsBodyType(r.Type)),
+		Name:    cloudflare.F(r.Name),
+		Content: cloudflare.F(r.Content),
+		TTL:     cloudflare.F(dns.TTL(r.TTL)),
+		Proxied: cloudflare.F(r.Proxied),
+	}
+	if r.Priority != 0 {
+		body.Priority = cloudflare.F(r.Priority)
+	}
+	if r.Comment != "" {
+		body.Comment = cloudflare.F(r.Comment)
+	}
+	return dns.RecordNewParams{Body: body}
+}
+
+// ToUpdateParams converts a desired DNS record to the record update parameters
+func (r DesiredDNSRecord) ToUpdateParams() DNSRecordUpdateRequest {
+	body := dns.RecordUpdateParamsBody{
+		Type:    cloudflare.F(dns.RecordUpdateParamsBodyType(r.Type)),
+		Name:    cloudflare.F(r.Name),
+		Content: cloudflare.F(r.Content),
+		TTL:     cloudflare.F(dns.TTL(r.TTL)),
+		Proxied: cloudflare.F(r.Proxied),
+	}
+	if r.Priority != 0 {
+		body.Priority = cloudflare.F(r.Priority)
+	}
+	if r.Comment != "" {
+		body.Comment = cloudflare.F(r.Comment)
+	}
+	return dns.RecordUpdateParams{Body: body}
+}
+
+// NewDesiredDNSRecordFromRecord converts an existing DNS record to its declarative form
+func NewDesiredDNSRecordFromRecord(record DNSRecord) DesiredDNSRecord {
+	return DesiredDNSRecord{
+		Type:     string(record.Type),
+		Name:     record.Name,
+		Content:  record.Content,
+		TTL:      float64(record.TTL),
+		Proxied:  record.Proxied,
+		Priority: record.Priority,
+		Comment:  record.Comment,
+	}
+}
@@ -1,6 +1,13 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/cloudflare/cloudflare-go/v4"
 	"github.com/cloudflare/cloudflare-go/v4/zero_trust"
 )
@@ -66,6 +73,167 @@ type TunnelConfigurationResponse struct {
 	Data    TunnelConfiguration `json:"data"`
 }
 
+// Tunnel health verdicts
+const (
+	TunnelHealthHealthy  = "healthy"
+	TunnelHealthDegraded = "degraded"
+	TunnelHealthDown     = "down"
+	TunnelHealthInactive = "inactive"
+	// TunnelHealthUnknown is reported when the tunnel's connections couldn't be read
+	TunnelHealthUnknown = "unknown"
+)
+
+// TunnelConnection is one connection of a cloudflared connector to a Cloudflare data center
+type TunnelConnection struct {
+	ID            string    `json:"id"`
+	ConnectorID   string    `json:"connector_id"`
+	Colo          string    `json:"colo"`
+	OriginIP      string    `json:"origin_ip"`
+	ClientVersion string    `json:"client_version"`
+	Arch          string    `json:"arch,omitempty"`
+	OpenedAt      time.Time `json:"opened_at"`
+	// PendingReconnect is set for connections that dropped and are kept for a few minutes in case cloudflared reconnects
+	PendingReconnect bool `json:"is_pending_reconnect"`
+}
+
+// TunnelHealth is the health verdict of a tunnel, aggregated from its live connections
+type TunnelHealth struct {
+	TunnelID string `json:"tunnel_id"`
+	Name     string `json:"name"`
+	Health   string `json:"health"`
+	Reason   string `json:"reason,omitempty"`
+	// Status is the status Cloudflare reports for the tunnel
+	Status          string     `json:"status"`
+	Connectors      int        `json:"connectors"`
+	Connections     int        `json:"connections"`
+	Colos           []string   `json:"colos"`
+	ConnsActiveAt   *time.Time `json:"conns_active_at,omitempty"`
+	ConnsInactiveAt *time.Time `json:"conns_inactive_at,omitempty"`
+}
+
+// Outcomes of the steps of a tunnel force delete or secret rotation
+const (
+	TunnelCleanupRemoved   = "removed"
+	TunnelCleanupRecreated = "recreated"
+	TunnelCleanupDeleted   = "deleted"
+	TunnelCleanupFailed    = "failed"
+	TunnelCleanupNotFound  = "not_found"
+	// TunnelCleanupZoneNotFound is reported for hostnames outside the account's zones
+	TunnelCleanupZoneNotFound = "zone_not_found"
+)
+
+// TunnelContainerResult reports what happened to a cloudflared container running a deleted or rotated tunnel
+type TunnelContainerResult struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// NewID is the ID of the container that replaced a recreated one
+	NewID  string `json:"new_id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TunnelDNSRecordResult reports what happened to the CNAME of a hostname routed by a deleted tunnel
+type TunnelDNSRecordResult struct {
+	Hostname string `json:"hostname"`
+	ZoneID   string `json:"zone_id,omitempty"`
+	ZoneName string `json:"zone_name,omitempty"`
+	RecordID string `json:"record_id,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// TunnelDeleteResult reports the steps of a tunnel delete
+// Steps that ran before a failure are reported too, so the caller knows what is already gone
+type TunnelDeleteResult struct {
+	TunnelID           string                  `json:"tunnel_id"`
+	Deleted            bool                    `json:"deleted"`
+	ConnectionsCleaned bool                    `json:"connections_cleaned"`
+	Containers         []TunnelContainerResult `json:"containers"`
+	DNSRecords         []TunnelDNSRecordResult `json:"dns_records"`
+	Warnings           []string                `json:"warnings,omitempty"`
+}
+
+// TunnelRotateResult reports the steps of a tunnel secret rotation
+type TunnelRotateResult struct {
+	TunnelID string `json:"tunnel_id"`
+	// Token is the new token, for cloudflared instances cfProxyHub doesn't manage
+	Token              string                  `json:"token,omitempty"`
+	ConnectionsCleaned bool                    `json:"connections_cleaned"`
+	Containers         []TunnelContainerResult `json:"containers"`
+	Warnings           []string                `json:"warnings,omitempty"`
+}
+
+// Kinds of problems found between tunnel ingress and tunnel CNAME records
+const (
+	// TunnelDNSDeletedTunnel is a CNAME pointing to a tunnel that no longer exists
+	TunnelDNSDeletedTunnel = "deleted_tunnel"
+	// TunnelDNSUnknownTunnel is a CNAME pointing to a tunnel outside the account, which is never deleted by a repair
+	TunnelDNSUnknownTunnel = "unknown_tunnel"
+	// TunnelDNSUnroutedHostname is a CNAME pointing to a tunnel whose ingress doesn't route the hostname
+	TunnelDNSUnroutedHostname = "unrouted_hostname"
+	// TunnelDNSMissingRecord is an ingress hostname without a CNAME pointing to its tunnel
+	TunnelDNSMissingRecord = "missing_record"
+)
+
+// TunnelDNSKinds lists every kind of tunnel DNS finding
+var TunnelDNSKinds = []string{TunnelDNSDeletedTunnel, TunnelDNSUnknownTunnel, TunnelDNSUnroutedHostname, TunnelDNSMissingRecord}
+
+// TunnelDNSFinding is one mismatch between the tunnels of an account and the CNAME records in its zones
+type TunnelDNSFinding struct {
+	// ID identifies the finding across scans, to repair exactly the findings of a report
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Hostname   string `json:"hostname"`
+	TunnelID   string `json:"tunnel_id"`
+	TunnelName string `json:"tunnel_name,omitempty"`
+	ZoneID     string `json:"zone_id,omitempty"`
+	ZoneName   string `json:"zone_name,omitempty"`
+	RecordID   string `json:"record_id,omitempty"`
+	Detail     string `json:"detail"`
+}
+
+// TunnelDNSReport lists the tunnel DNS findings of an account
+type TunnelDNSReport struct {
+	AccountID      string             `json:"account_id"`
+	Findings       []TunnelDNSFinding `json:"findings"`
+	Summary        map[string]int     `json:"summary"`
+	ZonesScanned   int                `json:"zones_scanned"`
+	TunnelsScanned int                `json:"tunnels_scanned"`
+	// Warnings name tunnels and zones that couldn't be read; their records are not judged
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Add records a finding and updates the summary
+func (r *TunnelDNSReport) Add(finding TunnelDNSFinding) {
+	r.Findings = append(r.Findings, finding)
+	r.Summary[finding.Kind]++
+}
+
+// Repair actions taken for tunnel DNS findings
+const (
+	TunnelDNSActionDelete = "delete"
+	TunnelDNSActionCreate = "create"
+	TunnelDNSActionSkip   = "skip"
+)
+
+// TunnelDNSRepairOutcome is the result of repairing one finding
+type TunnelDNSRepairOutcome struct {
+	Finding TunnelDNSFinding `json:"finding"`
+	Action  string           `json:"action"`
+	Success bool             `json:"success"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// TunnelDNSRepairResult reports the repair of the findings of a fresh scan
+type TunnelDNSRepairResult struct {
+	Report  TunnelDNSReport          `json:"report"`
+	Results []TunnelDNSRepairOutcome `json:"results"`
+	Failed  int                      `json:"failed"`
+	Skipped int                      `json:"skipped"`
+	// NotFound lists the requested finding IDs the fresh scan no longer found
+	NotFound []string `json:"not_found,omitempty"`
+}
+
 // Helper functions for creating request parameters
 func NewTunnelCreateRequest(name, configSrc string) TunnelCreateRequest {
 	params := zero_trust.TunnelCloudflaredNewParams{
@@ -116,3 +284,290 @@ func NewPublicHostnameIngressParamWithOriginRequest(hostname, service, path stri
 	}
 	return param
 }
+
+// PublicHostnameRule is an ingress rule to be written to a tunnel configuration, together with the raw JSON
+// of fields the SDK doesn't model (e.g. originRequest.bastionMode), keyed by sjson path relative to the rule
+type PublicHostnameRule struct {
+	Param PublicHostnameIngressParam
+	Extra map[string]json.RawMessage
+}
+
+// NewPublicHostnameRule wraps an ingress rule parameter that has no extra fields
+func NewPublicHostnameRule(param PublicHostnameIngressParam) PublicHostnameRule {
+	return PublicHostnameRule{Param: param}
+}
+
+// NewPublicHostnameRuleFromIngress converts an ingress rule read from a tunnel configuration without losing any field
+func NewPublicHostnameRuleFromIngress(ingress PublicHostnameIngress) PublicHostnameRule {
+	return PublicHostnameRule{
+		Param: NewPublicHostnameIngressParamFromIngress(ingress),
+		Extra: PublicHostnameIngressExtraFields(ingress),
+	}
+}
+
+// presence is implemented by the SDK's JSON field metadata
+type presence interface {
+	IsMissing() bool
+}
+
+// isSet reports whether a response field was present in the API response or carries a value
+// Responses built in code have no JSON metadata, so non-zero values count as present too
+func isSet(field presence, nonZero bool) bool {
+	return nonZero || !field.IsMissing()
+}
+
+// sjsonPathEscaper escapes a JSON key for use as a single sjson path component
+var sjsonPathEscaper = strings.NewReplacer(".", `\.`, "*", `\*`, "?", `\?`, "|", `\|`, "#", `\#`, "@", `\@`)
+
+// NewPublicHostnameIngressParamFromIngress converts an ingress rule read from a tunnel configuration
+// back into an update parameter. Only fields present in the response are set, so a read-modify-write
+// cycle sends back exactly what it read
+func NewPublicHostnameIngressParamFromIngress(ingress PublicHostnameIngress) PublicHostnameIngressParam {
+	param := zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngress{
+		Service: cloudflare.F(ingress.Service),
+	}
+	if isSet(ingress.JSON.Hostname, ingress.Hostname != "") {
+		param.Hostname = cloudflare.F(ingress.Hostname)
+	}
+	if isSet(ingress.JSON.Path, ingress.Path != "") {
+		param.Path = cloudflare.F(ingress.Path)
+	}
+	if isSet(ingress.JSON.OriginRequest, false) || !isZeroIngressOriginRequest(ingress.OriginRequest) {
+		param.OriginRequest = cloudflare.F(NewIngressOriginRequestParam(ingress.OriginRequest))
+	}
+	return param
+}
+
+// NewIngressOriginRequestParam converts the origin request options of an ingress rule to their update parameter
+func NewIngressOriginRequestParam(o zero_trust.TunnelCloudflaredConfigurationGetResponseConfigIngressOriginRequest) zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequest {
+	param := zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequest{}
+	if isSet(o.JSON.Access, o.Access.TeamName != "" || len(o.Access.AUDTag) > 0 || o.Access.Required) {
+		access := zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequestAccess{
+			AUDTag:   cloudflare.F(o.Access.AUDTag),
+			TeamName: cloudflare.F(o.Access.TeamName),
+		}
+		if isSet(o.Access.JSON.Required, o.Access.Required) {
+			access.Required = cloudflare.F(o.Access.Required)
+		}
+		param.Access = cloudflare.F(access)
+	}
+	if isSet(o.JSON.CAPool, o.CAPool != "") {
+		param.CAPool = cloudflare.F(o.CAPool)
+	}
+	if isSet(o.JSON.ConnectTimeout, o.ConnectTimeout != 0) {
+		param.ConnectTimeout = cloudflare.F(o.ConnectTimeout)
+	}
+	if isSet(o.JSON.DisableChunkedEncoding, o.DisableChunkedEncoding) {
+		param.DisableChunkedEncoding = cloudflare.F(o.DisableChunkedEncoding)
+	}
+	if isSet(o.JSON.HTTP2Origin, o.HTTP2Origin) {
+		param.HTTP2Origin = cloudflare.F(o.HTTP2Origin)
+	}
+	if isSet(o.JSON.HTTPHostHeader, o.HTTPHostHeader != "") {
+		param.HTTPHostHeader = cloudflare.F(o.HTTPHostHeader)
+	}
+	if isSet(o.JSON.KeepAliveConnections, o.KeepAliveConnections != 0) {
+		param.KeepAliveConnections = cloudflare.F(o.KeepAliveConnections)
+	}
+	if isSet(o.JSON.KeepAliveTimeout, o.KeepAliveTimeout != 0) {
+		param.KeepAliveTimeout = cloudflare.F(o.KeepAliveTimeout)
+	}
+	if isSet(o.JSON.NoHappyEyeballs, o.NoHappyEyeballs) {
+		param.NoHappyEyeballs = cloudflare.F(o.NoHappyEyeballs)
+	}
+	if isSet(o.JSON.NoTLSVerify, o.NoTLSVerify) {
+		param.NoTLSVerify = cloudflare.F(o.NoTLSVerify)
+	}
+	if isSet(o.JSON.OriginServerName, o.OriginServerName != "") {
+		param.OriginServerName = cloudflare.F(o.OriginServerName)
+	}
+	if isSet(o.JSON.ProxyType, o.ProxyType != "") {
+		param.ProxyType = cloudflare.F(o.ProxyType)
+	}
+	if isSet(o.JSON.TCPKeepAlive, o.TCPKeepAlive != 0) {
+		param.TCPKeepAlive = cloudflare.F(o.TCPKeepAlive)
+	}
+	if isSet(o.JSON.TLSTimeout, o.TLSTimeout != 0) {
+		param.TLSTimeout = cloudflare.F(o.TLSTimeout)
+	}
+	return param
+}
+
+// NewConfigOriginRequestParam converts the tunnel-wide origin request defaults to their update parameter
+func NewConfigOriginRequestParam(o zero_trust.TunnelCloudflaredConfigurationGetResponseConfigOriginRequest) zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigOriginRequest {
+	param := zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigOriginRequest{}
+	if isSet(o.JSON.Access, o.Access.TeamName != "" || len(o.Access.AUDTag) > 0 || o.Access.Required) {
+		access := zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigOriginRequestAccess{
+			AUDTag:   cloudflare.F(o.Access.AUDTag),
+			TeamName: cloudflare.F(o.Access.TeamName),
+		}
+		if isSet(o.Access.JSON.Required, o.Access.Required) {
+			access.Required = cloudflare.F(o.Access.Required)
+		}
+		param.Access = cloudflare.F(access)
+	}
+	if isSet(o.JSON.CAPool, o.CAPool != "") {
+		param.CAPool = cloudflare.F(o.CAPool)
+	}
+	if isSet(o.JSON.ConnectTimeout, o.ConnectTimeout != 0) {
+		param.ConnectTimeout = cloudflare.F(o.ConnectTimeout)
+	}
+	if isSet(o.JSON.DisableChunkedEncoding, o.DisableChunkedEncoding) {
+		param.DisableChunkedEncoding = cloudflare.F(o.DisableChunkedEncoding)
+	}
+	if isSet(o.JSON.HTTP2Origin, o.HTTP2Origin) {
+		param.HTTP2Origin = cloudflare.F(o.HTTP2Origin)
+	}
+	if isSet(o.JSON.HTTPHostHeader, o.HTTPHostHeader != "") {
+		param.HTTPHostHeader = cloudflare.F(o.HTTPHostHeader)
+	}
+	if isSet(o.JSON.KeepAliveConnections, o.KeepAliveConnections != 0) {
+		param.KeepAliveConnections = cloudflare.F(o.KeepAliveConnections)
+	}
+	if isSet(o.JSON.KeepAliveTimeout, o.KeepAliveTimeout != 0) {
+		param.KeepAliveTimeout = cloudflare.F(o.KeepAliveTimeout)
+	}
+	if isSet(o.JSON.NoHappyEyeballs, o.NoHappyEyeballs) {
+		param.NoHappyEyeballs = cloudflare.F(o.NoHappyEyeballs)
+	}
+	if isSet(o.JSON.NoTLSVerify, o.NoTLSVerify) {
+		param.NoTLSVerify = cloudflare.F(o.NoTLSVerify)
+	}
+	if isSet(o.JSON.OriginServerName, o.OriginServerName != "") {
+		param.OriginServerName = cloudflare.F(o.OriginServerName)
+	}
+	if isSet(o.JSON.ProxyType, o.ProxyType != "") {
+		param.ProxyType = cloudflare.F(o.ProxyType)
+	}
+	if isSet(o.JSON.TCPKeepAlive, o.TCPKeepAlive != 0) {
+		param.TCPKeepAlive = cloudflare.F(o.TCPKeepAlive)
+	}
+	if isSet(o.JSON.TLSTimeout, o.TLSTimeout != 0) {
+		param.TLSTimeout = cloudflare.F(o.TLSTimeout)
+	}
+	return param
+}
+
+// PublicHostnameIngressExtraFields returns the raw JSON of ingress rule fields the SDK doesn't model
+// (e.g. originRequest.bastionMode), keyed by sjson path relative to the rule
+func PublicHostnameIngressExtraFields(ingress PublicHostnameIngress) map[string]json.RawMessage {
+	extra := make(map[string]json.RawMessage)
+	for key, field := range ingress.JSON.ExtraFields {
+		extra[sjsonPathEscaper.Replace(key)] = json.RawMessage(field.Raw())
+	}
+	for key, field := range ingress.OriginRequest.JSON.ExtraFields {
+		extra["originRequest."+sjsonPathEscaper.Replace(key)] = json.RawMessage(field.Raw())
+	}
+	for key, field := range ingress.OriginRequest.Access.JSON.ExtraFields {
+		extra["originRequest.access."+sjsonPathEscaper.Replace(key)] = json.RawMessage(field.Raw())
+	}
+	return extra
+}
+
+// TunnelConfigExtraFields returns the raw JSON of tunnel-wide settings the update parameters don't model
+// (warp-routing and unknown fields), keyed by sjson path relative to the config
+func TunnelConfigExtraFields(config zero_trust.TunnelCloudflaredConfigurationGetResponseConfig) map[string]json.RawMessage {
+	extra := make(map[string]json.RawMessage)
+	if raw := config.JSON.WARPRouting.Raw(); raw != "" && !config.JSON.WARPRouting.IsNull() {
+		extra["warp-routing"] = json.RawMessage(raw)
+	}
+	for key, field := range config.JSON.ExtraFields {
+		extra[sjsonPathEscaper.Replace(key)] = json.RawMessage(field.Raw())
+	}
+	for key, field := range config.OriginRequest.JSON.ExtraFields {
+		extra["originRequest."+sjsonPathEscaper.Replace(key)] = json.RawMessage(field.Raw())
+	}
+	return extra
+}
+
+// isZeroIngressOriginRequest reports whether no origin request option of a rule is set
+func isZeroIngressOriginRequest(o zero_trust.TunnelCloudflaredConfigurationGetResponseConfigIngressOriginRequest) bool {
+	return o.Access.TeamName == "" && len(o.Access.AUDTag) == 0 && !o.Access.Required &&
+		o.CAPool == "" && o.ConnectTimeout == 0 && !o.DisableChunkedEncoding && !o.HTTP2Origin &&
+		o.HTTPHostHeader == "" && o.KeepAliveConnections == 0 && o.KeepAliveTimeout == 0 &&
+		!o.NoHappyEyeballs && !o.NoTLSVerify && o.OriginServerName == "" && o.ProxyType == "" &&
+		o.TCPKeepAlive == 0 && o.TLSTimeout == 0
+}
+
+// ingressServiceSchemes are the URL schemes cloudflared can proxy to
+var ingressServiceSchemes = map[string]bool{
+	"http": true, "https": true, "tcp": true, "ssh": true, "rdp": true, "smb": true,
+}
+
+// ValidateIngressService checks that a service is something cloudflared can route to
+// e.g. https://localhost:8443, ssh://localhost:22, unix:/run/app.sock, http_status:404, hello_world
+func ValidateIngressService(service string) error {
+	switch {
+	case service == "":
+		return fmt.Errorf("service is required")
+	case service == "hello_world" || service == "bastion" || service == "socks5":
+		return nil
+	case strings.HasPrefix(service, "http_status:"):
+		code, err := strconv.Atoi(strings.TrimPrefix(service, "http_status:"))
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("invalid service %q: http_status needs a status code between 100 and 599", service)
+		}
+		return nil
+	case strings.HasPrefix(service, "unix:") || strings.HasPrefix(service, "unix+tls:"):
+		if strings.TrimPrefix(strings.TrimPrefix(service, "unix+tls:"), "unix:") == "" {
+			return fmt.Errorf("invalid service %q: socket path is required", service)
+		}
+		return nil
+	}
+
+	u, err := url.Parse(service)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid service %q: expected scheme://host[:port]", service)
+	}
+	if !ingressServiceSchemes[u.Scheme] {
+		return fmt.Errorf("invalid service %q: unsupported scheme %s", service, u.Scheme)
+	}
+	return nil
+}
+
+// Validate checks origin request options for values cloudflared would reject or ignore
+func (o OriginRequestConfig) Validate(service string) error {
+	durations := map[string]int64{
+		"connectTimeout":   o.ConnectTimeout,
+		"tlsTimeout":       o.TLSTimeout,
+		"tcpKeepAlive":     o.TCPKeepAlive,
+		"keepAliveTimeout": o.KeepAliveTimeout,
+	}
+	for name, seconds := range durations {
+		if seconds < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if o.KeepAliveConnections < 0 {
+		return fmt.Errorf("keepAliveConnections must not be negative")
+	}
+
+	if o.ProxyType != "" && o.ProxyType != "socks" {
+		return fmt.Errorf("proxyType must be empty or \"socks\"")
+	}
+	if strings.ContainsAny(o.HTTPHostHeader, " /") {
+		return fmt.Errorf("httpHostHeader must be a bare host name")
+	}
+	if strings.ContainsAny(o.OriginServerName, " /") {
+		return fmt.Errorf("originServerName must be a bare host name")
+	}
+	if o.HTTP2Origin && !strings.HasPrefix(service, "https://") {
+		return fmt.Errorf("http2Origin requires an https:// service")
+	}
+
+	if o.Access != nil {
+		if o.Access.TeamName == "" {
+			return fmt.Errorf("access.teamName is required")
+		}
+		if len(o.Access.AUDTag) == 0 {
+			return fmt.Errorf("access.audTag needs at least one application audience tag")
+		}
+		for _, tag := range o.Access.AUDTag {
+			if strings.TrimSpace(tag) == "" {
+				return fmt.Errorf("access.audTag must not contain empty values")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go/v4/zero_trust"
+)
+
+// fullIngressRule sets every ingress rule field the SDK models, plus fields it doesn't
+const fullIngressRule = `{
+	"hostname": "app.example.com",
+	"path": "^/api",
+	"service": "https://app:8443",
+	"futureRuleOption": {"enabled": true},
+	"originRequest": {
+		"access": {"audTag": ["aud-1", "aud-2"], "teamName": "team", "required": true, "futureAccessOption": 7},
+		"caPool": "/etc/ca.pem",
+		"connectTimeout": 15,
+		"disableChunkedEncoding": true,
+		"http2Origin": true,
+		"httpHostHeader": "app.internal",
+		"keepAliveConnections": 50,
+		"keepAliveTimeout": 60,
+		"noHappyEyeballs": true,
+		"noTLSVerify": true,
+		"originServerName": "app.internal",
+		"proxyType": "socks",
+		"tcpKeepAlive": 20,
+		"tlsTimeout": 5,
+		"bastionMode": true
+	}
+}`
+
+// decodeIngress reads an ingress rule the way it arrives in a tunnel configuration response
+func decodeIngress(t *testing.T, raw string) PublicHostnameIngress {
+	t.Helper()
+	var ingress PublicHostnameIngress
+	if err := json.Unmarshal([]byte(raw), &ingress); err != nil {
+		t.Fatalf("decode ingress: %v", err)
+	}
+	return ingress
+}
+
+// toMap turns a JSON value into generic maps for comparison
+func toMap(t *testing.T, v any) map[string]any {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return m
+}
+
+// setPath sets a dotted path of plain keys in a generic map
+func setPath(t *testing.T, m map[string]any, path string, raw json.RawMessage) {
+	t.Helper()
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		t.Fatalf("extra field %s: %v", path, err)
+	}
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := m[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			m[key] = next
+		}
+		m = next
+	}
+	m[keys[len(keys)-1]] = value
+}
+
+func TestNewPublicHostnameRuleFromIngressRoundTrip(t *testing.T) {
+	rule := NewPublicHostnameRuleFromIngress(decodeIngress(t, fullIngressRule))
+
+	written := toMap(t, rule.Param)
+	for path, raw := range rule.Extra {
+		setPath(t, written, path, raw)
+	}
+
+	var read map[string]any
+	if err := json.Unmarshal([]byte(fullIngressRule), &read); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(written, read) {
+		t.Errorf("rule changed on the way back\nread:    %v\nwritten: %v", read, written)
+	}
+}
+
+func TestPublicHostnameIngressExtraFields(t *testing.T) {
+	extra := PublicHostnameIngressExtraFields(decodeIngress(t, fullIngressRule))
+
+	want := map[string]string{
+		"futureRuleOption":                        `{"enabled": true}`,
+		"originRequest.bastionMode":               `true`,
+		"originRequest.access.futureAccessOption": `7`,
+	}
+	if len(extra) != len(want) {
+		t.Errorf("got %d extra fields %v, want %d", len(extra), extra, len(want))
+	}
+	for path, raw := range want {
+		if got, ok := extra[path]; !ok || string(got) != raw {
+			t.Errorf("extra field %s = %s, want %s", path, got, raw)
+		}
+	}
+}
+
+func TestPublicHostnameIngressExtraFieldsEscapesKeys(t *testing.T) {
+	extra := PublicHostnameIngressExtraFields(decodeIngress(t, `{"service": "http://app", "x.y": 1}`))
+	if _, ok := extra[`x\.y`]; !ok {
+		t.Errorf("key with a dot not escaped: %v", extra)
+	}
+}
+
+func TestNewIngressOriginRequestParam(t *testing.T) {
+	ingress := decodeIngress(t, fullIngressRule)
+	got := toMap(t, NewIngressOriginRequestParam(ingress.OriginRequest))
+
+	var read struct {
+		OriginRequest map[string]any `json:"originRequest"`
+	}
+	if err := json.Unmarshal([]byte(fullIngressRule), &read); err != nil {
+		t.Fatal(err)
+	}
+	want := read.OriginRequest
+	delete(want, "bastionMode")
+	delete(want["access"].(map[string]any), "futureAccessOption")
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("origin request\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestNewIngressOriginRequestParamKeepsExplicitZeroValues(t *testing.T) {
+	ingress := decodeIngress(t, `{"service": "http://app", "originRequest": {"noTLSVerify": false, "connectTimeout": 0}}`)
+	got := toMap(t, NewIngressOriginRequestParam(ingress.OriginRequest))
+
+	want := map[string]any{"noTLSVerify": false, "connectTimeout": float64(0)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNewPublicHostnameRuleFromIngressBuiltInCode(t *testing.T) {
+	// Rules built in code have no JSON metadata, so only non-zero values are written
+	rule := NewPublicHostnameRuleFromIngress(PublicHostnameIngress{
+		Hostname: "app.example.com",
+		Service:  "http://app:80",
+		OriginRequest: zero_trust.TunnelCloudflaredConfigurationGetResponseConfigIngressOriginRequest{
+			NoTLSVerify: true,
+		},
+	})
+
+	got := toMap(t, rule.Param)
+	want := map[string]any{
+		"hostname":      "app.example.com",
+		"service":       "http://app:80",
+		"originRequest": map[string]any{"noTLSVerify": true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(rule.Extra) != 0 {
+		t.Errorf("unexpected extra fields %v", rule.Extra)
+	}
+}
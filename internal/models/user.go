@@ -0,0 +1,130 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Role decides which API routes a user may call
+// Roles are ordered: every role may do everything the roles below it may do
+type Role string
+
+const (
+	// RoleViewer can read accounts, zones, tunnels and hostnames
+	RoleViewer Role = "viewer"
+	// RoleOperator can additionally change hostnames, DNS records and tunnels
+	RoleOperator Role = "operator"
+	// RoleAdmin can additionally delete zones and tunnels, manage Docker containers and users
+	RoleAdmin Role = "admin"
+)
+
+// rank orders roles by privilege, unknown roles rank lowest
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Valid reports whether the role is one of the known roles
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+// Includes reports whether the role grants everything the required role grants
+func (r Role) Includes(required Role) bool {
+	return r.Valid() && r.rank() >= required.rank()
+}
+
+// User is a cfProxyHub user as returned by the API
+// Provider is empty for local users and names the identity provider for single sign-on users
+type User struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+	Provider string `json:"provider,omitempty"`
+	// TOTPEnabled is set once the user has enrolled an authenticator app
+	TOTPEnabled bool      `json:"totp_enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UserCreateRequest is the body of the user creation endpoint
+type UserCreateRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     Role   `json:"role" binding:"required"`
+}
+
+// UserUpdateRequest is the body of the user update endpoint, empty fields are left unchanged
+type UserUpdateRequest struct {
+	Password string `json:"password,omitempty"`
+	Role     Role   `json:"role,omitempty"`
+}
+
+// MinPasswordLength is the shortest password accepted for users
+const MinPasswordLength = 8
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._@-]{0,63}$`)
+
+// Validate normalises and checks a new user
+func (r *UserCreateRequest) Validate() error {
+	r.Username = strings.TrimSpace(r.Username)
+	if !usernamePattern.MatchString(r.Username) {
+		return fmt.Errorf("username must be 1-64 letters, digits, dots, dashes, underscores or @")
+	}
+	if err := ValidatePassword(r.Password); err != nil {
+		return err
+	}
+	if !r.Role.Valid() {
+		return fmt.Errorf("role must be viewer, operator or admin")
+	}
+	return nil
+}
+
+// Validate checks the fields of a user update
+func (r *UserUpdateRequest) Validate() error {
+	if r.Password == "" && r.Role == "" {
+		return fmt.Errorf("password or role is required")
+	}
+	if r.Password != "" {
+		if err := ValidatePassword(r.Password); err != nil {
+			return err
+		}
+	}
+	if r.Role != "" && !r.Role.Valid() {
+		return fmt.Errorf("role must be viewer, operator or admin")
+	}
+	return nil
+}
+
+// ValidatePassword checks a password against the password policy
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > 72 {
+		return fmt.Errorf("password must not exceed 72 bytes")
+	}
+	return nil
+}
+
+// Response wrappers for API endpoints
+type UserResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    User   `json:"data"`
+}
+
+type UsersResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    []User `json:"data"`
+	Total   int    `json:"total"`
+}
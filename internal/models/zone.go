@@ -41,10 +41,11 @@ type ZoneResponse struct {
 }
 
 type ZonesResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Data    []Zone `json:"data"`
-	Total   int    `json:"total"`
+	Success    bool        `json:"success"`
+	Message    string      `json:"message"`
+	Data       []Zone      `json:"data"`
+	Total      int         `json:"total"`
+	ResultInfo *ResultInfo `json:"result_info,omitempty"`
 }
 
 // DNS Record response wrappers
@@ -55,10 +56,17 @@ type DNSRecordResponse struct {
 }
 
 type DNSRecordsResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    []DNSRecord `json:"data"`
-	Total   int         `json:"total"`
+	Success    bool        `json:"success"`
+	Message    string      `json:"message"`
+	Data       []DNSRecord `json:"data"`
+	Total      int         `json:"total"`
+	ResultInfo *ResultInfo `json:"result_info,omitempty"`
+}
+
+type DNSRecordDeleteResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	ID      string `json:"id"`
 }
 
 // Zone summary for dropdowns
@@ -70,10 +78,22 @@ type ZoneSummary struct {
 }
 
 type ZoneSummaryResponse struct {
-	Success bool          `json:"success"`
-	Message string        `json:"message"`
-	Data    []ZoneSummary `json:"data"`
-	Total   int           `json:"total"`
+	Success    bool          `json:"success"`
+	Message    string        `json:"message"`
+	Data       []ZoneSummary `json:"data"`
+	Total      int           `json:"total"`
+	ResultInfo *ResultInfo   `json:"result_info,omitempty"`
+}
+
+// ZoneFilter selects the zones of an account to list
+// Page and PerPage are ignored when all matching zones are fetched
+type ZoneFilter struct {
+	Name      string
+	Status    string
+	Page      int
+	PerPage   int
+	Order     string
+	Direction string
 }
 
 // Zone create/update request models
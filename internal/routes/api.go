@@ -8,7 +8,7 @@ import (
 )
 
 // SetupAPIRoutes configures the API routes for the application (excluding auth routes)
-func SetupAPIRoutes(router *gin.Engine, cfg *config.Config) {
+func SetupAPIRoutes(router *gin.Engine, cfg *config.Config, auth *middleware.Authenticator) {
 	// Create a new group for API routes
 	api := router.Group("/api")
 
@@ -24,7 +24,7 @@ func SetupAPIRoutes(router *gin.Engine, cfg *config.Config) {
 	})
 
 	// Apply authentication middleware to all API routes (except health and auth routes)
-	api.Use(middleware.RequireAuth())
+	api.Use(auth.RequireAuth())
 
 	// Status endpoint to check authentication
 	api.GET("/status", func(c *gin.Context) {
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"cfProxyHub/internal/handlers"
+	"cfProxyHub/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupAPITokenRoutes configures the personal API token routes
+// Tokens can only be managed from a logged-in session, never with another token
+func SetupAPITokenRoutes(router *gin.Engine, auth *middleware.Authenticator) {
+	tokenHandler := handlers.NewAPITokenHandler(auth.Tokens)
+
+	tokens := router.Group("/api/tokens")
+	tokens.Use(auth.RequireAuth(), middleware.RequireSession())
+
+	tokens.GET("", tokenHandler.ListTokens)
+	tokens.POST("", tokenHandler.CreateToken)
+	tokens.DELETE("/:id", tokenHandler.RevokeToken)
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"cfProxyHub/internal/handlers"
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupAuditRoutes configures the audit log API routes, reserved to admins
+func SetupAuditRoutes(router *gin.Engine, auth *middleware.Authenticator) {
+	auditHandler := handlers.NewAuditHandler(auth.Audit)
+
+	audit := router.Group("/api/audit")
+	audit.Use(auth.RequireAuth(), middleware.Require(models.RoleAdmin, models.ScopeAuditRead))
+
+	audit.GET("", auditHandler.ListEvents)
+}
@@ -3,19 +3,38 @@ package routes
 import (
 	"cfProxyHub/internal/config"
 	"cfProxyHub/internal/handlers"
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupAuthRoutes configures the authentication API routes
-func SetupAuthRoutes(router *gin.Engine, cfg *config.Config) {
+func SetupAuthRoutes(router *gin.Engine, cfg *config.Config, auth *middleware.Authenticator) {
 	// Create auth route group under /api/auth
-	auth := router.Group("/api/auth")
+	authGroup := router.Group("/api/auth")
 
 	// Initialize auth handler
-	authHandler := handlers.NewLoginHandler(cfg)
+	authHandler := handlers.NewLoginHandler(cfg, auth)
 
 	// Authentication endpoints (public - no auth required)
-	auth.POST("/login", authHandler.LoginAPI)
-	auth.POST("/logout", authHandler.LogoutAPI)
+	authGroup.POST("/login", authHandler.LoginAPI)
+	authGroup.POST("/login/2fa", authHandler.LoginTwoFactor)
+	authGroup.POST("/login/2fa/enroll", authHandler.LoginTwoFactorEnroll)
+	authGroup.POST("/logout", authHandler.LogoutAPI)
+
+	// Two-factor authentication of the logged-in user, managed from a session only
+	twoFactorHandler := handlers.NewTwoFactorHandler(auth.Users, auth.Sessions, auth.Audit)
+	twoFactor := authGroup.Group("/2fa")
+	twoFactor.Use(auth.RequireAuth(), middleware.RequireSession())
+
+	twoFactor.GET("", twoFactorHandler.GetStatus)
+	twoFactor.POST("/enroll", twoFactorHandler.Enroll)
+	twoFactor.POST("/confirm", twoFactorHandler.Confirm)
+	twoFactor.POST("/disable", twoFactorHandler.Disable)
+	twoFactor.POST("/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+
+	// Admins decide whether admins and operators must use two-factor authentication
+	twoFactor.GET("/policy", middleware.RequireRole(models.RoleAdmin), twoFactorHandler.GetPolicy)
+	twoFactor.PUT("/policy", middleware.RequireRole(models.RoleAdmin), twoFactorHandler.SetPolicy)
 }
@@ -4,6 +4,7 @@ import (
 	"cfProxyHub/internal/config"
 	"cfProxyHub/internal/handlers"
 	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
 	"cfProxyHub/internal/services"
 	"log"
 
@@ -11,7 +12,7 @@ import (
 )
 
 // SetupAPIRoutes configures the API routes for the application
-func SetupCloudflareRoutes(router *gin.Engine, cfg *config.Config) {
+func SetupCloudflareRoutes(router *gin.Engine, cfg *config.Config, auth *middleware.Authenticator) {
 
 	// Initialize Cloudflare service
 	cfService, err := services.NewCloudflareService(cfg.CloudflareAPIToken, cfg.CloudflareAPIKey, cfg.CloudflareEmail)
@@ -19,43 +20,86 @@ func SetupCloudflareRoutes(router *gin.Engine, cfg *config.Config) {
 		log.Fatalf("Failed to initialize Cloudflare service: %v", err)
 	}
 
+	// Force deleting tunnels also removes the cloudflared containers running them, if Docker is available
+	dockerService, err := services.NewDockerService()
+	if err != nil {
+		log.Printf("Warning: Docker is not available, force deleting tunnels won't remove cloudflared containers: %v", err)
+	}
+	tunnelLifecycle := services.NewTunnelLifecycle(cfService, dockerService)
+
 	// Initialize handlers
 	cfAccountHandler := handlers.NewCloudflareAccountHandler(cfService)
-	tunnelHandler := handlers.NewCloudflareTunnelHandler(cfService)
+	tunnelHandler := handlers.NewCloudflareTunnelHandler(cfService, tunnelLifecycle)
 	zoneHandler := handlers.NewCloudflareZoneHandler(cfService)
+	dnsHandler := handlers.NewCloudflareDNSHandler(cfService)
+	stateHandler := handlers.NewCloudflareStateHandler(cfService)
 
 	// Cloudflare API routes
 	cloudflare := router.Group("/api/cloudflare")
 
 	// Apply authentication middleware to all Cloudflare routes
-	cloudflare.Use(middleware.RequireAuth())
+	cloudflare.Use(auth.RequireAuth())
+
+	// Viewers may call every GET route; changes need at least an operator, destructive ones an admin.
+	// API tokens additionally need the scope of the resource
+	accountsRead := middleware.RequireScope(models.ScopeAccountsRead)
+	zonesRead := middleware.RequireScope(models.ScopeZonesRead)
+	zonesWrite := middleware.Require(models.RoleAdmin, models.ScopeZonesWrite)
+	dnsRead := middleware.RequireScope(models.ScopeDNSRead)
+	dnsWrite := middleware.Require(models.RoleOperator, models.ScopeDNSWrite)
+	tunnelsRead := middleware.RequireScope(models.ScopeTunnelsRead)
+	tunnelsWrite := middleware.Require(models.RoleOperator, models.ScopeTunnelsWrite)
+	tunnelsDelete := middleware.Require(models.RoleAdmin, models.ScopeTunnelsWrite)
+	hostnamesRead := middleware.RequireScope(models.ScopeHostnamesRead)
+	hostnamesWrite := middleware.Require(models.RoleOperator, models.ScopeHostnamesWrite)
+	stateRead := middleware.RequireScope(models.ScopeStateRead)
+	stateWrite := middleware.Require(models.RoleOperator, models.ScopeStateWrite)
 
 	{
 		// Account routes
-		cloudflare.GET("/accounts", cfAccountHandler.GetAccounts)               // JSON API for direct API access
-		cloudflare.GET("/accounts/:accountId", cfAccountHandler.GetAccountByID) // Get specific account by ID
+		cloudflare.GET("/accounts", accountsRead, cfAccountHandler.GetAccounts)               // JSON API for direct API access
+		cloudflare.GET("/accounts/:accountId", accountsRead, cfAccountHandler.GetAccountByID) // Get specific account by ID
 
 		// Zone routes
-		cloudflare.GET("/accounts/:accountId/zones", zoneHandler.GetZonesByAccountID)               // Get zones for specific account
-		cloudflare.POST("/accounts/:accountId/zones", zoneHandler.CreateZone)                       // Create new zone
-		cloudflare.GET("/zones/:zoneId", zoneHandler.GetZoneByID)                                   // Get specific zone by ID
-		cloudflare.PUT("/zones/:zoneId", zoneHandler.UpdateZone)                                    // Update existing zone
-		cloudflare.DELETE("/zones/:zoneId", zoneHandler.DeleteZone)                                 // Delete zone
-		cloudflare.GET("/accounts/:accountId/zones/by-name/:domainName", zoneHandler.GetZoneByName) // Get zone by domain name
-		cloudflare.GET("/accounts/:accountId/zones/dropdown", zoneHandler.GetZonesForDropdown)      // Get zones for dropdown usage
+		cloudflare.GET("/accounts/:accountId/zones", zonesRead, zoneHandler.GetZonesByAccountID)               // Get zones for specific account
+		cloudflare.POST("/accounts/:accountId/zones", zonesWrite, zoneHandler.CreateZone)                      // Create new zone
+		cloudflare.GET("/zones/:zoneId", zonesRead, zoneHandler.GetZoneByID)                                   // Get specific zone by ID
+		cloudflare.PUT("/zones/:zoneId", zonesWrite, zoneHandler.UpdateZone)                                   // Update existing zone
+		cloudflare.DELETE("/zones/:zoneId", zonesWrite, zoneHandler.DeleteZone)                                // Delete zone
+		cloudflare.GET("/accounts/:accountId/zones/by-name/:domainName", zonesRead, zoneHandler.GetZoneByName) // Get zone by domain name
+		cloudflare.GET("/accounts/:accountId/zones/dropdown", zonesRead, zoneHandler.GetZonesForDropdown)      // Get zones for dropdown usage
+
+		// DNS record routes
+		cloudflare.GET("/zones/:zoneId/dns_records", dnsRead, dnsHandler.ListDNSRecords)                // List DNS records with filters and pagination
+		cloudflare.POST("/zones/:zoneId/dns_records", dnsWrite, dnsHandler.CreateDNSRecord)             // Create DNS record
+		cloudflare.GET("/zones/:zoneId/dns_records/:recordId", dnsRead, dnsHandler.GetDNSRecord)        // Get specific DNS record
+		cloudflare.PUT("/zones/:zoneId/dns_records/:recordId", dnsWrite, dnsHandler.UpdateDNSRecord)    // Overwrite DNS record
+		cloudflare.DELETE("/zones/:zoneId/dns_records/:recordId", dnsWrite, dnsHandler.DeleteDNSRecord) // Delete DNS record
 
 		// Tunnel routes
-		cloudflare.GET("/accounts/:accountId/tunnels", tunnelHandler.GetTunnelsByAccountID)           // Get tunnels for specific account
-		cloudflare.GET("/accounts/:accountId/tunnels/:tunnel_id", tunnelHandler.GetTunnelByID)        // Get specific tunnel by ID
-		cloudflare.POST("/accounts/:accountId/tunnels", tunnelHandler.CreateTunnel)                   // Create new tunnel
-		cloudflare.PUT("/accounts/:accountId/tunnels/:tunnel_id", tunnelHandler.UpdateTunnel)         // Update existing tunnel
-		cloudflare.DELETE("/accounts/:accountId/tunnels/:tunnel_id", tunnelHandler.DeleteTunnel)      // Delete tunnel
-		cloudflare.GET("/accounts/:accountId/tunnels/:tunnel_id/token", tunnelHandler.GetTunnelToken) // Get tunnel token
+		cloudflare.GET("/accounts/:accountId/tunnels", tunnelsRead, tunnelHandler.GetTunnelsByAccountID)                               // Get tunnels for specific account
+		cloudflare.GET("/accounts/:accountId/tunnels/:tunnel_id", tunnelsRead, tunnelHandler.GetTunnelByID)                            // Get specific tunnel by ID
+		cloudflare.POST("/accounts/:accountId/tunnels", tunnelsWrite, tunnelHandler.CreateTunnel)                                      // Create new tunnel
+		cloudflare.PUT("/accounts/:accountId/tunnels/:tunnel_id", tunnelsWrite, tunnelHandler.UpdateTunnel)                            // Update existing tunnel
+		cloudflare.DELETE("/accounts/:accountId/tunnels/:tunnel_id", tunnelsDelete, tunnelHandler.DeleteTunnel)                        // Delete tunnel
+		cloudflare.GET("/accounts/:accountId/tunnels/:tunnel_id/token", tunnelsWrite, tunnelHandler.GetTunnelToken)                    // Get tunnel token
+		cloudflare.POST("/accounts/:accountId/tunnels/:tunnel_id/rotate-secret", tunnelsDelete, tunnelHandler.RotateTunnelSecret)      // Rotate tunnel secret and recreate its containers
+		cloudflare.GET("/accounts/:accountId/tunnels/health", tunnelsRead, tunnelHandler.GetTunnelsHealth)                             // Health of every tunnel in the account
+		cloudflare.GET("/accounts/:accountId/tunnels/:tunnel_id/health", tunnelsRead, tunnelHandler.GetTunnelHealth)                   // Health verdict and connections of a tunnel
+		cloudflare.GET("/accounts/:accountId/tunnels/:tunnel_id/connections", tunnelsRead, tunnelHandler.GetTunnelConnections)         // Live cloudflared connections of a tunnel
+		cloudflare.DELETE("/accounts/:accountId/tunnels/:tunnel_id/connections", tunnelsWrite, tunnelHandler.CleanupTunnelConnections) // Clean up stale connections of a tunnel
+		cloudflare.GET("/accounts/:accountId/tunnels/dns/report", tunnelsRead, dnsRead, tunnelHandler.GetTunnelDNSReport)              // Orphaned tunnel CNAMEs and hostnames without one
+		cloudflare.POST("/accounts/:accountId/tunnels/dns/repair", tunnelsRead, dnsWrite, tunnelHandler.RepairTunnelDNS)               // Delete orphaned tunnel CNAMEs and create missing ones
 
 		// Public hostname routes
-		cloudflare.GET("/accounts/:accountId/tunnels/:tunnel_id/hostnames", tunnelHandler.GetPublicHostnamesByTunnelID)      // Get public hostnames for tunnel
-		cloudflare.POST("/accounts/:accountId/tunnels/:tunnel_id/hostnames", tunnelHandler.CreatePublicHostname)             // Create public hostname
-		cloudflare.PUT("/accounts/:accountId/tunnels/:tunnel_id/hostnames/:hostname", tunnelHandler.UpdatePublicHostname)    // Update public hostname
-		cloudflare.DELETE("/accounts/:accountId/tunnels/:tunnel_id/hostnames/:hostname", tunnelHandler.DeletePublicHostname) // Delete public hostname
+		cloudflare.GET("/accounts/:accountId/tunnels/:tunnel_id/hostnames", hostnamesRead, tunnelHandler.GetPublicHostnamesByTunnelID)       // Get public hostnames for tunnel
+		cloudflare.POST("/accounts/:accountId/tunnels/:tunnel_id/hostnames", hostnamesWrite, tunnelHandler.CreatePublicHostname)             // Create public hostname
+		cloudflare.PUT("/accounts/:accountId/tunnels/:tunnel_id/hostnames/:hostname", hostnamesWrite, tunnelHandler.UpdatePublicHostname)    // Update public hostname
+		cloudflare.DELETE("/accounts/:accountId/tunnels/:tunnel_id/hostnames/:hostname", hostnamesWrite, tunnelHandler.DeletePublicHostname) // Delete public hostname
+
+		// Desired state routes
+		cloudflare.GET("/accounts/:accountId/state", stateRead, stateHandler.ExportState) // Export current state as a desired state document
+		cloudflare.POST("/state/plan", stateRead, stateHandler.PlanState)                 // Diff a desired state document against live config
+		cloudflare.POST("/state/apply", stateWrite, stateHandler.ApplyState)              // Apply a desired state document
 	}
 }
@@ -1,15 +1,19 @@
 package routes
 
 import (
+	"context"
+	"log"
+
 	"cfProxyHub/internal/handlers"
 	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
 	"cfProxyHub/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // RegisterDockerRoutes sets up Docker-related API endpoints
-func RegisterDockerRoutes(api *gin.Engine) {
+func RegisterDockerRoutes(api *gin.Engine, auth *middleware.Authenticator) {
 	dockerService, err := services.NewDockerService()
 	if err != nil {
 		return // Optionally log error
@@ -17,17 +21,37 @@ func RegisterDockerRoutes(api *gin.Engine) {
 	dockerHandler := handlers.NewDockerHandler(dockerService)
 
 	docker := api.Group("/api/docker")
-	docker.Use(middleware.RequireAuth())
+	docker.Use(auth.RequireAuth())
+
+	// Docker access is equivalent to root on the host: listing needs an operator, changes an admin
+	// API tokens need docker:read to list and docker:write to change
+	docker.Use(middleware.RequireRole(models.RoleOperator))
+	read := middleware.RequireScope(models.ScopeDockerRead)
+	admin := middleware.Require(models.RoleAdmin, models.ScopeDockerWrite)
 
 	// Container management
-	docker.GET("/containers", dockerHandler.ListContainers)
-	docker.POST("/containers", dockerHandler.CreateContainer)
-	docker.DELETE("/containers/:id", dockerHandler.RemoveContainer)
-	docker.POST("/containers/:id/start", dockerHandler.StartContainer)
-	docker.POST("/containers/:id/stop", dockerHandler.StopContainer)
+	docker.GET("/containers", read, dockerHandler.ListContainers)
+	docker.POST("/containers", admin, dockerHandler.CreateContainer)
+	docker.DELETE("/containers/:id", admin, dockerHandler.RemoveContainer)
+	docker.POST("/containers/:id/start", admin, dockerHandler.StartContainer)
+	docker.POST("/containers/:id/stop", admin, dockerHandler.StopContainer)
 
 	// Other Docker resources
-	docker.GET("/images", dockerHandler.ListImages)
-	docker.GET("/volumes", dockerHandler.ListVolumes)
-	docker.GET("/networks", dockerHandler.ListNetworks)
+	docker.GET("/images", read, dockerHandler.ListImages)
+	docker.GET("/volumes", read, dockerHandler.ListVolumes)
+	docker.GET("/networks", read, dockerHandler.ListNetworks)
+}
+
+// StartDockerWatcher starts the shared watcher that keeps the Docker container cache up to date
+// Returns nil if no Docker client could be created
+func StartDockerWatcher() *services.DockerWatcher {
+	dockerService, err := services.NewDockerService()
+	if err != nil {
+		log.Printf("Docker watcher disabled: %v", err)
+		return nil
+	}
+
+	watcher := services.NewDockerWatcher(dockerService)
+	watcher.Start(context.Background())
+	return watcher
 }
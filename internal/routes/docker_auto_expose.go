@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cfProxyHub/internal/config"
+	"cfProxyHub/internal/handlers"
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+	"cfProxyHub/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupDockerAutoExposeRoutes starts the label-driven container exposer and registers its endpoints
+func SetupDockerAutoExposeRoutes(router *gin.Engine, cfg *config.Config, dockerWatcher *services.DockerWatcher, auth *middleware.Authenticator) {
+	if !cfg.DockerAutoExpose {
+		return
+	}
+	if dockerWatcher == nil {
+		log.Printf("Docker auto-expose disabled: Docker watcher is not running")
+		return
+	}
+
+	cfService, err := services.NewCloudflareService(cfg.CloudflareAPIToken, cfg.CloudflareAPIKey, cfg.CloudflareEmail)
+	if err != nil {
+		log.Fatalf("Failed to initialize Cloudflare service: %v", err)
+	}
+
+	exposer, err := services.NewDockerAutoExposer(dockerWatcher, cfService, cfg.DefaultAccountID, cfg.DefaultTunnelID, 5*time.Minute, cfg.AutoExposeStorePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize Docker auto-expose: %v", err)
+	}
+	exposer.Start(context.Background())
+
+	exposeHandler := handlers.NewDockerAutoExposeHandler(exposer)
+
+	exposures := router.Group("/api/docker/exposures")
+	exposures.Use(auth.RequireAuth())
+
+	exposures.GET("", middleware.RequireScope(models.ScopeDockerRead), exposeHandler.ListExposures)
+	exposures.POST("/sync", middleware.Require(models.RoleOperator, models.ScopeDockerWrite), exposeHandler.SyncExposures)
+}
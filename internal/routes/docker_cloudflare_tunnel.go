@@ -1,54 +1,36 @@
 package routes
 
 import (
-	"context"
 	"net/http"
-	"time"
 
 	"cfProxyHub/internal/handlers"
-	//"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
 	"cfProxyHub/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // RegisterDockerCloudflareTunnelRoutes sets up Docker-based Cloudflare Tunnel API endpoints
-func RegisterDockerCloudflareTunnelRoutes(api *gin.Engine) {
+func RegisterDockerCloudflareTunnelRoutes(api *gin.Engine, dockerWatcher *services.DockerWatcher, auth *middleware.Authenticator) {
 	dockerService, err := services.NewDockerService()
-	if err != nil {
+	if err != nil || dockerWatcher == nil {
 		return // Optionally log error
 	}
-	dockerCFTunnelHandler := handlers.NewDockerCloudflareTunnelHandler(dockerService)
+	dockerCFTunnelHandler := handlers.NewDockerCloudflareTunnelHandler(dockerService, dockerWatcher)
 
-	// Add debug middleware to log all requests
-	api.Use(func(c *gin.Context) {
-		if c.Request.URL.Path == "/api/docker/cloudflare/tunnels" {
-			c.Header("X-Debug-Route", "Docker Cloudflare Tunnel route accessed")
-			c.Next()
-		} else {
-			c.Next()
-		}
-	})
-
-	// Add Docker debug endpoints to check connection and get detailed diagnostics
-	api.GET("/api/docker/debug", func(c *gin.Context) {
-		if dockerService == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": "Docker service is nil",
-			})
-			return
-		}
-
-		// Try to ping the Docker daemon
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	// Debug output lists every container with its labels, so it is reserved to admins
+	debug := api.Group("/api/docker")
+	debug.Use(auth.RequireAuth(), middleware.Require(models.RoleAdmin, models.ScopeDockerRead))
 
-		pingErr := dockerService.Ping(ctx)
-		if pingErr != nil {
+	// Add Docker debug endpoint reporting the state of the Docker watcher
+	debug.GET("/debug", func(c *gin.Context) {
+		status := dockerWatcher.Status()
+		if !status.Connected {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
-				"message": "Failed to connect to Docker: " + pingErr.Error(),
+				"message": "Failed to connect to Docker: " + status.LastError,
+				"watcher": status,
 			})
 			return
 		}
@@ -56,21 +38,27 @@ func RegisterDockerCloudflareTunnelRoutes(api *gin.Engine) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "Successfully connected to Docker",
+			"watcher": status,
 		})
 	})
 
 	// Add a more detailed diagnostics endpoint
-	api.GET("/api/docker/diagnostics", dockerCFTunnelHandler.DockerDebugInfo)
+	debug.GET("/diagnostics", dockerCFTunnelHandler.DockerDebugInfo)
 
 	// Create a group for Docker-based Cloudflare Tunnel endpoints
+	// Same rules as the Docker container endpoints: operators manage running tunnels,
+	// only admins create or remove containers
 	dockerTunnels := api.Group("/api/docker/cloudflare/tunnels")
-	//dockerTunnels.Use(middleware.RequireAuth())
+	dockerTunnels.Use(auth.RequireAuth(), middleware.RequireRole(models.RoleOperator))
+	read := middleware.RequireScope(models.ScopeDockerRead)
+	operate := middleware.Require(models.RoleOperator, models.ScopeDockerWrite)
+	admin := middleware.Require(models.RoleAdmin, models.ScopeDockerWrite)
 
 	// Tunnel management endpoints
-	dockerTunnels.GET("", dockerCFTunnelHandler.ListTunnels)
-	dockerTunnels.POST("", dockerCFTunnelHandler.CreateTunnel)
-	dockerTunnels.DELETE("/:id", dockerCFTunnelHandler.DeleteTunnel)
-	dockerTunnels.POST("/:id/start", dockerCFTunnelHandler.StartTunnel)
-	dockerTunnels.POST("/:id/stop", dockerCFTunnelHandler.StopTunnel)
-	dockerTunnels.POST("/:id/restart", dockerCFTunnelHandler.RestartTunnel)
+	dockerTunnels.GET("", read, dockerCFTunnelHandler.ListTunnels)
+	dockerTunnels.POST("", admin, dockerCFTunnelHandler.CreateTunnel)
+	dockerTunnels.DELETE("/:id", admin, dockerCFTunnelHandler.DeleteTunnel)
+	dockerTunnels.POST("/:id/start", operate, dockerCFTunnelHandler.StartTunnel)
+	dockerTunnels.POST("/:id/stop", operate, dockerCFTunnelHandler.StopTunnel)
+	dockerTunnels.POST("/:id/restart", operate, dockerCFTunnelHandler.RestartTunnel)
 }
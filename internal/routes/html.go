@@ -12,7 +12,7 @@ import (
 )
 
 // SetupHTMLRoutes configures HTML-related routes
-func SetupHTMLRoutes(router *gin.Engine, cfg *config.Config) {
+func SetupHTMLRoutes(router *gin.Engine, cfg *config.Config, auth *middleware.Authenticator) {
 	// Dynamically load all HTML templates from the templates directory
 	var templatePaths []string
 
@@ -40,37 +40,46 @@ func SetupHTMLRoutes(router *gin.Engine, cfg *config.Config) {
 	// Serve static files
 	router.Static("/assets", "./web/assets")
 
+	// HTML pages get security headers, static assets don't need them
+	pages := router.Group("", middleware.SecurityHeaders())
+
 	// Initialize auth handler
-	authHandler := handlers.NewLoginHandler(cfg)
+	authHandler := handlers.NewLoginHandler(cfg, auth)
 	// Public routes (no authentication required)
-	router.GET("/login", authHandler.LoginForm)
-	router.GET("/logout", authHandler.Logout)
+	pages.GET("/login", authHandler.LoginForm)
+	pages.GET("/logout", authHandler.Logout)
+
+	// Single sign-on through the OpenID Connect provider
+	pages.GET("/auth/oidc/login", authHandler.OIDCLogin)
+	pages.GET("/auth/oidc/callback", authHandler.OIDCCallback)
 
 	// Protected routes (authentication required)
-	router.GET("/", middleware.AuthMiddleware(), func(c *gin.Context) {
+	requireLogin := auth.AuthMiddleware()
+
+	pages.GET("/", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "Dashboard.html", gin.H{})
 	})
 
 	// Cloudflare Account routes
-	router.GET("/cloudflare/accounts", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/cloudflare/accounts", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "CloudflareAccounts.html", gin.H{})
 	})
 
 	// Cloudflare Tunnel routes
-	router.GET("/cloudflare/tunnels", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/cloudflare/tunnels", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "CloudflareAllTunnels.html", gin.H{})
 	})
 
-	router.GET("/cloudflare/tunnels/create", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/cloudflare/tunnels/create", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "Cloudflare_CreateTunnel.html", gin.H{})
 	})
 
-	router.GET("/cloudflare/tunnels/hostnames", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/cloudflare/tunnels/hostnames", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "Cloudflare_TunnelPublicHostname.html", gin.H{})
 	})
 
 	// Docker Cloudflare Tunnels route
-	router.GET("/cloudflare/docker-tunnels", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/cloudflare/docker-tunnels", requireLogin, func(c *gin.Context) {
 		// Use the template-based version now that it's fixed
 		c.HTML(http.StatusOK, "DockerCloudflareTunnels.html", gin.H{})
 		// Keep standalone version commented in case it's needed for debugging
@@ -78,31 +87,31 @@ func SetupHTMLRoutes(router *gin.Engine, cfg *config.Config) {
 	})
 
 	// Cloudflare Zone routes
-	router.GET("/cloudflare/zones", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/cloudflare/zones", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "CloudflareZones.html", gin.H{})
 	})
 
-	router.GET("/cloudflare/zones/details", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/cloudflare/zones/details", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "CloudflareZoneDetails.html", gin.H{})
 	})
 
 	// Legacy routes for backward compatibility (optional - can be removed later)
-	router.GET("/CloudflareAccounts", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/CloudflareAccounts", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "CloudflareAccounts.html", gin.H{})
 	})
-	router.GET("/CloudflareAllTunnels", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/CloudflareAllTunnels", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "CloudflareAllTunnels.html", gin.H{})
 	})
-	router.GET("/Cloudflare_CreateTunnel", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/Cloudflare_CreateTunnel", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "Cloudflare_CreateTunnel.html", gin.H{})
 	})
-	router.GET("/Cloudflare_TunnelPublicHostname", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/Cloudflare_TunnelPublicHostname", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "Cloudflare_TunnelPublicHostname.html", gin.H{})
 	})
-	router.GET("/CloudflareZones", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/CloudflareZones", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "CloudflareZones.html", gin.H{})
 	})
-	router.GET("/CloudflareZoneDetails", middleware.AuthMiddleware(), func(c *gin.Context) {
+	pages.GET("/CloudflareZoneDetails", requireLogin, func(c *gin.Context) {
 		c.HTML(http.StatusOK, "CloudflareZoneDetails.html", gin.H{})
 	})
 
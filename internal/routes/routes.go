@@ -1,7 +1,11 @@
 package routes
 
 import (
+	"log"
+
 	"cfProxyHub/internal/config"
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,11 +15,79 @@ func SetupRoutes(router *gin.Engine) {
 	// Load config
 	cfg := config.LoadConfig()
 
+	// Only proxies in TRUSTED_PROXIES may set the client IP, Cloudflare's header is preferred
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.RemoteIPHeaders = []string{"CF-Connecting-IP", "X-Forwarded-For", "X-Real-IP"}
+
+	// Cross-origin requests are only answered for the configured origins
+	router.Use(middleware.CORS(cfg.CORSAllowedOrigins))
+
+	// Every browser gets a CSRF token to echo on state-changing API requests
+	router.Use(middleware.CSRFCookie(cfg))
+
+	// Audit trail of logins and of every change made through the API
+	audit, err := services.NewAuditLog(cfg.AuditLogPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize audit log: %v", err)
+	}
+	router.Use(middleware.AuditMutations(audit))
+
+	// Server-side session store shared by the login handlers and the auth middleware
+	sessions, err := services.NewSessionStore(cfg.SessionTTL, cfg.SessionIdleTimeout, cfg.SessionStorePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize session store: %v", err)
+	}
+
+	// Users allowed to log in, seeded with the admin from the config
+	users, err := services.NewUserStore(cfg.UserStorePath, cfg.AdminUsername, cfg.AdminPassword)
+	if err != nil {
+		log.Fatalf("Failed to initialize user store: %v", err)
+	}
+
+	// Personal API tokens accepted as Authorization: Bearer
+	tokens, err := services.NewAPITokenStore(cfg.APITokenStorePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize API token store: %v", err)
+	}
+
+	// Optional single sign-on through an OpenID Connect provider
+	oidcProvider, err := services.NewOIDCProvider(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize OIDC login: %v", err)
+	}
+
+	// Optional Cloudflare Access mode, replacing local logins
+	accessVerifier, err := services.NewCFAccessVerifier(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize Cloudflare Access authentication: %v", err)
+	}
+
+	auth := &middleware.Authenticator{
+		Sessions: sessions,
+		Users:    users,
+		Tokens:   tokens,
+		OIDC:     oidcProvider,
+		Access:   accessVerifier,
+		Limiter:  services.NewLoginLimiter(cfg.LoginMaxAttempts, cfg.LoginMaxAttemptsPerIP, cfg.LoginMaxLockout),
+		Audit:    audit,
+
+		Challenges: services.NewLoginChallengeStore(),
+	}
+
+	// Shared Docker container cache fed by the daemon's events stream
+	dockerWatcher := StartDockerWatcher()
+
 	// Setup different route groups
-	SetupAuthRoutes(router, cfg)                 // Authentication API endpoints (/api/auth/*)
-	SetupAPIRoutes(router, cfg)                  // Protected JSON API endpoints (/api/*)
-	SetupHTMLRoutes(router, cfg)                 // HTML pages
-	SetupCloudflareRoutes(router, cfg)           // Cloudflare-specific API endpoints
-	RegisterDockerRoutes(router)                 // Docker-related API endpoints
-	RegisterDockerCloudflareTunnelRoutes(router) // Docker-based Cloudflare Tunnel endpoints
+	SetupAuthRoutes(router, cfg, auth)                                // Authentication API endpoints (/api/auth/*)
+	SetupUserRoutes(router, auth)                                     // User management API endpoints (/api/users/*)
+	SetupAPITokenRoutes(router, auth)                                 // Personal API token endpoints (/api/tokens/*)
+	SetupAuditRoutes(router, auth)                                    // Audit log query and export (/api/audit)
+	SetupAPIRoutes(router, cfg, auth)                                 // Protected JSON API endpoints (/api/*)
+	SetupHTMLRoutes(router, cfg, auth)                                // HTML pages
+	SetupCloudflareRoutes(router, cfg, auth)                          // Cloudflare-specific API endpoints
+	RegisterDockerRoutes(router, auth)                                // Docker-related API endpoints
+	RegisterDockerCloudflareTunnelRoutes(router, dockerWatcher, auth) // Docker-based Cloudflare Tunnel endpoints
+	SetupDockerAutoExposeRoutes(router, cfg, dockerWatcher, auth)     // Label-driven container exposure (/api/docker/exposures)
 }
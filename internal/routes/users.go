@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"cfProxyHub/internal/handlers"
+	"cfProxyHub/internal/middleware"
+	"cfProxyHub/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupUserRoutes configures the user management API routes
+func SetupUserRoutes(router *gin.Engine, auth *middleware.Authenticator) {
+	userHandler := handlers.NewUserHandler(auth.Users, auth.Sessions, auth.Tokens)
+
+	usersGroup := router.Group("/api/users")
+	usersGroup.Use(auth.RequireAuth())
+
+	// Any authenticated user can see their own account
+	usersGroup.GET("/me", userHandler.GetCurrentUser)
+
+	// Managing users is reserved to admins
+	usersRead := middleware.Require(models.RoleAdmin, models.ScopeUsersRead)
+	usersWrite := middleware.Require(models.RoleAdmin, models.ScopeUsersWrite)
+	usersGroup.GET("", usersRead, userHandler.ListUsers)
+	usersGroup.POST("", usersWrite, userHandler.CreateUser)
+	usersGroup.GET("/:username", usersRead, userHandler.GetUser)
+	usersGroup.PUT("/:username", usersWrite, userHandler.UpdateUser)
+	usersGroup.DELETE("/:username", usersWrite, userHandler.DeleteUser)
+
+	// Admins reset the two-factor authentication of users who lost their authenticator
+	twoFactorHandler := handlers.NewTwoFactorHandler(auth.Users, auth.Sessions, auth.Audit)
+	usersGroup.DELETE("/:username/2fa", usersWrite, twoFactorHandler.ResetUser)
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cfProxyHub/internal/models"
+)
+
+var (
+	// ErrInvalidAPIToken is returned for tokens that are unknown, expired or revoked
+	ErrInvalidAPIToken = errors.New("invalid API token")
+	// ErrAPITokenNotFound is returned when revoking an unknown token
+	ErrAPITokenNotFound = errors.New("API token not found")
+)
+
+// apiTokenPrefix marks cfProxyHub tokens so they are easy to spot in scripts and secret scanners
+const apiTokenPrefix = "cfph_"
+
+// apiTokenRecord is a token as stored, keyed by the hash of its secret
+type apiTokenRecord struct {
+	models.APIToken
+	Hash string `json:"hash"`
+}
+
+// APITokenStore issues personal API tokens and checks them on use
+// Only SHA-256 hashes of the secrets are kept; tokens are optionally persisted to a JSON file
+type APITokenStore struct {
+	mu      sync.Mutex
+	tokens  map[string]*apiTokenRecord // by hash
+	path    string
+	savedAt time.Time
+}
+
+// NewAPITokenStore creates an API token store, an empty path keeps tokens in memory only
+func NewAPITokenStore(path string) (*APITokenStore, error) {
+	store := &APITokenStore{
+		tokens: make(map[string]*apiTokenRecord),
+		path:   path,
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Create issues a token for a user and returns its secret, which can't be retrieved again
+func (s *APITokenStore) Create(username string, req models.APITokenCreateRequest) (string, *models.APIToken, error) {
+	if err := req.Validate(); err != nil {
+		return "", nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate API token: %w", err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate API token: %w", err)
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	record := &apiTokenRecord{
+		APIToken: models.APIToken{
+			ID:        hex.EncodeToString(id),
+			Name:      req.Name,
+			Username:  username,
+			Scopes:    req.Scopes,
+			CreatedAt: now,
+			ExpiresAt: now.AddDate(0, 0, req.ExpiresInDays),
+		},
+		Hash: hashToken(token),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[record.Hash] = record
+	if err := s.saveLocked(); err != nil {
+		delete(s.tokens, record.Hash)
+		return "", nil, err
+	}
+
+	created := record.APIToken
+	return token, &created, nil
+}
+
+// Authenticate returns the token a secret belongs to and records its use
+func (s *APITokenStore) Authenticate(token string) (*models.APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.tokens[hashToken(token)]
+	if !ok {
+		return nil, ErrInvalidAPIToken
+	}
+
+	now := time.Now()
+	if now.After(record.ExpiresAt) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	record.LastUsedAt = &now
+	if s.path != "" && now.Sub(s.savedAt) > sessionTouchInterval {
+		if err := s.saveLocked(); err != nil {
+			log.Printf("Failed to save API tokens: %v", err)
+		}
+	}
+
+	used := record.APIToken
+	return &used, nil
+}
+
+// List returns the tokens of a user, or of all users when username is empty, newest first
+func (s *APITokenStore) List(username string) []models.APIToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := make([]models.APIToken, 0)
+	for _, record := range s.tokens {
+		if username == "" || record.Username == username {
+			tokens = append(tokens, record.APIToken)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens
+}
+
+// Revoke deletes a token by ID
+// With a non-empty username only that user's tokens can be revoked
+func (s *APITokenStore) Revoke(id, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, record := range s.tokens {
+		if record.ID != id {
+			continue
+		}
+		if username != "" && record.Username != username {
+			return ErrAPITokenNotFound
+		}
+		delete(s.tokens, hash)
+		if err := s.saveLocked(); err != nil {
+			s.tokens[hash] = record
+			return err
+		}
+		return nil
+	}
+	return ErrAPITokenNotFound
+}
+
+// RevokeUser deletes every token of a user and returns how many were deleted
+func (s *APITokenStore) RevokeUser(username string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revoked := 0
+	for hash, record := range s.tokens {
+		if record.Username == username {
+			delete(s.tokens, hash)
+			revoked++
+		}
+	}
+	if revoked == 0 {
+		return 0, nil
+	}
+	return revoked, s.saveLocked()
+}
+
+// load reads persisted tokens
+func (s *APITokenStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read API token store: %w", err)
+	}
+
+	var records []*apiTokenRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to parse API token store %s: %w", s.path, err)
+	}
+	for _, record := range records {
+		s.tokens[record.Hash] = record
+	}
+
+	log.Printf("Loaded %d API tokens from %s", len(s.tokens), s.path)
+	return nil
+}
+
+// saveLocked writes the tokens to the token file, if one is configured
+func (s *APITokenStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	records := make([]*apiTokenRecord, 0, len(s.tokens))
+	for _, record := range s.tokens {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode API tokens: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to save API tokens: %w", err)
+	}
+	s.savedAt = time.Now()
+	return nil
+}
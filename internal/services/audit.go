@@ -0,0 +1,159 @@
+package services
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cfProxyHub/internal/models"
+)
+
+// auditMemoryLimit caps the events kept in memory and answered by queries, the audit file keeps all of them
+const auditMemoryLimit = 10000
+
+// AuditLog records security relevant events
+// Events are kept in memory and, when a path is configured, appended to a JSON lines file
+type AuditLog struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+	file   *os.File
+}
+
+// NewAuditLog creates the audit log, an empty path keeps events in memory only
+func NewAuditLog(path string) (*AuditLog, error) {
+	audit := &AuditLog{}
+	if path == "" {
+		return audit, nil
+	}
+
+	if err := audit.load(path); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	audit.file = file
+	return audit, nil
+}
+
+// Record stores an event, filling in its ID and time
+// Failing to persist an event is logged rather than failing the request it describes
+func (a *AuditLog) Record(event models.AuditEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err == nil {
+		event.ID = hex.EncodeToString(id)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.events = append(a.events, event)
+	if len(a.events) > auditMemoryLimit {
+		a.events = a.events[len(a.events)-auditMemoryLimit:]
+	}
+
+	if a.file == nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode audit event: %v", err)
+		return
+	}
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write audit event: %v", err)
+	}
+}
+
+// load reads the most recent persisted events
+func (a *AuditLog) load(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event models.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.Printf("Skipping malformed audit event in %s: %v", path, err)
+			continue
+		}
+		a.events = append(a.events, event)
+		if len(a.events) > 2*auditMemoryLimit {
+			a.events = append([]models.AuditEvent(nil), a.events[len(a.events)-auditMemoryLimit:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if len(a.events) > auditMemoryLimit {
+		a.events = a.events[len(a.events)-auditMemoryLimit:]
+	}
+
+	log.Printf("Loaded %d audit events from %s", len(a.events), path)
+	return nil
+}
+
+// Query returns the events matching the filter, oldest first
+func (a *AuditLog) Query(filter models.AuditFilter) []models.AuditEvent {
+	action := strings.ToLower(filter.Action)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	matched := []models.AuditEvent{}
+	for _, event := range a.events {
+		if filter.Username != "" && !strings.EqualFold(event.Username, filter.Username) {
+			continue
+		}
+		if action != "" && !strings.Contains(strings.ToLower(event.Action), action) {
+			continue
+		}
+		if filter.Outcome != "" && event.Outcome != filter.Outcome {
+			continue
+		}
+		if filter.Target != "" && !hasAuditTarget(event, filter.Target) {
+			continue
+		}
+		if !filter.Since.IsZero() && event.Time.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && event.Time.After(filter.Until) {
+			continue
+		}
+		matched = append(matched, event)
+	}
+
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[len(matched)-filter.Limit:]
+	}
+	return matched
+}
+
+// hasAuditTarget reports whether an event acted on the target ID
+func hasAuditTarget(event models.AuditEvent, target string) bool {
+	for _, id := range event.Targets {
+		if strings.EqualFold(id, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cfProxyHub/internal/config"
+	"cfProxyHub/internal/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// CFAccessProvider is the user provider recorded for users signed in through Cloudflare Access
+const CFAccessProvider = "cloudflare-access"
+
+// ErrCFAccessNoRole is returned when an Access user's email maps to no role and there is no default role
+var ErrCFAccessNoRole = errors.New("email address is not granted a role")
+
+// CFAccessIdentity is a user authenticated by Cloudflare Access
+type CFAccessIdentity struct {
+	Email string
+	Role  models.Role
+}
+
+// CFAccessVerifier validates the Cf-Access-Jwt-Assertion header Cloudflare Access adds to every request
+// The JWT is signed with the team's keys and its audience is the Access application's AUD tag
+type CFAccessVerifier struct {
+	cfg      *config.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewCFAccessVerifier creates the verifier, returns nil when Cloudflare Access isn't configured
+// The signing keys are fetched from the team's certs endpoint, or CF_ACCESS_CERTS_URL when set
+func NewCFAccessVerifier(cfg *config.Config) (*CFAccessVerifier, error) {
+	if !cfg.CFAccessEnabled() {
+		return nil, nil
+	}
+	if cfg.CFAccessDefaultRole != "" && !models.Role(cfg.CFAccessDefaultRole).Valid() {
+		return nil, fmt.Errorf("CF_ACCESS_DEFAULT_ROLE must be viewer, operator or admin")
+	}
+
+	issuer := strings.TrimRight(cfg.CFAccessTeamDomain, "/")
+	if !strings.HasPrefix(issuer, "https://") && !strings.HasPrefix(issuer, "http://") {
+		issuer = "https://" + issuer
+	}
+	certsURL := cfg.CFAccessCertsURL
+	if certsURL == "" {
+		certsURL = issuer + "/cdn-cgi/access/certs"
+	}
+
+	keySet := oidc.NewRemoteKeySet(context.Background(), certsURL)
+	return &CFAccessVerifier{
+		cfg:      cfg,
+		verifier: oidc.NewVerifier(issuer, keySet, &oidc.Config{ClientID: cfg.CFAccessAudience}),
+	}, nil
+}
+
+// Verify checks an Access JWT and maps its email claim to a role
+func (v *CFAccessVerifier) Verify(ctx context.Context, assertion string) (*CFAccessIdentity, error) {
+	token, err := v.verifier.Verify(ctx, assertion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Cloudflare Access token: %w", err)
+	}
+
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse Cloudflare Access token claims: %w", err)
+	}
+	// Service tokens carry no email and can't act as a user
+	if claims.Email == "" {
+		return nil, fmt.Errorf("Cloudflare Access token has no email claim")
+	}
+	email := strings.ToLower(claims.Email)
+
+	role, ok := v.mapRole(email)
+	if !ok {
+		return nil, ErrCFAccessNoRole
+	}
+	return &CFAccessIdentity{
+		Email: email,
+		Role:  role,
+	}, nil
+}
+
+// mapRole returns the highest role whose email patterns match, or the default role
+func (v *CFAccessVerifier) mapRole(email string) (models.Role, bool) {
+	for _, entry := range []groupRole{
+		{models.RoleAdmin, v.cfg.CFAccessAdminEmails},
+		{models.RoleOperator, v.cfg.CFAccessOperatorEmails},
+		{models.RoleViewer, v.cfg.CFAccessViewerEmails},
+	} {
+		for _, pattern := range entry.groups {
+			if matchEmail(pattern, email) {
+				return entry.role, true
+			}
+		}
+	}
+	if role := models.Role(v.cfg.CFAccessDefaultRole); role.Valid() {
+		return role, true
+	}
+	return "", false
+}
+
+// matchEmail matches an address against alice@example.com, or @example.com and *@example.com for a whole domain
+func matchEmail(pattern, email string) bool {
+	pattern = strings.ToLower(strings.TrimPrefix(pattern, "*"))
+	if strings.HasPrefix(pattern, "@") {
+		return strings.HasSuffix(email, pattern)
+	}
+	return pattern == email
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cfProxyHub/internal/config"
+	"cfProxyHub/internal/models"
+)
+
+const (
+	testAccessTeam     = "https://team.cloudflareaccess.com"
+	testAccessAudience = "aud-tag-of-the-application"
+)
+
+// newTestCFAccessVerifier creates a verifier reading its keys from a local JWKS through CF_ACCESS_CERTS_URL
+func newTestCFAccessVerifier(t *testing.T, configure func(*config.Config)) (*CFAccessVerifier, *testSigner) {
+	t.Helper()
+	signer := newTestSigner(t)
+	server := httptest.NewServer(http.HandlerFunc(signer.serveJWKS))
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		CFAccessTeamDomain:     "team.cloudflareaccess.com",
+		CFAccessAudience:       testAccessAudience,
+		CFAccessCertsURL:       server.URL,
+		CFAccessAdminEmails:    []string{"alice@example.com"},
+		CFAccessOperatorEmails: []string{"*@ops.example.com"},
+		CFAccessViewerEmails:   []string{"@example.com"},
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	verifier, err := NewCFAccessVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewCFAccessVerifier: %v", err)
+	}
+	return verifier, signer
+}
+
+// accessAssertion signs an Access JWT, the claims override the defaults of a valid one
+func accessAssertion(t *testing.T, signer *testSigner, claims map[string]any) string {
+	t.Helper()
+	full := map[string]any{
+		"iss":   testAccessTeam,
+		"aud":   []string{testAccessAudience},
+		"sub":   "user-1",
+		"email": "alice@example.com",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		if value == nil {
+			delete(full, name)
+			continue
+		}
+		full[name] = value
+	}
+	assertion, err := signer.sign(full)
+	if err != nil {
+		t.Fatalf("sign assertion: %v", err)
+	}
+	return assertion
+}
+
+func TestCFAccessVerify(t *testing.T) {
+	verifier, signer := newTestCFAccessVerifier(t, nil)
+
+	identity, err := verifier.Verify(context.Background(), accessAssertion(t, signer, map[string]any{"email": "Alice@Example.com"}))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if identity.Email != "alice@example.com" || identity.Role != models.RoleAdmin {
+		t.Errorf("identity = %+v, want alice@example.com as admin", identity)
+	}
+}
+
+func TestCFAccessVerifyRejects(t *testing.T) {
+	verifier, signer := newTestCFAccessVerifier(t, nil)
+	other := newTestSigner(t)
+
+	tests := []struct {
+		name      string
+		assertion string
+		want      string
+	}{
+		{"wrong audience", accessAssertion(t, signer, map[string]any{"aud": []string{"another-application"}}), "audience"},
+		{"wrong issuer", accessAssertion(t, signer, map[string]any{"iss": "https://other.cloudflareaccess.com"}), "different provider"},
+		{"expired", accessAssertion(t, signer, map[string]any{"exp": time.Now().Add(-time.Minute).Unix()}), "expired"},
+		{"unknown key", accessAssertion(t, other, nil), "signature"},
+		{"service token without email", accessAssertion(t, signer, map[string]any{"email": nil, "common_name": "client-id.access"}), "no email claim"},
+		{"not a JWT", "not-a-jwt", "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), tt.assertion)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCFAccessVerifyRoles(t *testing.T) {
+	verifier, signer := newTestCFAccessVerifier(t, nil)
+
+	tests := []struct {
+		email string
+		want  models.Role
+	}{
+		{"alice@example.com", models.RoleAdmin},
+		{"bob@ops.example.com", models.RoleOperator},
+		{"carol@example.com", models.RoleViewer},
+	}
+	for _, tt := range tests {
+		identity, err := verifier.Verify(context.Background(), accessAssertion(t, signer, map[string]any{"email": tt.email}))
+		if err != nil {
+			t.Errorf("%s: %v", tt.email, err)
+			continue
+		}
+		if identity.Role != tt.want {
+			t.Errorf("%s: role %q, want %q", tt.email, identity.Role, tt.want)
+		}
+	}
+
+	if _, err := verifier.Verify(context.Background(), accessAssertion(t, signer, map[string]any{"email": "mallory@example.org"})); !errors.Is(err, ErrCFAccessNoRole) {
+		t.Errorf("unlisted email: got %v, want ErrCFAccessNoRole", err)
+	}
+}
+
+func TestCFAccessVerifyDefaultRole(t *testing.T) {
+	verifier, signer := newTestCFAccessVerifier(t, func(cfg *config.Config) {
+		cfg.CFAccessDefaultRole = string(models.RoleViewer)
+	})
+
+	identity, err := verifier.Verify(context.Background(), accessAssertion(t, signer, map[string]any{"email": "mallory@example.org"}))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if identity.Role != models.RoleViewer {
+		t.Errorf("role %q, want the default viewer", identity.Role)
+	}
+}
+
+func TestMatchEmail(t *testing.T) {
+	tests := []struct {
+		pattern string
+		email   string
+		want    bool
+	}{
+		{"alice@example.com", "alice@example.com", true},
+		{"Alice@Example.com", "alice@example.com", true},
+		{"alice@example.com", "bob@example.com", false},
+		{"@example.com", "bob@example.com", true},
+		{"*@example.com", "bob@example.com", true},
+		{"@example.com", "bob@sub.example.com", false},
+		{"@example.com", "bob@notexample.com", false},
+		{"*@example.com", "bob@example.com.evil.org", false},
+		{"example.com", "bob@example.com", false},
+	}
+	for _, tt := range tests {
+		if got := matchEmail(tt.pattern, tt.email); got != tt.want {
+			t.Errorf("matchEmail(%q, %q) = %v, want %v", tt.pattern, tt.email, got, tt.want)
+		}
+	}
+}
@@ -2,13 +2,17 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 
 	"cfProxyHub/internal/models"
 
 	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/option"
 	"github.com/cloudflare/cloudflare-go/v4/zero_trust"
 )
 
@@ -55,6 +59,18 @@ func (cs *CloudflareService) GetCloudflareTunnelByID(ctx context.Context, accoun
 	return *tunnel, nil
 }
 
+// ErrHostnameExists is returned when a hostname is already routed by this or another tunnel
+var ErrHostnameExists = errors.New("hostname already exists")
+
+// ErrHostnameNotFound is returned when a tunnel has no rule for the targeted hostname and path
+var ErrHostnameNotFound = errors.New("hostname not found")
+
+// ErrTunnelHasConnections is returned when a tunnel can't be deleted because cloudflared connectors are still registered
+var ErrTunnelHasConnections = errors.New("tunnel has active connections")
+
+// tunnelHasConnectionsCode is the Cloudflare API error code of a delete refused for active connections
+const tunnelHasConnectionsCode = 1022
+
 // CreateCloudflareTunnel creates a new tunnel
 func (cs *CloudflareService) CreateCloudflareTunnel(ctx context.Context, accountID string, request models.TunnelCreateRequest) (models.TunnelNewResponse, error) {
 	if accountID == "" {
@@ -105,12 +121,35 @@ func (cs *CloudflareService) DeleteCloudflareTunnel(ctx context.Context, account
 		AccountID: cloudflare.F(accountID),
 	})
 	if err != nil {
+		if isTunnelHasConnectionsError(err) {
+			return fmt.Errorf("%w: tunnel %s in account %s: %v", ErrTunnelHasConnections, tunnelID, accountID, err)
+		}
 		return fmt.Errorf("error deleting tunnel %s for account %s: %w", tunnelID, accountID, err)
 	}
 
 	return nil
 }
 
+// isNotFoundError reports whether a Cloudflare API call failed because the resource doesn't exist
+func isNotFoundError(err error) bool {
+	var apiErr *cloudflare.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// isTunnelHasConnectionsError reports whether Cloudflare refused a tunnel delete because connectors are still registered
+func isTunnelHasConnectionsError(err error) bool {
+	var apiErr *cloudflare.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, e := range apiErr.Errors {
+		if e.Code == tunnelHasConnectionsCode || strings.Contains(strings.ToLower(e.Message), "active connections") {
+			return true
+		}
+	}
+	return false
+}
+
 // GetCloudflareTunnelToken retrieves a token for a specific tunnel
 func (cs *CloudflareService) GetCloudflareTunnelToken(ctx context.Context, accountID, tunnelID string) (string, error) {
 	if accountID == "" {
@@ -127,13 +166,20 @@ func (cs *CloudflareService) GetCloudflareTunnelToken(ctx context.Context, accou
 		return "", fmt.Errorf("error getting token for tunnel %s in account %s: %w", tunnelID, accountID, err)
 	}
 
-	// The token response might be an array or string, handle both cases
-	if tokenResponse != nil {
-		// For now, return a simple string representation
-		return fmt.Sprintf("%v", tokenResponse), nil
+	// The SDK returns a pointer to the token; formatting the pointer itself yields its address
+	if tokenResponse == nil || strings.TrimSpace(*tokenResponse) == "" {
+		return "", fmt.Errorf("Cloudflare returned no token for tunnel %s in account %s", tunnelID, accountID)
 	}
+	token := strings.Trim(strings.TrimSpace(*tokenResponse), `"`)
 
-	return "", nil
+	// Catch a token for the wrong tunnel before it's handed to cloudflared
+	if id, err := TunnelIDFromToken(token); err != nil {
+		return "", fmt.Errorf("unexpected token returned for tunnel %s in account %s: %w", tunnelID, accountID, err)
+	} else if !strings.EqualFold(id, tunnelID) {
+		return "", fmt.Errorf("token returned for tunnel %s in account %s runs tunnel %s", tunnelID, accountID, id)
+	}
+
+	return token, nil
 }
 
 // ListCloudflareTunnelsWithParams retrieves tunnels with specific parameters
@@ -191,7 +237,7 @@ func (cs *CloudflareService) GetCloudflareTunnelPublicHostnames(ctx context.Cont
 }
 
 // CreateCloudflareTunnelPublicHostname creates a new public hostname (ingress rule) for a specific tunnel
-func (cs *CloudflareService) CreateCloudflareTunnelPublicHostname(ctx context.Context, accountID, tunnelID string, hostname models.PublicHostnameIngressParam) (models.TunnelConfigurationUpdateResponse, error) {
+func (cs *CloudflareService) CreateCloudflareTunnelPublicHostname(ctx context.Context, accountID, tunnelID string, hostname models.PublicHostnameRule) (models.TunnelConfigurationUpdateResponse, error) {
 	if accountID == "" {
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("account ID is required")
 	}
@@ -199,88 +245,50 @@ func (cs *CloudflareService) CreateCloudflareTunnelPublicHostname(ctx context.Co
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("tunnel ID is required")
 	}
 
-	// TODO: Add domain validation once we figure out the field access pattern
-	// For now, we'll rely on Cloudflare's built-in validation
-	//
-	// Example of what we want to do:
-	// hostnameValue := hostname.Hostname.ValueOrZero()
-	// if hostnameValue != "" {
-	//     if err := cs.validateDomainOwnership(ctx, accountID, hostnameValue); err != nil {
-	//         return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("domain validation failed: %w", err)
-	//     }
-	// }
-
-	// TODO: Add domain validation for updated hostname once we understand field access pattern
-	// For now, we'll rely on Cloudflare's built-in validation
-
-	// First, get the current configuration
-	currentConfig, err := cs.client.ZeroTrust.Tunnels.Cloudflared.Configurations.Get(ctx, tunnelID, zero_trust.TunnelCloudflaredConfigurationGetParams{
-		AccountID: cloudflare.F(accountID),
-	})
-	if err != nil {
-		// If configuration doesn't exist, start with an empty one
-		fmt.Printf("Warning: Could not get existing configuration (this is normal for new tunnels): %v\n", err)
-		currentConfig = &zero_trust.TunnelCloudflaredConfigurationGetResponse{
-			Config: zero_trust.TunnelCloudflaredConfigurationGetResponseConfig{},
-		}
-	}
-
-	// Check if hostname already exists
-	if currentConfig.Config.Ingress != nil {
-		// TODO: Fix hostname comparison once we understand the field access pattern
-		// For now, we'll skip the duplicate check and rely on Cloudflare's validation
+	hostnameValue := hostname.Param.Hostname.Value
+	if err := cs.validateNewHostname(ctx, accountID, tunnelID, hostnameValue); err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, err
 	}
 
-	// Create the new ingress rules array with the new hostname
-	var newIngress []models.PublicHostnameIngressParam
+	unlock := lockTunnelConfig(tunnelID)
+	defer unlock()
 
-	// Add existing ingress rules (excluding any catch-all rules)
-	if currentConfig != nil && currentConfig.Config.Ingress != nil {
-		for _, existing := range currentConfig.Config.Ingress {
-			// Skip catch-all rules (rules without hostname)
-			if existing.Hostname != "" {
-				existingRule := models.PublicHostnameIngressParam{
-					Hostname:      cloudflare.F(existing.Hostname),
-					Service:       cloudflare.F(existing.Service),
-					OriginRequest: cloudflare.F(zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequest{}),
-				}
-				if existing.Path != "" {
-					existingRule.Path = cloudflare.F(existing.Path)
-				}
-				newIngress = append(newIngress, existingRule)
-			}
-		}
+	// First, get the current configuration. Only a tunnel without one starts empty, any other
+	// error would otherwise overwrite the rules that couldn't be read
+	currentConfig, err := cs.getTunnelConfiguration(ctx, accountID, tunnelID)
+	if isNotFoundError(err) {
+		log.Printf("Tunnel %s has no configuration yet, starting with an empty one", tunnelID)
+		currentConfig = &models.TunnelConfiguration{}
+	} else if err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("error getting current tunnel configuration for tunnel %s in account %s: %w", tunnelID, accountID, err)
 	}
-
-	// Add the new hostname
-	newIngress = append(newIngress, hostname)
-
-	// Always add a catch-all rule at the end (required by Cloudflare)
-	// This rule will return a 404 for any hostname that doesn't match the rules above
-	catchAllRule := models.PublicHostnameIngressParam{
-		Service: cloudflare.F("http_status:404"),
+	if err := checkConfigVersion(ctx, tunnelID, currentConfig); err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, err
 	}
-	newIngress = append(newIngress, catchAllRule)
 
-	// Update the tunnel configuration
-	updateParams := zero_trust.TunnelCloudflaredConfigurationUpdateParams{
-		AccountID: cloudflare.F(accountID),
-		Config: cloudflare.F(zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfig{
-			Ingress: cloudflare.F(newIngress),
-		}),
+	// Keep every existing rule as it is and add the new hostname in front of the catch-all
+	existingRules, catchAll := splitTunnelIngress(currentConfig.Config.Ingress)
+	if err := checkDuplicateRule(existingRules, hostnameValue, hostname.Param.Path.Value, -1); err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, err
 	}
+	newIngress := make([]models.PublicHostnameRule, 0, len(existingRules)+1)
+	for _, existing := range existingRules {
+		newIngress = append(newIngress, models.NewPublicHostnameRuleFromIngress(existing))
+	}
+	newIngress = append(newIngress, hostname)
 
-	updatedConfig, err := cs.client.ZeroTrust.Tunnels.Cloudflared.Configurations.Update(ctx, tunnelID, updateParams)
+	updatedConfig, err := cs.writeTunnelIngress(ctx, accountID, tunnelID, currentConfig, newIngress, catchAll)
 	if err != nil {
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("error creating public hostname for tunnel %s in account %s: %w", tunnelID, accountID, err)
 	}
 
-	return *updatedConfig, nil
+	return updatedConfig, nil
 }
 
 // UpdateCloudflareTunnelPublicHostname updates a specific public hostname (ingress rule) for a tunnel
-func (cs *CloudflareService) UpdateCloudflareTunnelPublicHostname(ctx context.Context, accountID, tunnelID, targetHostname string, updatedHostname models.PublicHostnameIngressParam) (models.TunnelConfigurationUpdateResponse, error) {
-	log.Printf("UpdateCloudflareTunnelPublicHostname called with accountID: %s, tunnelID: %s, targetHostname: %s", accountID, tunnelID, targetHostname)
+// The rule is identified by its hostname and path, other paths of the same hostname are left alone
+func (cs *CloudflareService) UpdateCloudflareTunnelPublicHostname(ctx context.Context, accountID, tunnelID, targetHostname, targetPath string, updatedHostname models.PublicHostnameRule) (models.TunnelConfigurationUpdateResponse, error) {
+	log.Printf("UpdateCloudflareTunnelPublicHostname called with accountID: %s, tunnelID: %s, targetHostname: %s, targetPath: %s", accountID, tunnelID, targetHostname, targetPath)
 
 	if accountID == "" {
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("account ID is required")
@@ -292,89 +300,65 @@ func (cs *CloudflareService) UpdateCloudflareTunnelPublicHostname(ctx context.Co
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("target hostname is required")
 	}
 
+	newHostnameValue := updatedHostname.Param.Hostname.Value
+	if newHostnameValue != targetHostname {
+		if err := cs.validateNewHostname(ctx, accountID, tunnelID, newHostnameValue); err != nil {
+			return models.TunnelConfigurationUpdateResponse{}, err
+		}
+	}
+
+	unlock := lockTunnelConfig(tunnelID)
+	defer unlock()
+
 	log.Printf("Getting current tunnel configuration...")
 
 	// Get the current configuration
-	currentConfig, err := cs.client.ZeroTrust.Tunnels.Cloudflared.Configurations.Get(ctx, tunnelID, zero_trust.TunnelCloudflaredConfigurationGetParams{
-		AccountID: cloudflare.F(accountID),
-	})
+	currentConfig, err := cs.getTunnelConfiguration(ctx, accountID, tunnelID)
 	if err != nil {
 		log.Printf("Error getting current tunnel configuration: %v", err)
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("error getting current tunnel configuration for tunnel %s in account %s: %w", tunnelID, accountID, err)
 	}
-
-	log.Printf("Current configuration retrieved successfully, processing ingress rules...")
-
-	// Create the new ingress rules array with the updated hostname
-	var newIngress []models.PublicHostnameIngressParam
-	found := false
-
-	if currentConfig.Config.Ingress != nil {
-		log.Printf("Found %d existing ingress rules", len(currentConfig.Config.Ingress))
-		for i, existing := range currentConfig.Config.Ingress {
-			log.Printf("Rule %d: hostname=%s, service=%s", i, existing.Hostname, existing.Service)
-
-			// Skip catch-all rules (rules without hostname)
-			if existing.Hostname == "" {
-				log.Printf("Skipping catch-all rule %d", i)
-				continue
-			}
-
-			if existing.Hostname == targetHostname {
-				log.Printf("Found target hostname %s at rule %d, replacing with updated hostname", targetHostname, i)
-				// Replace with the updated hostname
-				newIngress = append(newIngress, updatedHostname)
-				found = true
-			} else {
-				log.Printf("Keeping existing rule %d: %s", i, existing.Hostname)
-				// Keep existing
-				newIngress = append(newIngress, models.PublicHostnameIngressParam{
-					Hostname:      cloudflare.F(existing.Hostname),
-					Service:       cloudflare.F(existing.Service),
-					Path:          cloudflare.F(existing.Path),
-					OriginRequest: cloudflare.F(zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequest{}),
-				})
-			}
-		}
-	} else {
-		log.Printf("No existing ingress rules found")
+	if err := checkConfigVersion(ctx, tunnelID, currentConfig); err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, err
 	}
 
-	if !found {
-		log.Printf("Target hostname %s not found in tunnel %s", targetHostname, tunnelID)
-		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("hostname %s not found in tunnel %s", targetHostname, tunnelID)
+	// Create the new ingress rules array with the updated hostname
+	existingRules, catchAll := splitTunnelIngress(currentConfig.Config.Ingress)
+	log.Printf("Found %d existing ingress rules", len(existingRules))
+	target := findHostnameRule(existingRules, targetHostname, targetPath)
+	if target < 0 {
+		log.Printf("Target hostname %s with path %q not found in tunnel %s", targetHostname, targetPath, tunnelID)
+		return models.TunnelConfigurationUpdateResponse{}, hostnameNotFoundError(tunnelID, targetHostname, targetPath)
+	}
+	if err := checkDuplicateRule(existingRules, newHostnameValue, updatedHostname.Param.Path.Value, target); err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, err
 	}
 
-	log.Printf("Successfully found and updated target hostname, adding catch-all rule")
-
-	// Always add a catch-all rule at the end (required by Cloudflare)
-	catchAllRule := models.PublicHostnameIngressParam{
-		Service: cloudflare.F("http_status:404"),
+	log.Printf("Found target hostname %s at rule %d, replacing with updated hostname", targetHostname, target)
+	newIngress := make([]models.PublicHostnameRule, 0, len(existingRules))
+	for i, existing := range existingRules {
+		if i == target {
+			newIngress = append(newIngress, keepOriginRequest(updatedHostname, existing))
+			continue
+		}
+		newIngress = append(newIngress, models.NewPublicHostnameRuleFromIngress(existing))
 	}
-	newIngress = append(newIngress, catchAllRule)
-
-	log.Printf("Updating tunnel configuration with %d total rules", len(newIngress))
 
-	// Update the tunnel configuration
-	updateParams := zero_trust.TunnelCloudflaredConfigurationUpdateParams{
-		AccountID: cloudflare.F(accountID),
-		Config: cloudflare.F(zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfig{
-			Ingress: cloudflare.F(newIngress),
-		}),
-	}
+	log.Printf("Updating tunnel configuration with %d hostname rules", len(newIngress))
 
-	updatedConfig, err := cs.client.ZeroTrust.Tunnels.Cloudflared.Configurations.Update(ctx, tunnelID, updateParams)
+	updatedConfig, err := cs.writeTunnelIngress(ctx, accountID, tunnelID, currentConfig, newIngress, catchAll)
 	if err != nil {
 		log.Printf("Error updating tunnel configuration: %v", err)
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("error updating public hostname for tunnel %s in account %s: %w", tunnelID, accountID, err)
 	}
 
 	log.Printf("Successfully updated tunnel configuration")
-	return *updatedConfig, nil
+	return updatedConfig, nil
 }
 
 // DeleteCloudflareTunnelPublicHostname deletes a specific public hostname (ingress rule) from a tunnel
-func (cs *CloudflareService) DeleteCloudflareTunnelPublicHostname(ctx context.Context, accountID, tunnelID, targetHostname string) (models.TunnelConfigurationUpdateResponse, error) {
+// The rule is identified by its hostname and path, other paths of the same hostname are left alone
+func (cs *CloudflareService) DeleteCloudflareTunnelPublicHostname(ctx context.Context, accountID, tunnelID, targetHostname, targetPath string) (models.TunnelConfigurationUpdateResponse, error) {
 	if accountID == "" {
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("account ID is required")
 	}
@@ -385,67 +369,275 @@ func (cs *CloudflareService) DeleteCloudflareTunnelPublicHostname(ctx context.Co
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("target hostname is required")
 	}
 
+	unlock := lockTunnelConfig(tunnelID)
+	defer unlock()
+
 	// Get the current configuration
-	currentConfig, err := cs.client.ZeroTrust.Tunnels.Cloudflared.Configurations.Get(ctx, tunnelID, zero_trust.TunnelCloudflaredConfigurationGetParams{
-		AccountID: cloudflare.F(accountID),
-	})
+	currentConfig, err := cs.getTunnelConfiguration(ctx, accountID, tunnelID)
+	if err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("error getting current tunnel configuration for tunnel %s in account %s: %w", tunnelID, accountID, err)
+	}
+	if err := checkConfigVersion(ctx, tunnelID, currentConfig); err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, err
+	}
+
+	// Create the new ingress rules array without the target rule
+	existingRules, catchAll := splitTunnelIngress(currentConfig.Config.Ingress)
+	target := findHostnameRule(existingRules, targetHostname, targetPath)
+	if target < 0 {
+		return models.TunnelConfigurationUpdateResponse{}, hostnameNotFoundError(tunnelID, targetHostname, targetPath)
+	}
+
+	newIngress := make([]models.PublicHostnameRule, 0, len(existingRules))
+	for i, existing := range existingRules {
+		if i == target {
+			continue
+		}
+		newIngress = append(newIngress, models.NewPublicHostnameRuleFromIngress(existing))
+	}
+
+	updatedConfig, err := cs.writeTunnelIngress(ctx, accountID, tunnelID, currentConfig, newIngress, catchAll)
 	if err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("error deleting public hostname for tunnel %s in account %s: %w", tunnelID, accountID, err)
+	}
+
+	return updatedConfig, nil
+}
+
+// ReplaceCloudflareTunnelIngress overwrites the complete ingress of a tunnel with the given rules
+// The catch-all service is appended as the last rule and defaults to http_status:404
+// Tunnel-wide settings and the options of an unchanged catch-all rule are kept
+func (cs *CloudflareService) ReplaceCloudflareTunnelIngress(ctx context.Context, accountID, tunnelID string, rules []models.PublicHostnameRule, catchAllService string) (models.TunnelConfigurationUpdateResponse, error) {
+	if accountID == "" {
+		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("account ID is required")
+	}
+	if tunnelID == "" {
+		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("tunnel ID is required")
+	}
+	if catchAllService == "" {
+		catchAllService = "http_status:404"
+	}
+
+	unlock := lockTunnelConfig(tunnelID)
+	defer unlock()
+
+	currentConfig, err := cs.getTunnelConfiguration(ctx, accountID, tunnelID)
+	if isNotFoundError(err) {
+		// Nothing to preserve on a tunnel without configuration
+		currentConfig = &models.TunnelConfiguration{}
+	} else if err != nil {
 		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("error getting current tunnel configuration for tunnel %s in account %s: %w", tunnelID, accountID, err)
 	}
+	if err := checkConfigVersion(ctx, tunnelID, currentConfig); err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, err
+	}
+
+	_, catchAll := splitTunnelIngress(currentConfig.Config.Ingress)
+	if catchAll == nil || catchAll.Service != catchAllService {
+		catchAll = &models.PublicHostnameIngress{Service: catchAllService}
+	}
+
+	updatedConfig, err := cs.writeTunnelIngress(ctx, accountID, tunnelID, currentConfig, rules, catchAll)
+	if err != nil {
+		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("error replacing ingress for tunnel %s in account %s: %w", tunnelID, accountID, err)
+	}
+
+	return updatedConfig, nil
+}
 
-	// Create the new ingress rules array without the target hostname
-	var newIngress []models.PublicHostnameIngressParam
-	found := false
+// validateNewHostname refuses hostnames outside the account's zones and hostnames another tunnel already routes
+func (cs *CloudflareService) validateNewHostname(ctx context.Context, accountID, tunnelID, hostname string) error {
+	if err := cs.validateDomainOwnership(ctx, accountID, hostname); err != nil {
+		return fmt.Errorf("domain validation failed: %w", err)
+	}
+
+	routed, err := cs.otherTunnelHostnames(ctx, accountID, tunnelID)
+	if err != nil {
+		return fmt.Errorf("failed to check hostname %s against other tunnels: %w", hostname, err)
+	}
+	if tunnel, ok := routed[strings.ToLower(hostname)]; ok {
+		return fmt.Errorf("%w: %s is routed by tunnel %s", ErrHostnameExists, hostname, tunnel)
+	}
+
+	return nil
+}
+
+// otherTunnelHostnames maps the hostnames routed by the account's other tunnels to the name and ID of their tunnel
+// Tunnels whose configuration can't be read are skipped with a warning
+func (cs *CloudflareService) otherTunnelHostnames(ctx context.Context, accountID, tunnelID string) (map[string]string, error) {
+	tunnels, err := cs.GetCloudflareTunnels(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
 
-	if currentConfig.Config.Ingress != nil {
-		for _, existing := range currentConfig.Config.Ingress {
-			// Skip catch-all rules (rules without hostname)
-			if existing.Hostname == "" {
-				continue
+	routed := make(map[string]string)
+	for _, tunnel := range tunnels {
+		if tunnel.ID == tunnelID || !tunnel.RemoteConfig {
+			continue
+		}
+
+		config, err := cs.getTunnelConfiguration(ctx, accountID, tunnel.ID)
+		if err != nil {
+			log.Printf("Warning: Could not read configuration of tunnel %s while checking hostnames: %v", tunnel.ID, err)
+			continue
+		}
+		for _, rule := range config.Config.Ingress {
+			if rule.Hostname != "" {
+				routed[strings.ToLower(rule.Hostname)] = fmt.Sprintf("%s (%s)", tunnel.Name, tunnel.ID)
 			}
+		}
+	}
+	return routed, nil
+}
 
-			if existing.Hostname != targetHostname {
-				// Keep this hostname
-				newIngress = append(newIngress, models.PublicHostnameIngressParam{
-					Hostname:      cloudflare.F(existing.Hostname),
-					Service:       cloudflare.F(existing.Service),
-					Path:          cloudflare.F(existing.Path),
-					OriginRequest: cloudflare.F(zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfigIngressOriginRequest{}),
-				})
-			} else {
-				found = true
+// findHostnameRule returns the index of the rule with the hostname and path, -1 if there is none
+func findHostnameRule(rules []models.PublicHostnameIngress, hostname, path string) int {
+	for i, rule := range rules {
+		if strings.EqualFold(rule.Hostname, hostname) && rule.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// hostnameNotFoundError reports a hostname and path the tunnel has no rule for
+func hostnameNotFoundError(tunnelID, hostname, path string) error {
+	if path == "" {
+		return fmt.Errorf("%w: %s in tunnel %s", ErrHostnameNotFound, hostname, tunnelID)
+	}
+	return fmt.Errorf("%w: %s%s in tunnel %s", ErrHostnameNotFound, hostname, path, tunnelID)
+}
+
+// routesHostname reports whether any rule of an updated ingress still routes the hostname, on any path
+func routesHostname(ingress []zero_trust.TunnelCloudflaredConfigurationUpdateResponseConfigIngress, hostname string) bool {
+	for _, rule := range ingress {
+		if strings.EqualFold(rule.Hostname, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDuplicateRule refuses a hostname and path another rule of the tunnel already matches
+// The rule at index replaced is ignored, -1 checks against every rule
+func checkDuplicateRule(rules []models.PublicHostnameIngress, hostname, path string, replaced int) error {
+	for i, rule := range rules {
+		if i == replaced {
+			continue
+		}
+		if strings.EqualFold(rule.Hostname, hostname) && rule.Path == path {
+			if path == "" {
+				return fmt.Errorf("%w: %s is already routed by this tunnel", ErrHostnameExists, hostname)
 			}
+			return fmt.Errorf("%w: %s%s is already routed by this tunnel", ErrHostnameExists, hostname, path)
 		}
 	}
+	return nil
+}
 
-	if !found {
-		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("hostname %s not found in tunnel %s", targetHostname, tunnelID)
+// keepOriginRequest carries the origin request options of the existing rule over to its replacement
+// when the update doesn't set any, so editing a hostname's service doesn't reset them
+func keepOriginRequest(updated models.PublicHostnameRule, existing models.PublicHostnameIngress) models.PublicHostnameRule {
+	if updated.Param.OriginRequest.Present {
+		return updated
 	}
 
-	// Always add a catch-all rule at the end (required by Cloudflare)
-	catchAllRule := models.PublicHostnameIngressParam{
-		Service: cloudflare.F("http_status:404"),
+	kept := models.NewPublicHostnameRuleFromIngress(existing)
+	updated.Param.OriginRequest = kept.Param.OriginRequest
+	extra := make(map[string]json.RawMessage, len(updated.Extra))
+	for path, raw := range updated.Extra {
+		extra[path] = raw
+	}
+	for path, raw := range kept.Extra {
+		if strings.HasPrefix(path, "originRequest.") {
+			extra[path] = raw
+		}
+	}
+	updated.Extra = extra
+	return updated
+}
+
+// splitTunnelIngress separates the hostname rules of a configuration from its catch-all rule
+// The catch-all is the last rule if it matches any hostname and path; nil if there is none
+func splitTunnelIngress(ingress []models.PublicHostnameIngress) ([]models.PublicHostnameIngress, *models.PublicHostnameIngress) {
+	if len(ingress) == 0 {
+		return nil, nil
+	}
+
+	last := ingress[len(ingress)-1]
+	if last.Hostname != "" || last.Path != "" {
+		return ingress, nil
+	}
+	return ingress[:len(ingress)-1], &last
+}
+
+// GetCloudflareTunnelConfiguration retrieves the configuration of a tunnel, including its version
+func (cs *CloudflareService) GetCloudflareTunnelConfiguration(ctx context.Context, accountID, tunnelID string) (*models.TunnelConfiguration, error) {
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if tunnelID == "" {
+		return nil, fmt.Errorf("tunnel ID is required")
 	}
-	newIngress = append(newIngress, catchAllRule)
 
-	// Update the tunnel configuration
-	updateParams := zero_trust.TunnelCloudflaredConfigurationUpdateParams{
+	config, err := cs.getTunnelConfiguration(ctx, accountID, tunnelID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tunnel configuration for tunnel %s in account %s: %w", tunnelID, accountID, err)
+	}
+
+	return config, nil
+}
+
+// getTunnelConfiguration retrieves the current configuration of a tunnel
+func (cs *CloudflareService) getTunnelConfiguration(ctx context.Context, accountID, tunnelID string) (*models.TunnelConfiguration, error) {
+	return cs.client.ZeroTrust.Tunnels.Cloudflared.Configurations.Get(ctx, tunnelID, zero_trust.TunnelCloudflaredConfigurationGetParams{
 		AccountID: cloudflare.F(accountID),
-		Config: cloudflare.F(zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfig{
-			Ingress: cloudflare.F(newIngress),
-		}),
+	})
+}
+
+// writeTunnelIngress updates the tunnel configuration with the given rules followed by the catch-all rule
+// Tunnel-wide settings of the current configuration (originRequest, warp-routing) are carried over
+// A nil catch-all is replaced by http_status:404, as Cloudflare requires one
+func (cs *CloudflareService) writeTunnelIngress(ctx context.Context, accountID, tunnelID string, current *models.TunnelConfiguration, rules []models.PublicHostnameRule, catchAll *models.PublicHostnameIngress) (models.TunnelConfigurationUpdateResponse, error) {
+	if catchAll == nil {
+		catchAll = &models.PublicHostnameIngress{Service: "http_status:404"}
+	}
+	rules = append(rules[:len(rules):len(rules)], models.NewPublicHostnameRuleFromIngress(*catchAll))
+
+	newIngress := make([]models.PublicHostnameIngressParam, 0, len(rules))
+	var opts []option.RequestOption
+	for i, rule := range rules {
+		newIngress = append(newIngress, rule.Param)
+		for path, raw := range rule.Extra {
+			opts = append(opts, option.WithJSONSet(fmt.Sprintf("config.ingress.%d.%s", i, path), raw))
+		}
 	}
 
-	updatedConfig, err := cs.client.ZeroTrust.Tunnels.Cloudflared.Configurations.Update(ctx, tunnelID, updateParams)
+	config := zero_trust.TunnelCloudflaredConfigurationUpdateParamsConfig{
+		Ingress: cloudflare.F(newIngress),
+	}
+	if current != nil {
+		if !current.Config.JSON.OriginRequest.IsNull() {
+			config.OriginRequest = cloudflare.F(models.NewConfigOriginRequestParam(current.Config.OriginRequest))
+		}
+		for path, raw := range models.TunnelConfigExtraFields(current.Config) {
+			opts = append(opts, option.WithJSONSet("config."+path, raw))
+		}
+	}
+
+	updatedConfig, err := cs.client.ZeroTrust.Tunnels.Cloudflared.Configurations.Update(ctx, tunnelID, zero_trust.TunnelCloudflaredConfigurationUpdateParams{
+		AccountID: cloudflare.F(accountID),
+		Config:    cloudflare.F(config),
+	}, opts...)
 	if err != nil {
-		return models.TunnelConfigurationUpdateResponse{}, fmt.Errorf("error deleting public hostname for tunnel %s in account %s: %w", tunnelID, accountID, err)
+		return models.TunnelConfigurationUpdateResponse{}, err
 	}
 
 	return *updatedConfig, nil
 }
 
 // CreateCloudflareTunnelPublicHostnameWithDNS creates a new public hostname (ingress rule) for a specific tunnel and automatically creates DNS record
-func (cs *CloudflareService) CreateCloudflareTunnelPublicHostnameWithDNS(ctx context.Context, accountID, tunnelID, hostnameValue string, hostname models.PublicHostnameIngressParam) (models.TunnelConfigurationUpdateResponse, error) {
+func (cs *CloudflareService) CreateCloudflareTunnelPublicHostnameWithDNS(ctx context.Context, accountID, tunnelID, hostnameValue string, hostname models.PublicHostnameRule) (models.TunnelConfigurationUpdateResponse, error) {
 	// First create the tunnel configuration
 	updatedConfig, err := cs.CreateCloudflareTunnelPublicHostname(ctx, accountID, tunnelID, hostname)
 	if err != nil {
@@ -454,14 +646,11 @@ func (cs *CloudflareService) CreateCloudflareTunnelPublicHostnameWithDNS(ctx con
 
 	// Try to create DNS record for the hostname
 	if hostnameValue != "" {
-		// Extract domain from hostname
-		domain := extractDomain(hostnameValue)
-
-		// Find the zone for this domain
-		zone, err := cs.GetZoneByName(ctx, accountID, domain)
+		// Find the zone for this hostname
+		zone, err := cs.ResolveZoneForHostname(ctx, accountID, hostnameValue)
 		if err != nil {
 			// Log warning but don't fail the tunnel configuration
-			log.Printf("Warning: Could not find zone for domain %s: %v", domain, err)
+			log.Printf("Warning: Could not find zone for hostname %s: %v", hostnameValue, err)
 		} else {
 			// Create CNAME record pointing to the tunnel
 			// For tunnel hostnames, we typically want them proxied through Cloudflare for security benefits
@@ -479,11 +668,12 @@ func (cs *CloudflareService) CreateCloudflareTunnelPublicHostnameWithDNS(ctx con
 }
 
 // UpdateCloudflareTunnelPublicHostnameWithDNS updates a public hostname (ingress rule) and its DNS record
-func (cs *CloudflareService) UpdateCloudflareTunnelPublicHostnameWithDNS(ctx context.Context, accountID, tunnelID, targetHostname, newHostnameValue string, updatedHostname models.PublicHostnameIngressParam) (models.TunnelConfigurationUpdateResponse, error) {
-	log.Printf("UpdateCloudflareTunnelPublicHostnameWithDNS called with accountID: %s, tunnelID: %s, targetHostname: %s, newHostnameValue: %s", accountID, tunnelID, targetHostname, newHostnameValue)
+// The CNAME of a renamed hostname is only moved once no other path of the tunnel routes the old hostname
+func (cs *CloudflareService) UpdateCloudflareTunnelPublicHostnameWithDNS(ctx context.Context, accountID, tunnelID, targetHostname, targetPath, newHostnameValue string, updatedHostname models.PublicHostnameRule) (models.TunnelConfigurationUpdateResponse, error) {
+	log.Printf("UpdateCloudflareTunnelPublicHostnameWithDNS called with accountID: %s, tunnelID: %s, targetHostname: %s, targetPath: %s, newHostnameValue: %s", accountID, tunnelID, targetHostname, targetPath, newHostnameValue)
 
 	// First update the tunnel configuration
-	updatedConfig, err := cs.UpdateCloudflareTunnelPublicHostname(ctx, accountID, tunnelID, targetHostname, updatedHostname)
+	updatedConfig, err := cs.UpdateCloudflareTunnelPublicHostname(ctx, accountID, tunnelID, targetHostname, targetPath, updatedHostname)
 	if err != nil {
 		log.Printf("Error updating tunnel configuration: %v", err)
 		return models.TunnelConfigurationUpdateResponse{}, err
@@ -492,18 +682,16 @@ func (cs *CloudflareService) UpdateCloudflareTunnelPublicHostnameWithDNS(ctx con
 	log.Printf("Successfully updated tunnel configuration")
 
 	// If the hostname value changed, we need to update DNS records
-	if targetHostname != newHostnameValue && newHostnameValue != "" {
-		// Extract domains
-		oldDomain := extractDomain(targetHostname)
-		newDomain := extractDomain(newHostnameValue)
-
-		// Find the zone for the old domain (to delete the old record)
-		if oldZone, err := cs.GetZoneByName(ctx, accountID, oldDomain); err == nil {
+	if !strings.EqualFold(targetHostname, newHostnameValue) && newHostnameValue != "" {
+		// Find the zone for the old hostname (to delete the old record), unless another path still routes it
+		if routesHostname(updatedConfig.Config.Ingress, targetHostname) {
+			log.Printf("Keeping DNS record for %s, other paths of tunnel %s still route it", targetHostname, tunnelID)
+		} else if oldZone, err := cs.ResolveZoneForHostname(ctx, accountID, targetHostname); err == nil {
 			// Try to find and delete the old DNS record
 			oldRecords, err := cs.GetDNSRecordsByName(ctx, oldZone.ID, targetHostname)
 			if err == nil && len(oldRecords) > 0 {
 				for _, record := range oldRecords {
-					if record.Type == "CNAME" && strings.Contains(record.Content, "cfargotunnel.com") {
+					if isTunnelCNAME(record, tunnelID) {
 						// Delete the old record
 						err := cs.DeleteDNSRecord(ctx, oldZone.ID, record.ID)
 						if err != nil {
@@ -517,9 +705,9 @@ func (cs *CloudflareService) UpdateCloudflareTunnelPublicHostnameWithDNS(ctx con
 		}
 
 		// Create a new DNS record for the new hostname
-		newZone, err := cs.GetZoneByName(ctx, accountID, newDomain)
+		newZone, err := cs.ResolveZoneForHostname(ctx, accountID, newHostnameValue)
 		if err != nil {
-			log.Printf("Warning: Could not find zone for new domain %s: %v", newDomain, err)
+			log.Printf("Warning: Could not find zone for new hostname %s: %v", newHostnameValue, err)
 		} else {
 			// Create CNAME record pointing to the tunnel
 			// For tunnel hostnames, we typically want them proxied through Cloudflare for security benefits
@@ -536,22 +724,22 @@ func (cs *CloudflareService) UpdateCloudflareTunnelPublicHostnameWithDNS(ctx con
 }
 
 // DeleteCloudflareTunnelPublicHostnameWithDNS deletes a public hostname (ingress rule) and its DNS record
-func (cs *CloudflareService) DeleteCloudflareTunnelPublicHostnameWithDNS(ctx context.Context, accountID, tunnelID, targetHostname string) (models.TunnelConfigurationUpdateResponse, error) {
+// The CNAME is kept while other paths of the tunnel still route the hostname
+func (cs *CloudflareService) DeleteCloudflareTunnelPublicHostnameWithDNS(ctx context.Context, accountID, tunnelID, targetHostname, targetPath string) (models.TunnelConfigurationUpdateResponse, error) {
 	// First delete the tunnel configuration
-	updatedConfig, err := cs.DeleteCloudflareTunnelPublicHostname(ctx, accountID, tunnelID, targetHostname)
+	updatedConfig, err := cs.DeleteCloudflareTunnelPublicHostname(ctx, accountID, tunnelID, targetHostname, targetPath)
 	if err != nil {
 		return models.TunnelConfigurationUpdateResponse{}, err
 	}
 
 	// Try to delete the DNS record as well
-	if targetHostname != "" {
-		// Extract domain from hostname
-		domain := extractDomain(targetHostname)
-
-		// Find the zone for this domain
-		zone, err := cs.GetZoneByName(ctx, accountID, domain)
+	if routesHostname(updatedConfig.Config.Ingress, targetHostname) {
+		log.Printf("Keeping DNS record for %s, other paths of tunnel %s still route it", targetHostname, tunnelID)
+	} else if targetHostname != "" {
+		// Find the zone for this hostname
+		zone, err := cs.ResolveZoneForHostname(ctx, accountID, targetHostname)
 		if err != nil {
-			log.Printf("Warning: Could not find zone for domain %s: %v", domain, err)
+			log.Printf("Warning: Could not find zone for hostname %s: %v", targetHostname, err)
 		} else {
 			// Try to find and delete the DNS record
 			records, err := cs.GetDNSRecordsByName(ctx, zone.ID, targetHostname)
@@ -559,7 +747,7 @@ func (cs *CloudflareService) DeleteCloudflareTunnelPublicHostnameWithDNS(ctx con
 				log.Printf("Warning: Could not get DNS records for hostname %s: %v", targetHostname, err)
 			} else if len(records) > 0 {
 				for _, record := range records {
-					if record.Type == "CNAME" && strings.Contains(record.Content, "cfargotunnel.com") {
+					if isTunnelCNAME(record, tunnelID) {
 						err := cs.DeleteDNSRecord(ctx, zone.ID, record.ID)
 						if err != nil {
 							log.Printf("Warning: Could not delete DNS record for hostname %s: %v", targetHostname, err)
@@ -588,7 +776,7 @@ func (cs *CloudflareService) CreateTunnelCNAMERecord(ctx context.Context, zoneID
 	}
 
 	// Construct the tunnel domain with the Cloudflare-specific suffix
-	tunnelDomain := fmt.Sprintf("%s.cfargotunnel.com", tunnelID)
+	tunnelDomain := tunnelCNAMETarget(tunnelID)
 
 	log.Printf("Creating CNAME record for tunnel: %s -> %s (proxied: %t)", hostname, tunnelDomain, proxied)
 
@@ -596,34 +784,21 @@ func (cs *CloudflareService) CreateTunnelCNAMERecord(ctx context.Context, zoneID
 	return cs.CreateCNAMERecord(ctx, zoneID, hostname, tunnelDomain, proxied)
 }
 
-// validateDomainOwnership checks if the given hostname's domain is owned by the account
+// validateDomainOwnership checks if the given hostname belongs to a zone owned by the account
 func (cs *CloudflareService) validateDomainOwnership(ctx context.Context, accountID, hostname string) error {
 	if hostname == "" {
 		return fmt.Errorf("hostname is required")
 	}
-
-	// Extract domain from hostname
-	parts := strings.Split(hostname, ".")
-	if len(parts) < 2 {
+	if !strings.Contains(hostname, ".") {
 		return fmt.Errorf("invalid hostname format")
 	}
 
-	// Find the domain part (assume it's the last two parts for now)
-	// This is a simple approach - in reality, you might need more sophisticated logic
-	domain := strings.Join(parts[len(parts)-2:], ".")
-
-	// Get zones for the account to check if domain is owned
-	zones, err := cs.GetActiveZones(ctx, accountID)
-	if err != nil {
-		return fmt.Errorf("failed to verify domain ownership: %w", err)
-	}
-
-	// Check if any zone matches the domain
-	for _, zone := range zones {
-		if zone.Name == domain {
-			return nil // Domain is owned by this account
+	if _, err := cs.ResolveZoneForHostname(ctx, accountID, hostname); err != nil {
+		if errors.Is(err, ErrZoneNotFound) {
+			return fmt.Errorf("hostname %s is not in a zone owned by account %s: %w", hostname, accountID, err)
 		}
+		return fmt.Errorf("failed to verify domain ownership: %w", err)
 	}
 
-	return fmt.Errorf("domain %s is not owned by account %s", domain, accountID)
+	return nil
 }
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"cfProxyHub/internal/models"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/option"
+)
+
+// tunnelConfigWithCatchAll is a tunnel configuration ending in a custom catch-all rule
+const tunnelConfigWithCatchAll = `{
+	"tunnel_id": "t1",
+	"version": 4,
+	"config": {
+		"ingress": [
+			{"hostname": "app.example.com", "service": "http://app:80", "originRequest": {"bastionMode": true}},
+			{"hostname": "app.example.com", "path": "^/admin", "service": "http://admin:80"},
+			{"service": "http://fallback:8080", "originRequest": {"noTLSVerify": true, "futureOption": "x"}}
+		],
+		"warp-routing": {"enabled": true}
+	}
+}`
+
+// newTestCloudflareService returns a service talking to a test server instead of the Cloudflare API
+func newTestCloudflareService(url string) *CloudflareService {
+	return &CloudflareService{
+		client: cloudflare.NewClient(option.WithAPIToken("test"), option.WithBaseURL(url), option.WithMaxRetries(0)),
+		zones:  newZoneCache(),
+	}
+}
+
+// decodeTunnelConfig reads a tunnel configuration the way it arrives from the API
+func decodeTunnelConfig(t *testing.T, raw string) *models.TunnelConfiguration {
+	t.Helper()
+	var config models.TunnelConfiguration
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		t.Fatalf("decode configuration: %v", err)
+	}
+	return &config
+}
+
+// captureConfigUpdate serves configuration updates and records the config sent with them
+func captureConfigUpdate(t *testing.T, sent *map[string]any) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "unexpected "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			Config map[string]any `json:"config"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("decode update: %v", err)
+		}
+		*sent = request.Config
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": true, "errors": []any{}, "messages": []any{},
+			"result": map[string]any{"tunnel_id": "t1", "version": 5, "config": request.Config},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSplitTunnelIngress(t *testing.T) {
+	config := decodeTunnelConfig(t, tunnelConfigWithCatchAll)
+
+	rules, catchAll := splitTunnelIngress(config.Config.Ingress)
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules, want 2", len(rules))
+	}
+	if catchAll == nil || catchAll.Service != "http://fallback:8080" {
+		t.Fatalf("catch-all = %+v, want the fallback rule", catchAll)
+	}
+
+	// A last rule with a hostname or path is no catch-all
+	rules, catchAll = splitTunnelIngress(config.Config.Ingress[:2])
+	if len(rules) != 2 || catchAll != nil {
+		t.Errorf("got %d rules and catch-all %+v, want 2 rules and none", len(rules), catchAll)
+	}
+}
+
+func TestWriteTunnelIngressKeepsCustomCatchAll(t *testing.T) {
+	var sent map[string]any
+	cs := newTestCloudflareService(captureConfigUpdate(t, &sent).URL)
+	config := decodeTunnelConfig(t, tunnelConfigWithCatchAll)
+
+	existing, catchAll := splitTunnelIngress(config.Config.Ingress)
+	rules := []models.PublicHostnameRule{models.NewPublicHostnameRuleFromIngress(existing[0])}
+	if _, err := cs.writeTunnelIngress(context.Background(), "acc", "t1", config, rules, catchAll); err != nil {
+		t.Fatalf("writeTunnelIngress: %v", err)
+	}
+
+	want := map[string]any{
+		"ingress": []any{
+			map[string]any{"hostname": "app.example.com", "service": "http://app:80", "originRequest": map[string]any{"bastionMode": true}},
+			map[string]any{"service": "http://fallback:8080", "originRequest": map[string]any{"noTLSVerify": true, "futureOption": "x"}},
+		},
+		"warp-routing": map[string]any{"enabled": true},
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent config\ngot:  %v\nwant: %v", sent, want)
+	}
+}
+
+func TestWriteTunnelIngressDefaultsCatchAll(t *testing.T) {
+	var sent map[string]any
+	cs := newTestCloudflareService(captureConfigUpdate(t, &sent).URL)
+
+	rules := []models.PublicHostnameRule{models.NewPublicHostnameRule(models.NewPublicHostnameIngressParam("app.example.com", "http://app:80", ""))}
+	if _, err := cs.writeTunnelIngress(context.Background(), "acc", "t1", nil, rules, nil); err != nil {
+		t.Fatalf("writeTunnelIngress: %v", err)
+	}
+
+	ingress, _ := sent["ingress"].([]any)
+	if len(ingress) != 2 {
+		t.Fatalf("got ingress %v, want the rule and a catch-all", ingress)
+	}
+	if last := ingress[1].(map[string]any); last["service"] != "http_status:404" || last["hostname"] != nil {
+		t.Errorf("catch-all = %v, want http_status:404", last)
+	}
+}
+
+// newTunnelAPI serves an account with the example.com zone and tunnel t1, whose configuration GET answers with status
+// The number of configuration updates received is counted in puts
+func newTunnelAPI(t *testing.T, status int, puts *int) *httptest.Server {
+	t.Helper()
+	respond := func(w http.ResponseWriter, code int, result any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		body := map[string]any{"success": code < 300, "errors": []any{}, "messages": []any{}, "result": result}
+		if code >= 300 {
+			body["errors"] = []any{map[string]any{"code": 1000, "message": http.StatusText(code)}}
+		}
+		if list, ok := result.([]any); ok {
+			body["result_info"] = map[string]any{"page": 1, "per_page": 50, "count": len(list), "total_count": len(list), "total_pages": 1}
+		}
+		json.NewEncoder(w).Encode(body)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/zones", func(w http.ResponseWriter, r *http.Request) {
+		// The listing is paged until a page comes back empty
+		if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+			respond(w, http.StatusOK, []any{})
+			return
+		}
+		respond(w, http.StatusOK, []any{map[string]any{"id": "z1", "name": "example.com", "status": "active"}})
+	})
+	mux.HandleFunc("/accounts/acc/cfd_tunnel", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, []any{})
+	})
+	mux.HandleFunc("/accounts/acc/cfd_tunnel/t1/configurations", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			*puts++
+			respond(w, http.StatusOK, map[string]any{"tunnel_id": "t1", "version": 1})
+			return
+		}
+		respond(w, status, nil)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCreatePublicHostnameKeepsConfigurationOnReadError(t *testing.T) {
+	var puts int
+	cs := newTestCloudflareService(newTunnelAPI(t, http.StatusInternalServerError, &puts).URL)
+
+	rule := models.NewPublicHostnameRule(models.NewPublicHostnameIngressParam("new.example.com", "http://new:80", ""))
+	if _, err := cs.CreateCloudflareTunnelPublicHostname(context.Background(), "acc", "t1", rule); err == nil {
+		t.Fatal("expected an error when the configuration can't be read")
+	}
+	if puts != 0 {
+		t.Errorf("sent %d configuration updates, want none", puts)
+	}
+}
+
+func TestCreatePublicHostnameOnTunnelWithoutConfiguration(t *testing.T) {
+	var puts int
+	cs := newTestCloudflareService(newTunnelAPI(t, http.StatusNotFound, &puts).URL)
+
+	rule := models.NewPublicHostnameRule(models.NewPublicHostnameIngressParam("new.example.com", "http://new:80", ""))
+	if _, err := cs.CreateCloudflareTunnelPublicHostname(context.Background(), "acc", "t1", rule); err != nil {
+		t.Fatalf("CreateCloudflareTunnelPublicHostname: %v", err)
+	}
+	if puts != 1 {
+		t.Errorf("sent %d configuration updates, want 1", puts)
+	}
+}
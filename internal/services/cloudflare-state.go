@@ -0,0 +1,618 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"cfProxyHub/internal/models"
+)
+
+// tunnelPlan holds the desired ingress of a tunnel that has pending ingress changes
+type tunnelPlan struct {
+	accountID string
+	tunnelID  string
+	// version is the configuration version the plan was made against, the write fails if it moved on
+	version  int64
+	rules    []models.IngressRule
+	catchAll string
+}
+
+// statePlan is a plan together with the data needed to apply it
+type statePlan struct {
+	plan    models.StatePlan
+	tunnels []tunnelPlan
+}
+
+// PlanDesiredState diffs a desired state document against the live configuration
+func (cs *CloudflareService) PlanDesiredState(ctx context.Context, state models.DesiredState) (models.StatePlan, error) {
+	p, err := cs.planDesiredState(ctx, state)
+	if err != nil {
+		return models.StatePlan{}, err
+	}
+	return p.plan, nil
+}
+
+// StatePlanDriftError is returned when planning a document again doesn't yield the plan that was reviewed
+type StatePlanDriftError struct {
+	Expected string
+	Plan     models.StatePlan
+}
+
+func (e *StatePlanDriftError) Error() string {
+	return fmt.Sprintf("plan %s is out of date, the live configuration changed and the document now plans %s", e.Expected, e.Plan.Fingerprint)
+}
+
+// ApplyDesiredState plans a desired state document again and executes the changes if they are still the reviewed plan
+// A different fingerprint fails with a StatePlanDriftError without changing anything.
+// Ingress changes are written as one configuration update per tunnel, DNS changes one record at a time
+func (cs *CloudflareService) ApplyDesiredState(ctx context.Context, state models.DesiredState, fingerprint string) (models.StateApplyResult, error) {
+	p, err := cs.planDesiredState(ctx, state)
+	if err != nil {
+		return models.StateApplyResult{}, err
+	}
+	if p.plan.Fingerprint != fingerprint {
+		return models.StateApplyResult{}, &StatePlanDriftError{Expected: fingerprint, Plan: p.plan}
+	}
+
+	result := models.StateApplyResult{
+		Plan:    p.plan,
+		Results: []models.PlanChangeOutcome{},
+	}
+
+	// Write the full ingress of every tunnel with ingress changes
+	tunnelErrors := make(map[string]error)
+	for _, tp := range p.tunnels {
+		rules := make([]models.PublicHostnameRule, len(tp.rules))
+		for i, rule := range tp.rules {
+			rules[i] = rule.ToRule()
+		}
+
+		log.Printf("Applying %d ingress rules to tunnel %s", len(rules), tp.tunnelID)
+		writeCtx := WithExpectedConfigVersion(ctx, tp.version)
+		if _, err := cs.ReplaceCloudflareTunnelIngress(writeCtx, tp.accountID, tp.tunnelID, rules, tp.catchAll); err != nil {
+			tunnelErrors[tp.tunnelID] = err
+		}
+	}
+
+	for _, change := range p.plan.Changes {
+		var changeErr error
+
+		switch change.Kind {
+		case models.PlanKindIngress:
+			changeErr = tunnelErrors[change.TunnelID]
+		case models.PlanKindDNSRecord:
+			changeErr = cs.applyDNSChange(ctx, change)
+		}
+
+		outcome := models.PlanChangeOutcome{
+			Change:  change,
+			Success: changeErr == nil,
+		}
+		if changeErr != nil {
+			outcome.Error = changeErr.Error()
+			result.Failed++
+		}
+		result.Results = append(result.Results, outcome)
+	}
+
+	return result, nil
+}
+
+// ExportDesiredState renders the current tunnels and ingress of an account as a desired state document
+func (cs *CloudflareService) ExportDesiredState(ctx context.Context, accountID string) (models.DesiredState, error) {
+	tunnels, err := cs.GetCloudflareTunnels(ctx, accountID)
+	if err != nil {
+		return models.DesiredState{}, err
+	}
+
+	account := models.DesiredAccount{ID: accountID}
+	for _, tunnel := range tunnels {
+		ingress, err := cs.GetCloudflareTunnelPublicHostnames(ctx, accountID, tunnel.ID)
+		if err != nil {
+			// Locally managed tunnels have no remote configuration
+			log.Printf("Warning: Skipping tunnel %s in export: %v", tunnel.ID, err)
+			continue
+		}
+
+		desired := models.DesiredTunnel{
+			ID:      tunnel.ID,
+			Name:    tunnel.Name,
+			Ingress: []models.IngressRule{},
+		}
+		for _, rule := range ingress {
+			if rule.Hostname == "" {
+				desired.CatchAll = rule.Service
+				continue
+			}
+			desired.Ingress = append(desired.Ingress, models.NewIngressRuleFromPublicHostname(rule))
+		}
+		account.Tunnels = append(account.Tunnels, desired)
+	}
+
+	return models.DesiredState{Accounts: []models.DesiredAccount{account}}, nil
+}
+
+// planDesiredState computes the changes of every account in the document
+func (cs *CloudflareService) planDesiredState(ctx context.Context, state models.DesiredState) (*statePlan, error) {
+	p := &statePlan{
+		plan: models.StatePlan{Changes: []models.PlanChange{}},
+	}
+
+	for _, account := range state.Accounts {
+		if account.ID == "" {
+			return nil, fmt.Errorf("account ID is required")
+		}
+
+		for _, tunnel := range account.Tunnels {
+			if err := cs.planTunnel(ctx, p, account.ID, tunnel); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, zone := range account.Zones {
+			if err := cs.planZone(ctx, p, account.ID, zone); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fingerprint, err := planFingerprint(p.plan.Changes)
+	if err != nil {
+		return nil, err
+	}
+	p.plan.Fingerprint = fingerprint
+	return p, nil
+}
+
+// planFingerprint hashes the changes of a plan, including the live values they replace
+func planFingerprint(changes []models.PlanChange) (string, error) {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode plan: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// planTunnel diffs the ingress of one tunnel and the CNAMEs of its hostnames
+func (cs *CloudflareService) planTunnel(ctx context.Context, p *statePlan, accountID string, tunnel models.DesiredTunnel) error {
+	tunnelID, err := cs.resolveDesiredTunnelID(ctx, accountID, tunnel)
+	if err != nil {
+		return err
+	}
+
+	catchAll := tunnel.CatchAll
+	if catchAll == "" {
+		catchAll = "http_status:404"
+	}
+
+	var current []models.PublicHostnameIngress
+	var version int64
+	config, err := cs.getTunnelConfiguration(ctx, accountID, tunnelID)
+	switch {
+	case isNotFoundError(err):
+		// New tunnels have no configuration yet, plan against an empty one
+		log.Printf("Tunnel %s has no configuration yet, planning from scratch", tunnelID)
+	case err != nil:
+		return fmt.Errorf("error getting configuration of tunnel %s in account %s: %w", tunnelID, accountID, err)
+	default:
+		current = config.Config.Ingress
+		version = config.Version
+	}
+
+	currentRules := make(map[string]models.IngressRule)
+	currentHostnames := make(map[string]bool)
+	var currentOrder []string
+	currentCatchAll := ""
+	for _, ingress := range current {
+		if ingress.Hostname == "" {
+			currentCatchAll = ingress.Service
+			continue
+		}
+		rule := models.NewIngressRuleFromPublicHostname(ingress)
+		currentRules[ingressRuleKey(rule)] = rule
+		currentOrder = append(currentOrder, ingressRuleKey(rule))
+		currentHostnames[strings.ToLower(rule.Hostname)] = true
+	}
+
+	desiredRules := make(map[string]models.IngressRule)
+	var desiredOrder []string
+	desiredHostnames := make(map[string]bool)
+	newHostnames := make(map[string]bool)
+	for _, rule := range tunnel.Ingress {
+		if rule.Hostname == "" || rule.Service == "" {
+			return fmt.Errorf("tunnel %s: every ingress rule needs a hostname and a service", tunnelID)
+		}
+		rule.Hostname = strings.ToLower(rule.Hostname)
+		if rule.OriginRequest != nil && rule.OriginRequest.IsZero() {
+			rule.OriginRequest = nil
+		}
+		key := ingressRuleKey(rule)
+		if _, dup := desiredRules[key]; dup {
+			return fmt.Errorf("tunnel %s: duplicate ingress rule for %s", tunnelID, key)
+		}
+		desiredRules[key] = rule
+		desiredOrder = append(desiredOrder, key)
+		if !rule.SkipDNS {
+			desiredHostnames[rule.Hostname] = true
+		}
+		if !currentHostnames[rule.Hostname] {
+			newHostnames[rule.Hostname] = true
+		}
+	}
+
+	if err := cs.checkNewTunnelHostnames(ctx, accountID, tunnelID, newHostnames, desiredHostnames); err != nil {
+		return err
+	}
+
+	ingressChanged := false
+	addIngress := func(action, key string, before, after interface{}) {
+		p.plan.Add(models.PlanChange{
+			Action:    action,
+			Kind:      models.PlanKindIngress,
+			AccountID: accountID,
+			TunnelID:  tunnelID,
+			Key:       key,
+			Before:    before,
+			After:     after,
+		})
+		ingressChanged = true
+	}
+
+	for _, key := range desiredOrder {
+		rule := desiredRules[key]
+		existing, ok := currentRules[key]
+		if !ok {
+			addIngress(models.PlanActionCreate, key, nil, rule)
+			continue
+		}
+		compared := rule
+		compared.SkipDNS = false
+		if !reflect.DeepEqual(existing, compared) {
+			addIngress(models.PlanActionUpdate, key, existing, rule)
+		}
+	}
+
+	for _, key := range currentOrder {
+		if _, ok := desiredRules[key]; !ok {
+			addIngress(models.PlanActionDelete, key, currentRules[key], nil)
+		}
+	}
+
+	if currentCatchAll != catchAll {
+		addIngress(models.PlanActionUpdate, "catch-all", currentCatchAll, catchAll)
+	}
+
+	// Rules match first to last, so a reordering is a change as well
+	if !ingressChanged && !reflect.DeepEqual(currentOrder, desiredOrder) && len(desiredOrder) > 0 {
+		addIngress(models.PlanActionUpdate, "order", currentOrder, desiredOrder)
+	}
+
+	if ingressChanged {
+		rules := make([]models.IngressRule, 0, len(desiredOrder))
+		for _, key := range desiredOrder {
+			rules = append(rules, desiredRules[key])
+		}
+		p.tunnels = append(p.tunnels, tunnelPlan{
+			accountID: accountID,
+			tunnelID:  tunnelID,
+			version:   version,
+			rules:     rules,
+			catchAll:  catchAll,
+		})
+	}
+
+	return cs.planTunnelDNS(ctx, p, accountID, tunnelID, desiredHostnames, currentRules)
+}
+
+// checkNewTunnelHostnames refuses hostnames a tunnel doesn't route yet if another tunnel of the account routes them,
+// or, when they get a CNAME, if they are in none of the account's zones
+func (cs *CloudflareService) checkNewTunnelHostnames(ctx context.Context, accountID, tunnelID string, newHostnames, dnsHostnames map[string]bool) error {
+	if len(newHostnames) == 0 {
+		return nil
+	}
+
+	routed, err := cs.otherTunnelHostnames(ctx, accountID, tunnelID)
+	if err != nil {
+		return fmt.Errorf("tunnel %s: failed to check hostnames against other tunnels: %w", tunnelID, err)
+	}
+
+	for _, hostname := range sortedKeys(newHostnames) {
+		if tunnel, ok := routed[hostname]; ok {
+			return fmt.Errorf("tunnel %s: %w: %s is routed by tunnel %s", tunnelID, ErrHostnameExists, hostname, tunnel)
+		}
+		if dnsHostnames[hostname] {
+			if err := cs.validateDomainOwnership(ctx, accountID, hostname); err != nil {
+				return fmt.Errorf("tunnel %s: %w", tunnelID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// planTunnelDNS makes sure every desired hostname has a CNAME to the tunnel and removed hostnames lose theirs
+// A CNAME pointing to another tunnel is never moved, the plan fails instead
+func (cs *CloudflareService) planTunnelDNS(ctx context.Context, p *statePlan, accountID, tunnelID string, desiredHostnames map[string]bool, currentRules map[string]models.IngressRule) error {
+	target := tunnelCNAMETarget(tunnelID)
+
+	hostnames := make(map[string]bool)
+	for hostname := range desiredHostnames {
+		hostnames[hostname] = true
+	}
+	for _, rule := range currentRules {
+		hostnames[strings.ToLower(rule.Hostname)] = true
+	}
+
+	for _, hostname := range sortedKeys(hostnames) {
+		zone, err := cs.ResolveZoneForHostname(ctx, accountID, hostname)
+		if err != nil {
+			if desiredHostnames[hostname] {
+				log.Printf("Warning: No zone found for hostname %s, skipping its DNS record: %v", hostname, err)
+			}
+			continue
+		}
+
+		records, err := cs.GetDNSRecordsByName(ctx, zone.ID, hostname)
+		if err != nil {
+			return err
+		}
+
+		var cname *models.DNSRecord
+		for i := range records {
+			if records[i].Type == "CNAME" {
+				cname = &records[i]
+				break
+			}
+		}
+
+		desired := models.DesiredDNSRecord{
+			Type:    "CNAME",
+			Name:    hostname,
+			Content: target,
+			TTL:     1,
+			Proxied: true,
+		}
+
+		if cname != nil && desiredHostnames[hostname] {
+			if other := tunnelIDFromCNAME(*cname); other != "" && other != strings.ToLower(tunnelID) {
+				return fmt.Errorf("tunnel %s: %w: the CNAME of %s points to tunnel %s, not moving it", tunnelID, ErrHostnameExists, hostname, other)
+			}
+		}
+
+		switch {
+		case desiredHostnames[hostname] && cname == nil:
+			if len(records) > 0 {
+				log.Printf("Warning: Hostname %s already has non-CNAME records, not creating a tunnel CNAME", hostname)
+				continue
+			}
+			p.plan.Add(models.PlanChange{
+				Action:    models.PlanActionCreate,
+				Kind:      models.PlanKindDNSRecord,
+				AccountID: accountID,
+				TunnelID:  tunnelID,
+				ZoneID:    zone.ID,
+				Key:       "CNAME " + hostname,
+				After:     desired,
+			})
+		case desiredHostnames[hostname] && !isTunnelCNAME(*cname, tunnelID):
+			p.plan.Add(models.PlanChange{
+				Action:    models.PlanActionUpdate,
+				Kind:      models.PlanKindDNSRecord,
+				AccountID: accountID,
+				TunnelID:  tunnelID,
+				ZoneID:    zone.ID,
+				RecordID:  cname.ID,
+				Key:       "CNAME " + hostname,
+				Before:    models.NewDesiredDNSRecordFromRecord(*cname),
+				After:     desired,
+			})
+		case !desiredHostnames[hostname] && cname != nil && isTunnelCNAME(*cname, tunnelID):
+			p.plan.Add(models.PlanChange{
+				Action:    models.PlanActionDelete,
+				Kind:      models.PlanKindDNSRecord,
+				AccountID: accountID,
+				TunnelID:  tunnelID,
+				ZoneID:    zone.ID,
+				RecordID:  cname.ID,
+				Key:       "CNAME " + hostname,
+				Before:    models.NewDesiredDNSRecordFromRecord(*cname),
+			})
+		}
+	}
+
+	return nil
+}
+
+// planZone diffs the extra DNS records of one zone
+func (cs *CloudflareService) planZone(ctx context.Context, p *statePlan, accountID string, zone models.DesiredZone) error {
+	zoneID, zoneName := zone.ID, zone.Name
+	if zoneID == "" {
+		if zoneName == "" {
+			return fmt.Errorf("zone ID or name is required")
+		}
+		found, err := cs.GetZoneByName(ctx, accountID, zoneName)
+		if err != nil {
+			return err
+		}
+		zoneID = found.ID
+	} else if zoneName == "" {
+		found, err := cs.GetZoneByID(ctx, zoneID)
+		if err != nil {
+			return err
+		}
+		zoneName = found.Name
+	}
+
+	current, err := cs.GetDNSRecords(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+
+	currentRecords := make(map[string]models.DNSRecord)
+	for _, record := range current {
+		currentRecords[dnsRecordKey(string(record.Type), record.Name, record.Content)] = record
+	}
+
+	desiredKeys := make(map[string]bool)
+	for _, record := range zone.DNSRecords {
+		if record.Type == "" || record.Name == "" || record.Content == "" {
+			return fmt.Errorf("zone %s: every DNS record needs a type, name and content", zoneName)
+		}
+		record.Type = strings.ToUpper(record.Type)
+		record.Name = qualifyRecordName(record.Name, zoneName)
+		if record.TTL == 0 {
+			record.TTL = 1
+		}
+
+		key := dnsRecordKey(record.Type, record.Name, record.Content)
+		if desiredKeys[key] {
+			return fmt.Errorf("zone %s: duplicate DNS record %s", zoneName, key)
+		}
+		desiredKeys[key] = true
+
+		change := models.PlanChange{
+			Kind:      models.PlanKindDNSRecord,
+			AccountID: accountID,
+			ZoneID:    zoneID,
+			Key:       key,
+			After:     record,
+		}
+
+		existing, ok := currentRecords[key]
+		if !ok {
+			change.Action = models.PlanActionCreate
+			p.plan.Add(change)
+			continue
+		}
+
+		before := models.NewDesiredDNSRecordFromRecord(existing)
+		if !reflect.DeepEqual(before, record) {
+			change.Action = models.PlanActionUpdate
+			change.RecordID = existing.ID
+			change.Before = before
+			p.plan.Add(change)
+		}
+	}
+
+	if !zone.Prune {
+		return nil
+	}
+
+	// Sorted, so planning the same state twice yields the same plan fingerprint
+	for _, key := range sortedKeys(currentRecords) {
+		record := currentRecords[key]
+		if desiredKeys[key] || isUnmanagedRecord(record) {
+			continue
+		}
+		p.plan.Add(models.PlanChange{
+			Action:    models.PlanActionDelete,
+			Kind:      models.PlanKindDNSRecord,
+			AccountID: accountID,
+			ZoneID:    zoneID,
+			RecordID:  record.ID,
+			Key:       key,
+			Before:    models.NewDesiredDNSRecordFromRecord(record),
+		})
+	}
+
+	return nil
+}
+
+// applyDNSChange executes a single planned DNS record change
+func (cs *CloudflareService) applyDNSChange(ctx context.Context, change models.PlanChange) error {
+	switch change.Action {
+	case models.PlanActionCreate:
+		record, ok := change.After.(models.DesiredDNSRecord)
+		if !ok {
+			return fmt.Errorf("invalid DNS record change %s", change.Key)
+		}
+		_, err := cs.CreateDNSRecord(ctx, change.ZoneID, record.ToNewParams())
+		return err
+	case models.PlanActionUpdate:
+		record, ok := change.After.(models.DesiredDNSRecord)
+		if !ok {
+			return fmt.Errorf("invalid DNS record change %s", change.Key)
+		}
+		_, err := cs.UpdateDNSRecord(ctx, change.ZoneID, change.RecordID, record.ToUpdateParams())
+		return err
+	case models.PlanActionDelete:
+		return cs.DeleteDNSRecord(ctx, change.ZoneID, change.RecordID)
+	}
+	return fmt.Errorf("unknown action %s", change.Action)
+}
+
+// resolveDesiredTunnelID returns the ID of a tunnel given by ID or by name
+func (cs *CloudflareService) resolveDesiredTunnelID(ctx context.Context, accountID string, tunnel models.DesiredTunnel) (string, error) {
+	if tunnel.ID != "" {
+		return tunnel.ID, nil
+	}
+	if tunnel.Name == "" {
+		return "", fmt.Errorf("tunnel ID or name is required")
+	}
+
+	tunnels, err := cs.ListCloudflareTunnelsWithParams(ctx, accountID, models.NewTunnelListParams(tunnel.Name))
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tunnels {
+		if t.Name == tunnel.Name {
+			return t.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("tunnel %s not found in account %s", tunnel.Name, accountID)
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ingressRuleKey identifies an ingress rule by hostname and path
+func ingressRuleKey(rule models.IngressRule) string {
+	if rule.Path == "" {
+		return rule.Hostname
+	}
+	return rule.Hostname + rule.Path
+}
+
+// dnsRecordKey identifies a DNS record; names with a single CNAME are keyed without content
+func dnsRecordKey(recordType, name, content string) string {
+	if recordType == "CNAME" {
+		return recordType + " " + strings.ToLower(name)
+	}
+	return recordType + " " + strings.ToLower(name) + " " + content
+}
+
+// qualifyRecordName turns "@" and relative names into fully qualified names within the zone
+func qualifyRecordName(name, zoneName string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "@" || name == zoneName {
+		return zoneName
+	}
+	if strings.HasSuffix(name, "."+zoneName) {
+		return name
+	}
+	return name + "." + zoneName
+}
+
+// isUnmanagedRecord reports whether a record must never be pruned by a desired state
+func isUnmanagedRecord(record models.DNSRecord) bool {
+	if record.Type == "NS" || record.Type == "SOA" {
+		return true
+	}
+	// Tunnel CNAMEs are derived from ingress, not from the zone's record list
+	return record.Type == "CNAME" && strings.HasSuffix(record.Content, ".cfargotunnel.com")
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"cfProxyHub/internal/models"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/zero_trust"
+)
+
+// tunnelHAConnections is the number of connections cloudflared opens per connector by default
+const tunnelHAConnections = 4
+
+// tunnelHealthConcurrency caps the connection lookups run in parallel when checking a whole account
+const tunnelHealthConcurrency = 8
+
+// GetCloudflareTunnelConnections lists the live connections of a tunnel's cloudflared connectors
+func (cs *CloudflareService) GetCloudflareTunnelConnections(ctx context.Context, accountID, tunnelID string) ([]models.TunnelConnection, error) {
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if tunnelID == "" {
+		return nil, fmt.Errorf("tunnel ID is required")
+	}
+
+	autopager := cs.client.ZeroTrust.Tunnels.Cloudflared.Connections.GetAutoPaging(ctx, tunnelID, zero_trust.TunnelCloudflaredConnectionGetParams{
+		AccountID: cloudflare.F(accountID),
+	})
+
+	connections := []models.TunnelConnection{}
+	for autopager.Next() {
+		connector := autopager.Current()
+		for _, conn := range connector.Conns {
+			connectorID := conn.ClientID
+			if connectorID == "" {
+				connectorID = connector.ID
+			}
+			version := conn.ClientVersion
+			if version == "" {
+				version = connector.Version
+			}
+			connections = append(connections, models.TunnelConnection{
+				ID:               conn.ID,
+				ConnectorID:      connectorID,
+				Colo:             conn.ColoName,
+				OriginIP:         conn.OriginIP,
+				ClientVersion:    version,
+				Arch:             connector.Arch,
+				OpenedAt:         conn.OpenedAt,
+				PendingReconnect: conn.IsPendingReconnect,
+			})
+		}
+	}
+	if autopager.Err() != nil {
+		return nil, fmt.Errorf("error listing connections of tunnel %s in account %s: %w", tunnelID, accountID, autopager.Err())
+	}
+
+	return connections, nil
+}
+
+// CleanupCloudflareTunnelConnections removes the connections of a tunnel's connectors from Cloudflare
+// Only the connector with the given ID is removed if connectorID is set, otherwise all of them.
+// Connectors that are still running reconnect, so stop cloudflared first to get rid of them for good
+func (cs *CloudflareService) CleanupCloudflareTunnelConnections(ctx context.Context, accountID, tunnelID, connectorID string) error {
+	if accountID == "" {
+		return fmt.Errorf("account ID is required")
+	}
+	if tunnelID == "" {
+		return fmt.Errorf("tunnel ID is required")
+	}
+
+	params := zero_trust.TunnelCloudflaredConnectionDeleteParams{
+		AccountID: cloudflare.F(accountID),
+	}
+	if connectorID != "" {
+		params.ClientID = cloudflare.F(connectorID)
+	}
+
+	if _, err := cs.client.ZeroTrust.Tunnels.Cloudflared.Connections.Delete(ctx, tunnelID, params); err != nil {
+		return fmt.Errorf("error cleaning up connections of tunnel %s in account %s: %w", tunnelID, accountID, err)
+	}
+
+	return nil
+}
+
+// GetCloudflareTunnelHealth returns the health of a tunnel together with its connections
+func (cs *CloudflareService) GetCloudflareTunnelHealth(ctx context.Context, accountID, tunnelID string) (models.TunnelHealth, []models.TunnelConnection, error) {
+	tunnel, err := cs.GetCloudflareTunnelByID(ctx, accountID, tunnelID)
+	if err != nil {
+		return models.TunnelHealth{}, nil, err
+	}
+	connections, err := cs.GetCloudflareTunnelConnections(ctx, accountID, tunnelID)
+	if err != nil {
+		return models.TunnelHealth{}, nil, err
+	}
+
+	health := evaluateTunnelHealth(tunnel.ID, tunnel.Name, string(tunnel.Status), tunnel.ConnsActiveAt, tunnel.ConnsInactiveAt, connections)
+	return health, connections, nil
+}
+
+// GetCloudflareTunnelsHealth returns the health of every tunnel of an account
+// A tunnel whose connections can't be read is reported as unknown rather than failing the whole account
+func (cs *CloudflareService) GetCloudflareTunnelsHealth(ctx context.Context, accountID string) ([]models.TunnelHealth, error) {
+	tunnels, err := cs.GetCloudflareTunnels(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.TunnelHealth, len(tunnels))
+	semaphore := make(chan struct{}, tunnelHealthConcurrency)
+	var wg sync.WaitGroup
+	for i, tunnel := range tunnels {
+		status := string(tunnel.Status)
+		// Tunnels that never connected have no connections to look up
+		if status == models.TunnelHealthInactive {
+			results[i] = evaluateTunnelHealth(tunnel.ID, tunnel.Name, status, tunnel.ConnsActiveAt, tunnel.ConnsInactiveAt, nil)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, tunnel models.TunnelListResponse) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			connections, err := cs.GetCloudflareTunnelConnections(ctx, accountID, tunnel.ID)
+			health := evaluateTunnelHealth(tunnel.ID, tunnel.Name, status, tunnel.ConnsActiveAt, tunnel.ConnsInactiveAt, connections)
+			if err != nil {
+				health.Health = models.TunnelHealthUnknown
+				health.Reason = err.Error()
+			}
+			results[i] = health
+		}(i, tunnel)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// evaluateTunnelHealth aggregates a tunnel's connections into a health verdict
+//   - inactive: cloudflared never connected
+//   - down: no connection is serving traffic
+//   - degraded: traffic is served, but a connector lost some of its connections or Cloudflare reports the tunnel degraded
+//   - healthy: every connector holds all of its connections
+func evaluateTunnelHealth(tunnelID, name, status string, activeAt, inactiveAt time.Time, connections []models.TunnelConnection) models.TunnelHealth {
+	health := models.TunnelHealth{
+		TunnelID: tunnelID,
+		Name:     name,
+		Status:   status,
+		Colos:    []string{},
+	}
+	if !activeAt.IsZero() {
+		health.ConnsActiveAt = &activeAt
+	}
+	if !inactiveAt.IsZero() {
+		health.ConnsInactiveAt = &inactiveAt
+	}
+
+	active := make(map[string]int)
+	pending := 0
+	colos := make(map[string]bool)
+	for _, conn := range connections {
+		if conn.PendingReconnect {
+			pending++
+			if _, ok := active[conn.ConnectorID]; !ok {
+				active[conn.ConnectorID] = 0
+			}
+			continue
+		}
+		active[conn.ConnectorID]++
+		health.Connections++
+		if conn.Colo != "" && !colos[conn.Colo] {
+			colos[conn.Colo] = true
+			health.Colos = append(health.Colos, conn.Colo)
+		}
+	}
+	sort.Strings(health.Colos)
+
+	// Connectors with only pending connections have gone away
+	connectorIDs := make([]string, 0, len(active))
+	for connectorID, count := range active {
+		if count > 0 {
+			health.Connectors++
+			connectorIDs = append(connectorIDs, connectorID)
+		}
+	}
+	sort.Strings(connectorIDs)
+
+	switch {
+	case health.Connections == 0 && (status == models.TunnelHealthInactive || activeAt.IsZero()) && pending == 0:
+		health.Health = models.TunnelHealthInactive
+		health.Reason = "cloudflared has never connected"
+	case health.Connections == 0:
+		health.Health = models.TunnelHealthDown
+		health.Reason = "no cloudflared connector is connected"
+		if pending > 0 {
+			health.Reason = "all connections dropped, waiting for cloudflared to reconnect"
+		}
+	case pending > 0:
+		health.Health = models.TunnelHealthDegraded
+		health.Reason = fmt.Sprintf("%d connection(s) dropped and waiting to reconnect", pending)
+	case status == models.TunnelHealthDegraded:
+		health.Health = models.TunnelHealthDegraded
+		health.Reason = "Cloudflare reports the tunnel as degraded"
+	default:
+		health.Health = models.TunnelHealthHealthy
+		for _, connectorID := range connectorIDs {
+			if count := active[connectorID]; count < tunnelHAConnections {
+				health.Health = models.TunnelHealthDegraded
+				health.Reason = fmt.Sprintf("connector %s holds %d of %d connections", connectorID, count, tunnelHAConnections)
+				break
+			}
+		}
+	}
+
+	return health
+}
@@ -0,0 +1,406 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"cfProxyHub/internal/models"
+)
+
+// tunnelCNAMETarget returns the hostname CNAME records of a tunnel point to
+func tunnelCNAMETarget(tunnelID string) string {
+	return fmt.Sprintf("%s.cfargotunnel.com", tunnelID)
+}
+
+// tunnelIDFromCNAME returns the ID of the tunnel a CNAME record points to, empty for other records
+func tunnelIDFromCNAME(record models.DNSRecord) string {
+	if record.Type != "CNAME" {
+		return ""
+	}
+	content := strings.ToLower(strings.TrimSuffix(record.Content, "."))
+	if !strings.HasSuffix(content, ".cfargotunnel.com") {
+		return ""
+	}
+	return strings.TrimSuffix(content, ".cfargotunnel.com")
+}
+
+// isTunnelCNAME reports whether a DNS record is a CNAME pointing to the tunnel
+func isTunnelCNAME(record models.DNSRecord, tunnelID string) bool {
+	return record.Type == "CNAME" && strings.EqualFold(strings.TrimSuffix(record.Content, "."), tunnelCNAMETarget(tunnelID))
+}
+
+// GetCloudflareTunnelIngressHostnames returns the distinct hostnames routed by a tunnel's ingress rules
+func (cs *CloudflareService) GetCloudflareTunnelIngressHostnames(ctx context.Context, accountID, tunnelID string) ([]string, error) {
+	config, err := cs.GetCloudflareTunnelConfiguration(ctx, accountID, tunnelID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var hostnames []string
+	for _, rule := range config.Config.Ingress {
+		hostname := normalizeHostname(rule.Hostname)
+		if hostname == "" || seen[hostname] {
+			continue
+		}
+		seen[hostname] = true
+		hostnames = append(hostnames, hostname)
+	}
+	return hostnames, nil
+}
+
+// DeleteTunnelCNAMERecords deletes the CNAME records of the hostnames that point to a tunnel
+// Records of the hostnames pointing anywhere else are left alone. Every hostname is reported,
+// failures don't stop the remaining hostnames from being cleaned up
+func (cs *CloudflareService) DeleteTunnelCNAMERecords(ctx context.Context, accountID, tunnelID string, hostnames []string) []models.TunnelDNSRecordResult {
+	results := []models.TunnelDNSRecordResult{}
+	for _, hostname := range hostnames {
+		result := models.TunnelDNSRecordResult{Hostname: hostname}
+
+		zone, err := cs.ResolveZoneForHostname(ctx, accountID, hostname)
+		if err != nil {
+			result.Status = models.TunnelCleanupFailed
+			if errors.Is(err, ErrZoneNotFound) {
+				result.Status = models.TunnelCleanupZoneNotFound
+			}
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.ZoneID = zone.ID
+		result.ZoneName = zone.Name
+
+		records, err := cs.GetDNSRecordsByName(ctx, zone.ID, hostname)
+		if err != nil {
+			result.Status = models.TunnelCleanupFailed
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		found := false
+		for _, record := range records {
+			if !isTunnelCNAME(record, tunnelID) {
+				continue
+			}
+			found = true
+			recordResult := result
+			recordResult.RecordID = record.ID
+			if err := cs.DeleteDNSRecord(ctx, zone.ID, record.ID); err != nil {
+				recordResult.Status = models.TunnelCleanupFailed
+				recordResult.Error = err.Error()
+			} else {
+				recordResult.Status = models.TunnelCleanupDeleted
+				log.Printf("Deleted DNS record %s for hostname %s of tunnel %s", record.ID, hostname, tunnelID)
+			}
+			results = append(results, recordResult)
+		}
+		if !found {
+			result.Status = models.TunnelCleanupNotFound
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// DeleteCloudflareTunnelWithDNS deletes a tunnel and then the CNAME records of its hostnames that point to it
+// The hostnames are read before the delete, as the configuration is gone with the tunnel. If they can't be read
+// the tunnel is left alone so no records are orphaned
+func (cs *CloudflareService) DeleteCloudflareTunnelWithDNS(ctx context.Context, accountID, tunnelID string) (*models.TunnelDeleteResult, error) {
+	hostnames, err := cs.GetCloudflareTunnelIngressHostnames(ctx, accountID, tunnelID)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the hostnames of tunnel %s, it was not deleted: %w", tunnelID, err)
+	}
+
+	if err := cs.DeleteCloudflareTunnel(ctx, accountID, tunnelID); err != nil {
+		return nil, err
+	}
+
+	result := &models.TunnelDeleteResult{
+		TunnelID:   tunnelID,
+		Deleted:    true,
+		Containers: []models.TunnelContainerResult{},
+		DNSRecords: cs.DeleteTunnelCNAMERecords(ctx, accountID, tunnelID, hostnames),
+	}
+	return result, nil
+}
+
+// tunnelDNSScan is a tunnel DNS report together with the data needed to repair it
+type tunnelDNSScan struct {
+	report models.TunnelDNSReport
+	// records counts the DNS records of every name in the scanned zones
+	records map[string]int
+}
+
+// ScanTunnelDNS cross-references the tunnel CNAME records in every zone of an account with its tunnels and their ingress
+// It reports CNAMEs pointing to tunnels that no longer exist, CNAMEs for hostnames their tunnel doesn't route,
+// and ingress hostnames without a CNAME pointing to their tunnel. Nothing is changed
+func (cs *CloudflareService) ScanTunnelDNS(ctx context.Context, accountID string) (models.TunnelDNSReport, error) {
+	scan, err := cs.scanTunnelDNS(ctx, accountID)
+	if err != nil {
+		return models.TunnelDNSReport{}, err
+	}
+	return scan.report, nil
+}
+
+// RepairTunnelDNS scans the account again and repairs the findings of the given kinds and the findings with the given IDs
+// At least one kind or ID is required. Orphaned CNAMEs are deleted and missing ones created. CNAMEs of tunnels outside
+// the account, hostnames outside the account's zones and hostnames that already have other DNS records are skipped
+func (cs *CloudflareService) RepairTunnelDNS(ctx context.Context, accountID string, kinds, ids []string) (models.TunnelDNSRepairResult, error) {
+	if len(kinds) == 0 && len(ids) == 0 {
+		return models.TunnelDNSRepairResult{}, fmt.Errorf("the kinds or IDs of the findings to repair are required")
+	}
+
+	scan, err := cs.scanTunnelDNS(ctx, accountID)
+	if err != nil {
+		return models.TunnelDNSRepairResult{}, err
+	}
+
+	selectedKinds := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		selectedKinds[kind] = true
+	}
+	selectedIDs := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selectedIDs[id] = true
+	}
+
+	result := models.TunnelDNSRepairResult{
+		Report:  scan.report,
+		Results: []models.TunnelDNSRepairOutcome{},
+	}
+	found := make(map[string]bool)
+	for _, finding := range scan.report.Findings {
+		found[finding.ID] = true
+		if !selectedKinds[finding.Kind] && !selectedIDs[finding.ID] {
+			continue
+		}
+
+		outcome := models.TunnelDNSRepairOutcome{Finding: finding}
+		var repairErr error
+		switch {
+		case finding.Kind == models.TunnelDNSUnknownTunnel:
+			outcome.Action = models.TunnelDNSActionSkip
+			outcome.Error = "the CNAME points to a tunnel outside the account, which may still be in use"
+		case finding.Kind != models.TunnelDNSMissingRecord:
+			outcome.Action = models.TunnelDNSActionDelete
+			repairErr = cs.DeleteDNSRecord(ctx, finding.ZoneID, finding.RecordID)
+		case finding.ZoneID == "":
+			outcome.Action = models.TunnelDNSActionSkip
+			outcome.Error = "the hostname is in none of the account's zones"
+		case scan.records[finding.Hostname] > 0:
+			outcome.Action = models.TunnelDNSActionSkip
+			outcome.Error = "the hostname already has other DNS records"
+		default:
+			outcome.Action = models.TunnelDNSActionCreate
+			_, repairErr = cs.CreateTunnelCNAMERecord(ctx, finding.ZoneID, finding.Hostname, finding.TunnelID, true)
+		}
+
+		switch {
+		case outcome.Action == models.TunnelDNSActionSkip:
+			result.Skipped++
+		case repairErr != nil:
+			outcome.Error = repairErr.Error()
+			result.Failed++
+		default:
+			outcome.Success = true
+			// Deletes come first, so a hostname freed of an orphaned CNAME can get the CNAME of its tunnel
+			if outcome.Action == models.TunnelDNSActionDelete {
+				scan.records[finding.Hostname]--
+			}
+		}
+		result.Results = append(result.Results, outcome)
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+
+	return result, nil
+}
+
+// scanTunnelDNS collects the tunnel DNS findings of an account
+func (cs *CloudflareService) scanTunnelDNS(ctx context.Context, accountID string) (*tunnelDNSScan, error) {
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+
+	tunnels, err := cs.GetCloudflareTunnels(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := cs.ListAllZones(ctx, accountID, models.ZoneFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	scan := &tunnelDNSScan{
+		report: models.TunnelDNSReport{
+			AccountID:      accountID,
+			Findings:       []models.TunnelDNSFinding{},
+			Summary:        make(map[string]int, len(models.TunnelDNSKinds)),
+			ZonesScanned:   len(zones),
+			TunnelsScanned: len(tunnels),
+		},
+		records: make(map[string]int),
+	}
+	for _, kind := range models.TunnelDNSKinds {
+		scan.report.Summary[kind] = 0
+	}
+
+	// Ingress hostnames per tunnel; tunnels missing here have no readable ingress and their records are not judged
+	names := make(map[string]string, len(tunnels))
+	ingress := make(map[string][]string, len(tunnels))
+	for _, tunnel := range tunnels {
+		names[tunnel.ID] = tunnel.Name
+		if !tunnel.RemoteConfig {
+			continue
+		}
+		hostnames, err := cs.GetCloudflareTunnelIngressHostnames(ctx, accountID, tunnel.ID)
+		if err != nil {
+			scan.report.Warnings = append(scan.report.Warnings, fmt.Sprintf("Could not read the ingress of tunnel %s (%s): %v", tunnel.Name, tunnel.ID, err))
+			continue
+		}
+		ingress[tunnel.ID] = hostnames
+	}
+
+	// Tunnels missing from the list are looked up by ID. Only a tunnel the account reports as deleted is gone,
+	// one the account doesn't know may belong to another account
+	deleted := make(map[string]bool)
+	isDeleted := func(tunnelID string) bool {
+		if gone, ok := deleted[tunnelID]; ok {
+			return gone
+		}
+		tunnel, err := cs.GetCloudflareTunnelByID(ctx, accountID, tunnelID)
+		deleted[tunnelID] = err == nil && !tunnel.DeletedAt.IsZero()
+		return deleted[tunnelID]
+	}
+
+	// CNAMEs pointing to each tunnel, by hostname
+	routed := make(map[string]map[string]bool)
+	for _, zone := range zones {
+		records, err := cs.GetDNSRecords(ctx, zone.ID)
+		if err != nil {
+			scan.report.Warnings = append(scan.report.Warnings, fmt.Sprintf("Could not read the DNS records of zone %s: %v", zone.Name, err))
+			continue
+		}
+
+		for _, record := range records {
+			hostname := normalizeHostname(record.Name)
+			scan.records[hostname]++
+
+			tunnelID := tunnelIDFromCNAME(record)
+			if tunnelID == "" {
+				continue
+			}
+			if routed[tunnelID] == nil {
+				routed[tunnelID] = make(map[string]bool)
+			}
+			routed[tunnelID][hostname] = true
+
+			finding := models.TunnelDNSFinding{
+				Hostname: hostname,
+				TunnelID: tunnelID,
+				ZoneID:   zone.ID,
+				ZoneName: zone.Name,
+				RecordID: record.ID,
+			}
+			name, exists := names[tunnelID]
+			hostnames, known := ingress[tunnelID]
+			switch {
+			case !exists && isDeleted(tunnelID):
+				finding.Kind = models.TunnelDNSDeletedTunnel
+				finding.Detail = "the CNAME points to a tunnel that no longer exists"
+			case !exists:
+				finding.Kind = models.TunnelDNSUnknownTunnel
+				finding.Detail = "the CNAME points to a tunnel outside the account, or one that couldn't be looked up"
+			case known && !ingressRoutes(hostnames, hostname) && !wildcardRoutes(hostnames, hostname):
+				finding.Kind = models.TunnelDNSUnroutedHostname
+				finding.TunnelName = name
+				finding.Detail = "the tunnel's ingress doesn't route this hostname"
+			default:
+				continue
+			}
+			finding.ID = tunnelDNSFindingID(finding.Kind, record.ID)
+			scan.report.Add(finding)
+		}
+	}
+
+	for _, tunnel := range tunnels {
+		for _, hostname := range ingress[tunnel.ID] {
+			if routed[tunnel.ID][hostname] || (scan.records[hostname] == 0 && wildcardCovers(routed[tunnel.ID], hostname)) {
+				continue
+			}
+			finding := models.TunnelDNSFinding{
+				Kind:       models.TunnelDNSMissingRecord,
+				Hostname:   hostname,
+				TunnelID:   tunnel.ID,
+				TunnelName: tunnel.Name,
+				Detail:     "no CNAME points this hostname to its tunnel",
+			}
+			if zone := longestZoneSuffix(zones, hostname); zone != nil {
+				finding.ZoneID = zone.ID
+				finding.ZoneName = zone.Name
+				if scan.records[hostname] > 0 {
+					finding.Detail = "the hostname has DNS records, but none points to its tunnel"
+				}
+			} else {
+				finding.Detail = "the hostname is in none of the account's zones"
+			}
+			finding.ID = tunnelDNSFindingID(finding.Kind, tunnel.ID, hostname)
+			scan.report.Add(finding)
+		}
+	}
+
+	return scan, nil
+}
+
+// ingressRoutes reports whether one of the ingress hostnames matches a hostname
+// Like cloudflared, a wildcard rule such as *.example.com matches subdomains at any depth
+func ingressRoutes(ingressHostnames []string, hostname string) bool {
+	for _, rule := range ingressHostnames {
+		if rule == hostname {
+			return true
+		}
+		if strings.HasPrefix(rule, "*.") && strings.HasSuffix(hostname, rule[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardRoutes reports whether a wildcard record such as *.example.com covers one of the ingress hostnames
+func wildcardRoutes(ingressHostnames []string, hostname string) bool {
+	if !strings.HasPrefix(hostname, "*.") {
+		return false
+	}
+	for _, rule := range ingressHostnames {
+		if strings.HasSuffix(rule, hostname[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardCovers reports whether one of the CNAME hostnames is a wildcard answering for a hostname without records of its own
+func wildcardCovers(cnames map[string]bool, hostname string) bool {
+	for name := range cnames {
+		if strings.HasPrefix(name, "*.") && strings.HasSuffix(hostname, name[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// tunnelDNSFindingID derives a stable ID from what identifies a finding, so the same problem keeps its ID across scans
+func tunnelDNSFindingID(kind string, parts ...string) string {
+	sum := sha256.Sum256([]byte(kind + "/" + strings.Join(parts, "/")))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/zero_trust"
+)
+
+// tunnelSecretSize is the size of generated tunnel secrets in bytes, Cloudflare requires at least 32
+const tunnelSecretSize = 32
+
+// tunnelTokenPayload is the content of a tunnel token: base64 encoded JSON naming the account, tunnel and secret
+type tunnelTokenPayload struct {
+	AccountTag   string `json:"a"`
+	TunnelID     string `json:"t"`
+	TunnelSecret string `json:"s"`
+}
+
+// decodeTunnelToken decodes a tunnel token
+// Tokens are standard base64, but copies with the padding stripped or URL-safe characters are accepted too
+func decodeTunnelToken(token string) (tunnelTokenPayload, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return tunnelTokenPayload{}, fmt.Errorf("tunnel token is empty")
+	}
+
+	var raw []byte
+	var err error
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if raw, err = encoding.DecodeString(token); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return tunnelTokenPayload{}, fmt.Errorf("tunnel token is not base64 encoded: %w", err)
+	}
+
+	var payload tunnelTokenPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return tunnelTokenPayload{}, fmt.Errorf("tunnel token is malformed: %w", err)
+	}
+	if payload.TunnelID == "" {
+		return tunnelTokenPayload{}, fmt.Errorf("tunnel token names no tunnel")
+	}
+	return payload, nil
+}
+
+// TunnelIDFromToken returns the ID of the tunnel a token runs
+func TunnelIDFromToken(token string) (string, error) {
+	payload, err := decodeTunnelToken(token)
+	if err != nil {
+		return "", err
+	}
+	return payload.TunnelID, nil
+}
+
+// RotateCloudflareTunnelSecret replaces the secret of a tunnel with a new random one and returns the new token
+// Connectors still running with the old token keep their connections until they are cleaned up, but can't reconnect
+func (cs *CloudflareService) RotateCloudflareTunnelSecret(ctx context.Context, accountID, tunnelID string) (string, error) {
+	if accountID == "" {
+		return "", fmt.Errorf("account ID is required")
+	}
+	if tunnelID == "" {
+		return "", fmt.Errorf("tunnel ID is required")
+	}
+
+	secret := make([]byte, tunnelSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate tunnel secret: %w", err)
+	}
+
+	_, err := cs.client.ZeroTrust.Tunnels.Cloudflared.Edit(ctx, tunnelID, zero_trust.TunnelCloudflaredEditParams{
+		AccountID:    cloudflare.F(accountID),
+		TunnelSecret: cloudflare.F(base64.StdEncoding.EncodeToString(secret)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error rotating the secret of tunnel %s in account %s: %w", tunnelID, accountID, err)
+	}
+
+	return cs.GetCloudflareTunnelToken(ctx, accountID, tunnelID)
+}
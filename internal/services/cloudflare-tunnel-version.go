@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"cfProxyHub/internal/models"
+)
+
+// tunnelConfigLock is the lock of one tunnel configuration, with the number of callers holding or waiting for it
+type tunnelConfigLock struct {
+	sync.Mutex
+	refs int
+}
+
+// tunnelConfigLocks serialises read-modify-write cycles on the same tunnel configuration within the process
+// Locks are dropped once nobody holds or waits for them, so arbitrary tunnel IDs don't accumulate
+var tunnelConfigLocks = struct {
+	mu    sync.Mutex
+	locks map[string]*tunnelConfigLock
+}{locks: make(map[string]*tunnelConfigLock)}
+
+// lockTunnelConfig locks the configuration of a tunnel and returns the function releasing it
+func lockTunnelConfig(tunnelID string) func() {
+	tunnelConfigLocks.mu.Lock()
+	lock, ok := tunnelConfigLocks.locks[tunnelID]
+	if !ok {
+		lock = &tunnelConfigLock{}
+		tunnelConfigLocks.locks[tunnelID] = lock
+	}
+	lock.refs++
+	tunnelConfigLocks.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		tunnelConfigLocks.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(tunnelConfigLocks.locks, tunnelID)
+		}
+		tunnelConfigLocks.mu.Unlock()
+	}
+}
+
+type expectedConfigVersionKey struct{}
+
+// WithExpectedConfigVersion returns a context under which tunnel configuration edits fail with a
+// TunnelConfigConflictError unless the configuration is still at the given version
+func WithExpectedConfigVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, expectedConfigVersionKey{}, version)
+}
+
+// expectedConfigVersion returns the version set by WithExpectedConfigVersion, if any
+func expectedConfigVersion(ctx context.Context) (int64, bool) {
+	version, ok := ctx.Value(expectedConfigVersionKey{}).(int64)
+	return version, ok
+}
+
+// TunnelConfigConflictError is returned when a tunnel configuration changed since the version the caller edited
+type TunnelConfigConflictError struct {
+	TunnelID string
+	Expected int64
+	Current  models.TunnelConfiguration
+}
+
+func (e *TunnelConfigConflictError) Error() string {
+	return fmt.Sprintf("configuration of tunnel %s is at version %d, expected version %d", e.TunnelID, e.Current.Version, e.Expected)
+}
+
+// checkConfigVersion compares the current configuration with the version expected by the caller
+func checkConfigVersion(ctx context.Context, tunnelID string, current *models.TunnelConfiguration) error {
+	expected, ok := expectedConfigVersion(ctx)
+	if !ok || current.Version == expected {
+		return nil
+	}
+	return &TunnelConfigConflictError{
+		TunnelID: tunnelID,
+		Expected: expected,
+		Current:  *current,
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// tunnelConfigLockCount returns the number of tunnel configuration locks in use
+func tunnelConfigLockCount() int {
+	tunnelConfigLocks.mu.Lock()
+	defer tunnelConfigLocks.mu.Unlock()
+	return len(tunnelConfigLocks.locks)
+}
+
+func TestLockTunnelConfigSerialisesAndReleases(t *testing.T) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inside := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(tunnelID string) {
+			defer wg.Done()
+			unlock := lockTunnelConfig(tunnelID)
+			defer unlock()
+
+			mu.Lock()
+			inside[tunnelID]++
+			if inside[tunnelID] > 1 {
+				t.Errorf("two holders of the lock of %s", tunnelID)
+			}
+			mu.Unlock()
+
+			mu.Lock()
+			inside[tunnelID]--
+			mu.Unlock()
+		}(fmt.Sprintf("tunnel-%d", i%5))
+	}
+	wg.Wait()
+
+	if n := tunnelConfigLockCount(); n != 0 {
+		t.Errorf("%d locks left after every holder released them", n)
+	}
+}
+
+func TestLockTunnelConfigKeepsLockWhileWaited(t *testing.T) {
+	unlock := lockTunnelConfig("t1")
+
+	acquired := make(chan func())
+	go func() { acquired <- lockTunnelConfig("t1") }()
+
+	// The waiter holds a reference, so releasing the first holder must not drop the lock
+	for {
+		tunnelConfigLocks.mu.Lock()
+		refs := tunnelConfigLocks.locks["t1"].refs
+		tunnelConfigLocks.mu.Unlock()
+		if refs == 2 {
+			break
+		}
+	}
+	unlock()
+
+	(<-acquired)()
+	if n := tunnelConfigLockCount(); n != 0 {
+		t.Errorf("%d locks left after every holder released them", n)
+	}
+}
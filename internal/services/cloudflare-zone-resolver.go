@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cfProxyHub/internal/models"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ErrZoneNotFound is returned when no zone of the account covers a hostname
+var ErrZoneNotFound = errors.New("no zone found")
+
+const (
+	// zoneCacheTTL is how long the active zones of an account are trusted
+	zoneCacheTTL = 5 * time.Minute
+	// zoneCacheMinRefresh throttles refreshes triggered by hostnames no cached zone covers
+	zoneCacheMinRefresh = 30 * time.Second
+)
+
+// zoneCache holds the active zones of each account for hostname resolution
+type zoneCache struct {
+	mu       sync.Mutex
+	accounts map[string]zoneCacheEntry
+}
+
+type zoneCacheEntry struct {
+	zones     []models.Zone
+	fetchedAt time.Time
+}
+
+func newZoneCache() *zoneCache {
+	return &zoneCache{accounts: make(map[string]zoneCacheEntry)}
+}
+
+// get returns the cached zones of an account and when they were fetched
+func (c *zoneCache) get(accountID string) (zoneCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.accounts[accountID]
+	return entry, ok
+}
+
+func (c *zoneCache) set(accountID string, zones []models.Zone) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accounts[accountID] = zoneCacheEntry{zones: zones, fetchedAt: time.Now()}
+}
+
+// invalidate drops the cached zones of all accounts
+func (c *zoneCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accounts = make(map[string]zoneCacheEntry)
+}
+
+// ResolveZoneForHostname finds the zone of the account a hostname belongs to
+// The longest matching active zone wins, so app.dev.example.com resolves to a delegated dev.example.com zone
+// and app.example.co.uk to example.co.uk. Hostnames no active zone covers fall back to the
+// registrable domain from the Public Suffix List, which also finds zones that aren't active yet
+func (cs *CloudflareService) ResolveZoneForHostname(ctx context.Context, accountID, hostname string) (*models.Zone, error) {
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	hostname = normalizeHostname(hostname)
+	if hostname == "" {
+		return nil, fmt.Errorf("hostname is required")
+	}
+
+	entry, ok := cs.zones.get(accountID)
+	if !ok || time.Since(entry.fetchedAt) > zoneCacheTTL {
+		if err := cs.refreshZoneCache(ctx, accountID); err != nil {
+			return nil, err
+		}
+		entry, _ = cs.zones.get(accountID)
+	}
+
+	if zone := longestZoneSuffix(entry.zones, hostname); zone != nil {
+		return zone, nil
+	}
+
+	// The zone may have been added since the cache was filled
+	if time.Since(entry.fetchedAt) > zoneCacheMinRefresh {
+		if err := cs.refreshZoneCache(ctx, accountID); err != nil {
+			return nil, err
+		}
+		entry, _ = cs.zones.get(accountID)
+		if zone := longestZoneSuffix(entry.zones, hostname); zone != nil {
+			return zone, nil
+		}
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	if err != nil {
+		return nil, fmt.Errorf("%w for hostname %s in account %s: %v", ErrZoneNotFound, hostname, accountID, err)
+	}
+	zone, err := cs.GetZoneByName(ctx, accountID, domain)
+	if err != nil {
+		if strings.Contains(err.Error(), "zone not found") {
+			return nil, fmt.Errorf("%w for hostname %s in account %s", ErrZoneNotFound, hostname, accountID)
+		}
+		return nil, err
+	}
+
+	log.Printf("Resolved hostname %s to non-active zone %s (%s)", hostname, zone.Name, zone.Status)
+	return zone, nil
+}
+
+// InvalidateZoneCache forgets the cached zones so the next resolution sees zone changes immediately
+func (cs *CloudflareService) InvalidateZoneCache() {
+	cs.zones.invalidate()
+}
+
+// refreshZoneCache refetches the active zones of an account
+func (cs *CloudflareService) refreshZoneCache(ctx context.Context, accountID string) error {
+	zones, err := cs.GetActiveZones(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to load zones for hostname resolution: %w", err)
+	}
+	cs.zones.set(accountID, zones)
+	return nil
+}
+
+// longestZoneSuffix returns the zone with the longest name the hostname equals or is a subdomain of
+func longestZoneSuffix(zones []models.Zone, hostname string) *models.Zone {
+	var best *models.Zone
+	for i := range zones {
+		name := normalizeHostname(zones[i].Name)
+		if hostname != name && !strings.HasSuffix(hostname, "."+name) {
+			continue
+		}
+		if best == nil || len(name) > len(best.Name) {
+			best = &zones[i]
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	zone := *best
+	return &zone
+}
+
+// normalizeHostname lowercases a hostname and strips the trailing dot of a fully qualified name
+func normalizeHostname(hostname string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), ".")
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strings"
+	"strconv"
 
 	"cfProxyHub/internal/models"
 
 	"github.com/cloudflare/cloudflare-go/v4"
 	"github.com/cloudflare/cloudflare-go/v4/dns"
+	"github.com/cloudflare/cloudflare-go/v4/packages/pagination"
+	"github.com/cloudflare/cloudflare-go/v4/shared"
 	"github.com/cloudflare/cloudflare-go/v4/zones"
 )
 
@@ -21,55 +23,93 @@ func (s *CloudflareService) GetZonesByAccountID(ctx context.Context, accountID s
 
 	log.Printf("Fetching zones for account: %s", accountID)
 
-	params := zones.ZoneListParams{
-		Account: cloudflare.F(zones.ZoneListParamsAccount{
-			ID: cloudflare.F(accountID),
-		}),
+	result, err := s.ListAllZones(ctx, accountID, models.ZoneFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Successfully fetched %d zones for account %s", len(result), accountID)
+	return result, nil
+}
+
+// ListZones retrieves one page of the zones of an account matching the filter
+func (s *CloudflareService) ListZones(ctx context.Context, accountID string, filter models.ZoneFilter) ([]models.Zone, models.ResultInfo, error) {
+	if accountID == "" {
+		return nil, models.ResultInfo{}, fmt.Errorf("account ID is required")
+	}
+
+	log.Printf("Listing zones for account: %s (page %d)", accountID, filter.Page)
+
+	params := newZoneListParams(accountID, filter)
+	if filter.Page > 0 {
+		params.Page = cloudflare.F(float64(filter.Page))
+	}
+	if filter.PerPage > 0 {
+		params.PerPage = cloudflare.F(float64(filter.PerPage))
 	}
 
 	zoneList, err := s.client.Zones.List(ctx, params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch zones: %w", err)
+		return nil, models.ResultInfo{}, fmt.Errorf("failed to fetch zones: %w", err)
 	}
 
-	var result []models.Zone
+	result := make([]models.Zone, 0, len(zoneList.Result))
 	for _, zone := range zoneList.Result {
-		result = append(result, models.Zone{
-			ID:                  zone.ID,
-			Name:                zone.Name,
-			Status:              string(zone.Status),
-			Type:                string(zone.Type),
-			DevelopmentMode:     int(zone.DevelopmentMode),
-			NameServers:         zone.NameServers,
-			OriginalNameServers: zone.OriginalNameServers,
-			OriginalRegistrar:   zone.OriginalRegistrar,
-			OriginalDNSHost:     zone.OriginalDnshost,
-			ModifiedOn:          zone.ModifiedOn,
-			CreatedOn:           zone.CreatedOn,
-			ActivatedOn:         zone.ActivatedOn,
-		})
+		result = append(result, newZone(zone))
 	}
 
-	log.Printf("Successfully fetched %d zones for account %s", len(result), accountID)
-	return result, nil
+	info := newResultInfo(zoneList.ResultInfo, len(result))
+	log.Printf("Successfully listed %d of %d zones for account %s", info.Count, info.TotalCount, accountID)
+	return result, info, nil
 }
 
-// GetZoneByID retrieves a specific zone by ID
-func (s *CloudflareService) GetZoneByID(ctx context.Context, zoneID string) (*models.Zone, error) {
-	if zoneID == "" {
-		return nil, fmt.Errorf("zone ID is required")
+// ListAllZones retrieves every zone of an account matching the filter, following all pages
+func (s *CloudflareService) ListAllZones(ctx context.Context, accountID string, filter models.ZoneFilter) ([]models.Zone, error) {
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
 	}
 
-	log.Printf("Fetching zone: %s", zoneID)
+	params := newZoneListParams(accountID, filter)
+	params.PerPage = cloudflare.F(float64(50))
 
-	zone, err := s.client.Zones.Get(ctx, zones.ZoneGetParams{
-		ZoneID: cloudflare.F(zoneID),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch zone: %w", err)
+	var result []models.Zone
+	autopager := s.client.Zones.ListAutoPaging(ctx, params)
+	for autopager.Next() {
+		result = append(result, newZone(autopager.Current()))
+	}
+
+	if autopager.Err() != nil {
+		return nil, fmt.Errorf("failed to fetch zones: %w", autopager.Err())
 	}
 
-	result := models.Zone{
+	return result, nil
+}
+
+// newZoneListParams converts a zone filter to list parameters, without paging
+func newZoneListParams(accountID string, filter models.ZoneFilter) zones.ZoneListParams {
+	params := zones.ZoneListParams{
+		Account: cloudflare.F(zones.ZoneListParamsAccount{
+			ID: cloudflare.F(accountID),
+		}),
+	}
+	if filter.Name != "" {
+		params.Name = cloudflare.F(filter.Name)
+	}
+	if filter.Status != "" {
+		params.Status = cloudflare.F(zones.ZoneListParamsStatus(filter.Status))
+	}
+	if filter.Order != "" {
+		params.Order = cloudflare.F(zones.ZoneListParamsOrder(filter.Order))
+	}
+	if filter.Direction != "" {
+		params.Direction = cloudflare.F(zones.ZoneListParamsDirection(filter.Direction))
+	}
+	return params
+}
+
+// newZone converts a zone returned by the API
+func newZone(zone zones.Zone) models.Zone {
+	return models.Zone{
 		ID:                  zone.ID,
 		Name:                zone.Name,
 		Status:              string(zone.Status),
@@ -83,6 +123,24 @@ func (s *CloudflareService) GetZoneByID(ctx context.Context, zoneID string) (*mo
 		CreatedOn:           zone.CreatedOn,
 		ActivatedOn:         zone.ActivatedOn,
 	}
+}
+
+// GetZoneByID retrieves a specific zone by ID
+func (s *CloudflareService) GetZoneByID(ctx context.Context, zoneID string) (*models.Zone, error) {
+	if zoneID == "" {
+		return nil, fmt.Errorf("zone ID is required")
+	}
+
+	log.Printf("Fetching zone: %s", zoneID)
+
+	zone, err := s.client.Zones.Get(ctx, zones.ZoneGetParams{
+		ZoneID: cloudflare.F(zoneID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch zone: %w", err)
+	}
+
+	result := newZone(*zone)
 	log.Printf("Successfully fetched zone: %s (%s)", zone.Name, zone.ID)
 	return &result, nil
 }
@@ -114,21 +172,7 @@ func (s *CloudflareService) GetZoneByName(ctx context.Context, accountID, domain
 		return nil, fmt.Errorf("zone not found: %s", domainName)
 	}
 
-	zone := zoneList.Result[0]
-	result := models.Zone{
-		ID:                  zone.ID,
-		Name:                zone.Name,
-		Status:              string(zone.Status),
-		Type:                string(zone.Type),
-		DevelopmentMode:     int(zone.DevelopmentMode),
-		NameServers:         zone.NameServers,
-		OriginalNameServers: zone.OriginalNameServers,
-		OriginalRegistrar:   zone.OriginalRegistrar,
-		OriginalDNSHost:     zone.OriginalDnshost,
-		ModifiedOn:          zone.ModifiedOn,
-		CreatedOn:           zone.CreatedOn,
-		ActivatedOn:         zone.ActivatedOn,
-	}
+	result := newZone(zoneList.Result[0])
 	log.Printf("Successfully fetched zone by name: %s (%s)", result.Name, result.ID)
 	return &result, nil
 }
@@ -141,36 +185,11 @@ func (s *CloudflareService) GetActiveZones(ctx context.Context, accountID string
 
 	log.Printf("Fetching active zones for account: %s", accountID)
 
-	params := zones.ZoneListParams{
-		Account: cloudflare.F(zones.ZoneListParamsAccount{
-			ID: cloudflare.F(accountID),
-		}),
-		Status: cloudflare.F(zones.ZoneListParamsStatusActive),
-	}
-
-	zoneList, err := s.client.Zones.List(ctx, params)
+	result, err := s.ListAllZones(ctx, accountID, models.ZoneFilter{Status: string(zones.ZoneListParamsStatusActive)})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch active zones: %w", err)
 	}
 
-	var result []models.Zone
-	for _, zone := range zoneList.Result {
-		result = append(result, models.Zone{
-			ID:                  zone.ID,
-			Name:                zone.Name,
-			Status:              string(zone.Status),
-			Type:                string(zone.Type),
-			DevelopmentMode:     int(zone.DevelopmentMode),
-			NameServers:         zone.NameServers,
-			OriginalNameServers: zone.OriginalNameServers,
-			OriginalRegistrar:   zone.OriginalRegistrar,
-			OriginalDNSHost:     zone.OriginalDnshost,
-			ModifiedOn:          zone.ModifiedOn,
-			CreatedOn:           zone.CreatedOn,
-			ActivatedOn:         zone.ActivatedOn,
-		})
-	}
-
 	log.Printf("Successfully fetched %d active zones for account %s", len(result), accountID)
 	return result, nil
 }
@@ -183,40 +202,11 @@ func (s *CloudflareService) SearchZones(ctx context.Context, accountID, searchTe
 
 	log.Printf("Searching zones for account: %s, term: %s", accountID, searchTerm)
 
-	params := zones.ZoneListParams{
-		Account: cloudflare.F(zones.ZoneListParamsAccount{
-			ID: cloudflare.F(accountID),
-		}),
-	}
-
-	// If search term is provided, add it to the search
-	if searchTerm != "" {
-		params.Name = cloudflare.F(searchTerm)
-	}
-
-	zoneList, err := s.client.Zones.List(ctx, params)
+	result, err := s.ListAllZones(ctx, accountID, models.ZoneFilter{Name: searchTerm})
 	if err != nil {
 		return nil, fmt.Errorf("failed to search zones: %w", err)
 	}
 
-	var result []models.Zone
-	for _, zone := range zoneList.Result {
-		result = append(result, models.Zone{
-			ID:                  zone.ID,
-			Name:                zone.Name,
-			Status:              string(zone.Status),
-			Type:                string(zone.Type),
-			DevelopmentMode:     int(zone.DevelopmentMode),
-			NameServers:         zone.NameServers,
-			OriginalNameServers: zone.OriginalNameServers,
-			OriginalRegistrar:   zone.OriginalRegistrar,
-			OriginalDNSHost:     zone.OriginalDnshost,
-			ModifiedOn:          zone.ModifiedOn,
-			CreatedOn:           zone.CreatedOn,
-			ActivatedOn:         zone.ActivatedOn,
-		})
-	}
-
 	log.Printf("Successfully found %d zones matching search term '%s' for account %s", len(result), searchTerm, accountID)
 	return result, nil
 }
@@ -292,16 +282,90 @@ func (s *CloudflareService) GetDNSRecords(ctx context.Context, zoneID string) ([
 		ZoneID: cloudflare.F(zoneID),
 	}
 
+	autopager := s.client.DNS.Records.ListAutoPaging(ctx, params)
+
+	var result []models.DNSRecord
+	for autopager.Next() {
+		result = append(result, autopager.Current())
+	}
+
+	if autopager.Err() != nil {
+		return nil, fmt.Errorf("failed to fetch DNS records: %w", autopager.Err())
+	}
+
+	log.Printf("Successfully fetched %d DNS records for zone %s", len(result), zoneID)
+	return result, nil
+}
+
+// ListDNSRecords retrieves one page of the DNS records of a zone matching the filter
+func (s *CloudflareService) ListDNSRecords(ctx context.Context, zoneID string, filter models.DNSRecordFilter) ([]models.DNSRecord, models.ResultInfo, error) {
+	if zoneID == "" {
+		return nil, models.ResultInfo{}, fmt.Errorf("zone ID is required")
+	}
+
+	log.Printf("Listing DNS records for zone: %s (page %d)", zoneID, filter.Page)
+
+	params := dns.RecordListParams{
+		ZoneID: cloudflare.F(zoneID),
+	}
+	if filter.Type != "" {
+		params.Type = cloudflare.F(dns.RecordListParamsType(filter.Type))
+	}
+	if filter.Name != "" {
+		params.Name = cloudflare.F(dns.RecordListParamsName{Exact: cloudflare.F(filter.Name)})
+	}
+	if filter.Content != "" {
+		params.Content = cloudflare.F(dns.RecordListParamsContent{Exact: cloudflare.F(filter.Content)})
+	}
+	if filter.Search != "" {
+		params.Search = cloudflare.F(filter.Search)
+	}
+	if filter.Proxied != nil {
+		params.Proxied = cloudflare.F(*filter.Proxied)
+	}
+	if filter.Page > 0 {
+		params.Page = cloudflare.F(float64(filter.Page))
+	}
+	if filter.PerPage > 0 {
+		params.PerPage = cloudflare.F(float64(filter.PerPage))
+	}
+	if filter.Order != "" {
+		params.Order = cloudflare.F(dns.RecordListParamsOrder(filter.Order))
+	}
+	if filter.Direction != "" {
+		params.Direction = cloudflare.F(shared.SortDirection(filter.Direction))
+	}
+
 	records, err := s.client.DNS.Records.List(ctx, params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch DNS records: %w", err)
+		return nil, models.ResultInfo{}, fmt.Errorf("failed to list DNS records: %w", err)
 	}
 
 	result := make([]models.DNSRecord, len(records.Result))
 	copy(result, records.Result)
 
-	log.Printf("Successfully fetched %d DNS records for zone %s", len(result), zoneID)
-	return result, nil
+	info := newResultInfo(records.ResultInfo, len(result))
+	log.Printf("Successfully listed %d of %d DNS records for zone %s", info.Count, info.TotalCount, zoneID)
+	return result, info, nil
+}
+
+// GetDNSRecord retrieves a single DNS record of a zone
+func (s *CloudflareService) GetDNSRecord(ctx context.Context, zoneID, recordID string) (*models.DNSRecord, error) {
+	if zoneID == "" {
+		return nil, fmt.Errorf("zone ID is required")
+	}
+	if recordID == "" {
+		return nil, fmt.Errorf("record ID is required")
+	}
+
+	record, err := s.client.DNS.Records.Get(ctx, recordID, dns.RecordGetParams{
+		ZoneID: cloudflare.F(zoneID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch DNS record %s: %w", recordID, err)
+	}
+
+	return record, nil
 }
 
 // GetDNSRecordsByName retrieves DNS records by name for a zone
@@ -402,21 +466,9 @@ func (s *CloudflareService) CreateZone(ctx context.Context, accountID, domainNam
 		return nil, fmt.Errorf("failed to create zone: %w", err)
 	}
 
-	result := models.Zone{
-		ID:                  zone.ID,
-		Name:                zone.Name,
-		Status:              string(zone.Status),
-		Type:                string(zone.Type),
-		DevelopmentMode:     int(zone.DevelopmentMode),
-		NameServers:         zone.NameServers,
-		OriginalNameServers: zone.OriginalNameServers,
-		OriginalRegistrar:   zone.OriginalRegistrar,
-		OriginalDNSHost:     zone.OriginalDnshost,
-		ModifiedOn:          zone.ModifiedOn,
-		CreatedOn:           zone.CreatedOn,
-		ActivatedOn:         zone.ActivatedOn,
-	}
+	result := newZone(*zone)
 
+	s.InvalidateZoneCache()
 	log.Printf("Successfully created zone: %s (%s)", zone.Name, zone.ID)
 	return &result, nil
 }
@@ -439,21 +491,9 @@ func (s *CloudflareService) UpdateZone(ctx context.Context, zoneID string, pause
 		return nil, fmt.Errorf("failed to update zone: %w", err)
 	}
 
-	result := models.Zone{
-		ID:                  zone.ID,
-		Name:                zone.Name,
-		Status:              string(zone.Status),
-		Type:                string(zone.Type),
-		DevelopmentMode:     int(zone.DevelopmentMode),
-		NameServers:         zone.NameServers,
-		OriginalNameServers: zone.OriginalNameServers,
-		OriginalRegistrar:   zone.OriginalRegistrar,
-		OriginalDNSHost:     zone.OriginalDnshost,
-		ModifiedOn:          zone.ModifiedOn,
-		CreatedOn:           zone.CreatedOn,
-		ActivatedOn:         zone.ActivatedOn,
-	}
+	result := newZone(*zone)
 
+	s.InvalidateZoneCache()
 	log.Printf("Successfully updated zone: %s (%s)", zone.Name, zone.ID)
 	return &result, nil
 }
@@ -475,16 +515,24 @@ func (s *CloudflareService) DeleteZone(ctx context.Context, zoneID string) error
 		return fmt.Errorf("failed to delete zone: %w", err)
 	}
 
+	s.InvalidateZoneCache()
 	log.Printf("Successfully deleted zone: %s", zoneID)
 	return nil
 }
 
-// Helper function to extract domain from hostname
-func extractDomain(hostname string) string {
-	parts := strings.Split(hostname, ".")
-	if len(parts) < 2 {
-		return hostname
+// newResultInfo converts the paging metadata of a list response
+// The SDK only models page and per_page, the totals come from the raw result_info
+func newResultInfo(info pagination.V4PagePaginationArrayResultInfo, count int) models.ResultInfo {
+	result := models.ResultInfo{
+		Page:    int(info.Page),
+		PerPage: int(info.PerPage),
+		Count:   count,
+	}
+	if field, ok := info.JSON.ExtraFields["total_count"]; ok {
+		result.TotalCount, _ = strconv.Atoi(field.Raw())
+	}
+	if field, ok := info.JSON.ExtraFields["total_pages"]; ok {
+		result.TotalPages, _ = strconv.Atoi(field.Raw())
 	}
-	// Return the last two parts joined (this is a simple approach)
-	return strings.Join(parts[len(parts)-2:], ".")
+	return result
 }
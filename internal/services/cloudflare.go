@@ -9,6 +9,7 @@ import (
 
 type CloudflareService struct {
 	client *cloudflare.Client
+	zones  *zoneCache
 }
 
 // NewCloudflareService creates a new Cloudflare service instance
@@ -29,6 +30,7 @@ func NewCloudflareService(apiToken, apiKey, email string) (*CloudflareService, e
 
 	service := &CloudflareService{
 		client: client,
+		zones:  newZoneCache(),
 	}
 
 	return service, nil
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cfProxyHub/internal/models"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Container labels recognised by the auto-exposer
+// Example: docker run -l cfproxyhub.hostname=app.example.com -l cfproxyhub.service=http://app:3000 ...
+const (
+	LabelHostname = "cfproxyhub.hostname"
+	LabelService  = "cfproxyhub.service"
+	LabelPath     = "cfproxyhub.path"
+	LabelTunnel   = "cfproxyhub.tunnel"
+	LabelAccount  = "cfproxyhub.account"
+)
+
+// ContainerExposure describes a public hostname requested through container labels
+type ContainerExposure struct {
+	ContainerID   string    `json:"container_id"`
+	ContainerName string    `json:"container_name"`
+	AccountID     string    `json:"account_id"`
+	TunnelID      string    `json:"tunnel_id"`
+	Hostname      string    `json:"hostname"`
+	Service       string    `json:"service"`
+	Path          string    `json:"path,omitempty"`
+	ExposedAt     time.Time `json:"exposed_at"`
+}
+
+// key identifies the ingress rule an exposure maps to, independent of the container
+func (e ContainerExposure) key() string {
+	return strings.Join([]string{e.AccountID, e.TunnelID, e.Hostname, e.Path}, "|")
+}
+
+// ExposureFromLabels builds the exposure requested by a container's labels
+// Returns false if the container doesn't carry the hostname/service labels or no tunnel can be resolved
+func ExposureFromLabels(c types.Container, defaultAccountID, defaultTunnelID string) (ContainerExposure, bool) {
+	hostname := strings.ToLower(strings.TrimSpace(c.Labels[LabelHostname]))
+	service := strings.TrimSpace(c.Labels[LabelService])
+	if hostname == "" || service == "" {
+		return ContainerExposure{}, false
+	}
+
+	exposure := ContainerExposure{
+		ContainerID: c.ID,
+		AccountID:   defaultAccountID,
+		TunnelID:    defaultTunnelID,
+		Hostname:    hostname,
+		Service:     service,
+		Path:        strings.TrimSpace(c.Labels[LabelPath]),
+	}
+	if len(c.Names) > 0 {
+		exposure.ContainerName = strings.TrimPrefix(c.Names[0], "/")
+	}
+	if account := strings.TrimSpace(c.Labels[LabelAccount]); account != "" {
+		exposure.AccountID = account
+	}
+	if tunnel := strings.TrimSpace(c.Labels[LabelTunnel]); tunnel != "" {
+		exposure.TunnelID = tunnel
+	}
+
+	if exposure.AccountID == "" || exposure.TunnelID == "" {
+		return ContainerExposure{}, false
+	}
+
+	return exposure, true
+}
+
+// DockerAutoExposer publishes labelled containers as tunnel public hostnames
+// and removes the hostnames again once the containers stop or are removed
+// It reacts to changes in the watcher's cache and retries failed operations every interval
+// Only rules it created itself are changed or withdrawn; they are optionally persisted to a JSON file,
+// so hostnames of containers that went away while cfProxyHub was down are withdrawn after a restart
+type DockerAutoExposer struct {
+	watcher          *DockerWatcher
+	cf               *CloudflareService
+	defaultAccountID string
+	defaultTunnelID  string
+	interval         time.Duration
+	path             string
+
+	// syncMu serialises reconciliations, mu only guards the exposed map so it can be read while Cloudflare is called
+	syncMu  sync.Mutex
+	mu      sync.Mutex
+	exposed map[string]ContainerExposure
+}
+
+// NewDockerAutoExposer creates a new DockerAutoExposer instance, an empty path keeps the exposed hostnames in memory only
+func NewDockerAutoExposer(watcher *DockerWatcher, cf *CloudflareService, defaultAccountID, defaultTunnelID string, interval time.Duration, path string) (*DockerAutoExposer, error) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	e := &DockerAutoExposer{
+		watcher:          watcher,
+		cf:               cf,
+		defaultAccountID: defaultAccountID,
+		defaultTunnelID:  defaultTunnelID,
+		interval:         interval,
+		path:             path,
+		exposed:          make(map[string]ContainerExposure),
+	}
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Start runs the reconciliation loop until the context is cancelled
+func (e *DockerAutoExposer) Start(ctx context.Context) {
+	changes := e.watcher.Subscribe()
+
+	reconcileNow := func() {
+		if !e.watcher.Synced() {
+			// Don't withdraw hostnames just because the daemon is unreachable
+			return
+		}
+		syncCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+		if err := e.reconcile(syncCtx, e.watcher.Containers()); err != nil {
+			log.Printf("Warning: Docker auto-expose sync failed: %v", err)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		// The watcher may have finished its initial sync before the subscription, so its notification was missed
+		reconcileNow()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changes:
+			case <-ticker.C:
+			}
+			reconcileNow()
+		}
+	}()
+}
+
+// Exposures returns the hostnames currently managed by the auto-exposer
+func (e *DockerAutoExposer) Exposures() []ContainerExposure {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := make([]ContainerExposure, 0, len(e.exposed))
+	for _, exposure := range e.exposed {
+		result = append(result, exposure)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Hostname < result[j].Hostname
+	})
+	return result
+}
+
+// Sync resyncs the container cache and reconciles the tunnel hostnames against it
+func (e *DockerAutoExposer) Sync(ctx context.Context) error {
+	if err := e.watcher.Resync(ctx); err != nil {
+		return err
+	}
+
+	return e.reconcile(ctx, e.watcher.Containers())
+}
+
+// reconcile exposes newly labelled containers and withdraws hostnames whose containers went away
+// Cloudflare is called on a snapshot of the exposed hostnames, the map is only locked to read and update it
+func (e *DockerAutoExposer) reconcile(ctx context.Context, containers []types.Container) error {
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+
+	e.mu.Lock()
+	exposed := make(map[string]ContainerExposure, len(e.exposed))
+	for key, exposure := range e.exposed {
+		exposed[key] = exposure
+	}
+	e.mu.Unlock()
+
+	desired := make(map[string]ContainerExposure)
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+		exposure, ok := ExposureFromLabels(c, e.defaultAccountID, e.defaultTunnelID)
+		if !ok {
+			continue
+		}
+		desired[exposure.key()] = exposure
+	}
+
+	var errs []string
+	changed := false
+
+	for key, exposure := range desired {
+		if current, ok := exposed[key]; ok {
+			if current.Service == exposure.Service {
+				// Already exposed, just follow the container in case it was recreated
+				if current.ContainerID != exposure.ContainerID || current.ContainerName != exposure.ContainerName {
+					current.ContainerID = exposure.ContainerID
+					current.ContainerName = exposure.ContainerName
+					exposed[key] = current
+					changed = true
+				}
+				continue
+			}
+
+			// The service label changed, repoint the rule we manage
+			if err := e.reexpose(ctx, current, exposure); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			exposure.ExposedAt = time.Now()
+			exposed[key] = exposure
+			changed = true
+			continue
+		}
+
+		if err := e.expose(ctx, exposure); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		exposure.ExposedAt = time.Now()
+		exposed[key] = exposure
+		changed = true
+	}
+
+	for key, exposure := range exposed {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+
+		if err := e.unexpose(ctx, exposure); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		delete(exposed, key)
+		changed = true
+	}
+
+	e.mu.Lock()
+	e.exposed = exposed
+	e.mu.Unlock()
+
+	if changed {
+		if err := e.save(exposed); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// expose creates the ingress rule and CNAME for an exposure
+// An existing rule for the hostname and path wasn't created by the auto-exposer and is never taken over
+func (e *DockerAutoExposer) expose(ctx context.Context, exposure ContainerExposure) error {
+	rule, err := e.findRule(ctx, exposure)
+	if err != nil {
+		return err
+	}
+	if rule != nil {
+		return fmt.Errorf("hostname %s%s is already routed to %s on tunnel %s and not managed by cfProxyHub, not overriding it for container %s", exposure.Hostname, exposure.Path, rule.Service, exposure.TunnelID, exposure.ContainerName)
+	}
+
+	hostnameRule := models.NewPublicHostnameRule(models.NewPublicHostnameIngressParam(exposure.Hostname, exposure.Service, exposure.Path))
+	if _, err := e.cf.CreateCloudflareTunnelPublicHostnameWithDNS(ctx, exposure.AccountID, exposure.TunnelID, exposure.Hostname, hostnameRule); err != nil {
+		return fmt.Errorf("error exposing container %s as %s: %w", exposure.ContainerName, exposure.Hostname, err)
+	}
+
+	log.Printf("Exposed container %s as %s%s -> %s", exposure.ContainerName, exposure.Hostname, exposure.Path, exposure.Service)
+	return nil
+}
+
+// reexpose points an already managed ingress rule at the exposure's new service
+// A rule changed by hand since it was exposed is left alone, a removed one is created again
+func (e *DockerAutoExposer) reexpose(ctx context.Context, current, exposure ContainerExposure) error {
+	rule, err := e.findRule(ctx, exposure)
+	if err != nil {
+		return err
+	}
+	if rule == nil {
+		return e.expose(ctx, exposure)
+	}
+	if rule.Service != current.Service {
+		return fmt.Errorf("hostname %s%s was changed outside cfProxyHub to %s, not updating it for container %s", exposure.Hostname, exposure.Path, rule.Service, exposure.ContainerName)
+	}
+
+	hostnameRule := models.NewPublicHostnameRule(models.NewPublicHostnameIngressParam(exposure.Hostname, exposure.Service, exposure.Path))
+	if _, err := e.cf.UpdateCloudflareTunnelPublicHostnameWithDNS(ctx, exposure.AccountID, exposure.TunnelID, exposure.Hostname, exposure.Path, exposure.Hostname, hostnameRule); err != nil {
+		return fmt.Errorf("error updating hostname %s for container %s: %w", exposure.Hostname, exposure.ContainerName, err)
+	}
+
+	log.Printf("Updated hostname %s%s of container %s -> %s", exposure.Hostname, exposure.Path, exposure.ContainerName, exposure.Service)
+	return nil
+}
+
+// unexpose removes the ingress rule and CNAME of an exposure
+// A rule changed by hand since it was exposed is kept and no longer managed
+func (e *DockerAutoExposer) unexpose(ctx context.Context, exposure ContainerExposure) error {
+	rule, err := e.findRule(ctx, exposure)
+	if err != nil {
+		return err
+	}
+	if rule == nil {
+		// Somebody already removed it by hand
+		return nil
+	}
+	if rule.Service != exposure.Service {
+		log.Printf("Hostname %s%s was changed outside cfProxyHub to %s, leaving it in place", exposure.Hostname, exposure.Path, rule.Service)
+		return nil
+	}
+
+	if _, err := e.cf.DeleteCloudflareTunnelPublicHostnameWithDNS(ctx, exposure.AccountID, exposure.TunnelID, exposure.Hostname, exposure.Path); err != nil {
+		if errors.Is(err, ErrHostnameNotFound) {
+			return nil
+		}
+		return fmt.Errorf("error withdrawing hostname %s of container %s: %w", exposure.Hostname, exposure.ContainerName, err)
+	}
+
+	log.Printf("Withdrew hostname %s%s of container %s", exposure.Hostname, exposure.Path, exposure.ContainerName)
+	return nil
+}
+
+// findRule returns the tunnel's ingress rule for the exposure's hostname and path, nil if there is none
+func (e *DockerAutoExposer) findRule(ctx context.Context, exposure ContainerExposure) (*models.PublicHostnameIngress, error) {
+	rules, err := e.cf.GetCloudflareTunnelPublicHostnames(ctx, exposure.AccountID, exposure.TunnelID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hostnames of tunnel %s: %w", exposure.TunnelID, err)
+	}
+
+	if i := findHostnameRule(rules, exposure.Hostname, exposure.Path); i >= 0 {
+		return &rules[i], nil
+	}
+	return nil, nil
+}
+
+// load reads the persisted exposures
+func (e *DockerAutoExposer) load() error {
+	if e.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(e.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read Docker auto-expose store: %w", err)
+	}
+
+	var exposures []ContainerExposure
+	if err := json.Unmarshal(data, &exposures); err != nil {
+		return fmt.Errorf("failed to parse Docker auto-expose store %s: %w", e.path, err)
+	}
+	for _, exposure := range exposures {
+		e.exposed[exposure.key()] = exposure
+	}
+
+	log.Printf("Loaded %d exposed hostnames from %s", len(e.exposed), e.path)
+	return nil
+}
+
+// save writes the exposures to the store file, if one is configured
+func (e *DockerAutoExposer) save(exposed map[string]ContainerExposure) error {
+	if e.path == "" {
+		return nil
+	}
+
+	exposures := make([]ContainerExposure, 0, len(exposed))
+	for _, exposure := range exposed {
+		exposures = append(exposures, exposure)
+	}
+	sort.Slice(exposures, func(i, j int) bool {
+		return exposures[i].key() < exposures[j].key()
+	})
+
+	data, err := json.MarshalIndent(exposures, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode exposed hostnames: %w", err)
+	}
+	if err := writeFileAtomic(e.path, data); err != nil {
+		return fmt.Errorf("failed to save exposed hostnames: %w", err)
+	}
+	return nil
+}
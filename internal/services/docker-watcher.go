@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Container events that change what the cache holds
+var watchedContainerEvents = []events.Action{
+	events.ActionCreate,
+	events.ActionStart,
+	events.ActionStop,
+	events.ActionDie,
+	events.ActionDestroy,
+	events.ActionRename,
+	events.ActionHealthStatus,
+}
+
+// DockerWatcherStatus describes the connection state of the watcher
+type DockerWatcherStatus struct {
+	Connected      bool      `json:"connected"`
+	Synced         bool      `json:"synced"`
+	LastSync       time.Time `json:"last_sync"`
+	LastEvent      time.Time `json:"last_event"`
+	LastError      string    `json:"last_error,omitempty"`
+	ContainerCount int       `json:"container_count"`
+	TunnelCount    int       `json:"tunnel_count"`
+}
+
+// DockerWatcher follows the Docker events stream and keeps an in-memory cache of containers
+// It reconnects with exponential backoff whenever the daemon goes away
+type DockerWatcher struct {
+	docker     *DockerService
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu          sync.RWMutex
+	containers  map[string]types.Container
+	status      DockerWatcherStatus
+	subscribers []chan struct{}
+	startOnce   sync.Once
+}
+
+// NewDockerWatcher creates a new DockerWatcher instance
+func NewDockerWatcher(docker *DockerService) *DockerWatcher {
+	return &DockerWatcher{
+		docker:     docker,
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		containers: make(map[string]types.Container),
+	}
+}
+
+// Start runs the watcher until the context is cancelled
+func (w *DockerWatcher) Start(ctx context.Context) {
+	w.startOnce.Do(func() {
+		go w.run(ctx)
+	})
+}
+
+// Subscribe returns a channel that receives a signal whenever the cache changes
+// Signals are coalesced, so a slow reader only sees the latest change
+func (w *DockerWatcher) Subscribe() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	w.subscribers = append(w.subscribers, ch)
+	return ch
+}
+
+// Synced reports whether the cache reflects the daemon's current state
+func (w *DockerWatcher) Synced() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.status.Synced
+}
+
+// Status returns the current connection state of the watcher
+func (w *DockerWatcher) Status() DockerWatcherStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	status := w.status
+	status.ContainerCount = len(w.containers)
+	status.TunnelCount = len(FilterCloudflareTunnelContainers(w.containerList()))
+	return status
+}
+
+// Containers returns all cached containers, running or not
+func (w *DockerWatcher) Containers() []types.Container {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.containerList()
+}
+
+// TunnelContainers returns the cached Cloudflare tunnel containers
+func (w *DockerWatcher) TunnelContainers() []types.Container {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return FilterCloudflareTunnelContainers(w.containerList())
+}
+
+// Resync replaces the cache with a fresh container listing from the daemon
+func (w *DockerWatcher) Resync(ctx context.Context) error {
+	containers, err := w.docker.ListContainers(ctx)
+	if err != nil {
+		w.setError(err)
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	w.mu.Lock()
+	w.containers = make(map[string]types.Container, len(containers))
+	for _, c := range containers {
+		w.containers[c.ID] = c
+	}
+	w.status.Connected = true
+	w.status.Synced = true
+	w.status.LastSync = time.Now()
+	w.status.LastError = ""
+	w.mu.Unlock()
+
+	w.notify()
+	return nil
+}
+
+// containerList returns the cached containers sorted by creation time; callers must hold the lock
+func (w *DockerWatcher) containerList() []types.Container {
+	result := make([]types.Container, 0, len(w.containers))
+	for _, c := range w.containers {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created > result[j].Created
+	})
+	return result
+}
+
+// run keeps the events subscription alive, backing off between reconnection attempts
+func (w *DockerWatcher) run(ctx context.Context) {
+	backoff := w.minBackoff
+
+	for {
+		synced, err := w.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.Printf("Warning: Docker events stream lost: %v", err)
+			w.setError(err)
+		}
+		if synced {
+			// The previous connection worked, start over with a short delay
+			backoff = w.minBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+	}
+}
+
+// watch subscribes to the events stream, resyncs the cache and applies events until the stream breaks
+func (w *DockerWatcher) watch(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := filters.NewArgs()
+	args.Add("type", string(events.ContainerEventType))
+	for _, action := range watchedContainerEvents {
+		args.Add("event", string(action))
+	}
+
+	// Subscribe before listing so no event between the two is lost
+	messages, errs := w.docker.Events(ctx, args)
+
+	if err := w.Resync(ctx); err != nil {
+		return false, err
+	}
+	log.Printf("Docker watcher synced %d containers", len(w.Containers()))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case err := <-errs:
+			return true, err
+		case msg := <-messages:
+			w.apply(ctx, msg)
+		}
+	}
+}
+
+// apply updates the cache entry of the container an event refers to
+func (w *DockerWatcher) apply(ctx context.Context, msg events.Message) {
+	id := msg.Actor.ID
+	if id == "" {
+		return
+	}
+
+	w.mu.Lock()
+	w.status.LastEvent = time.Now()
+	w.mu.Unlock()
+
+	if msg.Action == events.ActionDestroy {
+		w.remove(id)
+		return
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	c, found, err := w.docker.GetContainer(lookupCtx, id)
+	if err != nil {
+		log.Printf("Warning: Could not refresh container %s after %s event: %v", id, msg.Action, err)
+		return
+	}
+	if !found {
+		w.remove(id)
+		return
+	}
+
+	w.mu.Lock()
+	w.containers[id] = c
+	w.mu.Unlock()
+
+	w.notify()
+}
+
+// remove drops a container from the cache
+func (w *DockerWatcher) remove(id string) {
+	w.mu.Lock()
+	delete(w.containers, id)
+	w.mu.Unlock()
+
+	w.notify()
+}
+
+// setError marks the cache as stale after the daemon became unreachable
+func (w *DockerWatcher) setError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.status.Connected = false
+	w.status.Synced = false
+	w.status.LastError = err.Error()
+}
+
+// notify signals every subscriber without blocking
+func (w *DockerWatcher) notify() {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for _, ch := range w.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -3,10 +3,12 @@ package services
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
@@ -155,6 +157,9 @@ func (ds *DockerService) StopContainer(ctx context.Context, id string) error {
 	return ds.cli.ContainerStop(ctx, id, container.StopOptions{Timeout: &timeout})
 }
 
+// TunnelIDLabel is the label of cloudflared containers created by cfProxyHub naming the tunnel they run
+const TunnelIDLabel = "com.cloudflare.tunnel.id"
+
 // CloudflareTunnelParams contains parameters for creating a Cloudflare Tunnel container
 type CloudflareTunnelParams struct {
 	Name          string `json:"name"`
@@ -185,27 +190,60 @@ func (ds *DockerService) CreateCloudflareTunnelContainer(ctx context.Context, pa
 		restartPolicy = container.RestartPolicy{Name: container.RestartPolicyAlways}
 	}
 
-	// Command to run the tunnel with the provided token
-	cmd := []string{"tunnel", "--no-autoupdate", "run", "--token", params.Token}
+	cmd, labels := tunnelContainerConfig(params.Token)
 
 	// Pull the image first to ensure we have the latest
-	_, err := ds.cli.ImagePull(ctx, "cloudflare/cloudflared:latest", image.PullOptions{})
+	if err := ds.pullCloudflaredImage(ctx); err != nil {
+		return "", err
+	}
+
+	return ds.createTunnelContainer(ctx, containerName, cmd, labels, restartPolicy)
+}
+
+// tunnelContainerConfig returns the command and labels of a cloudflared container running a token
+func tunnelContainerConfig(token string) ([]string, map[string]string) {
+	// Command to run the tunnel with the provided token
+	cmd := []string{"tunnel", "--no-autoupdate", "run", "--token", token}
+
+	labels := map[string]string{
+		"com.cloudflare.tunnel": "true",
+		"app":                   "cloudflared",
+		"service":               "tunnel",
+		"managed-by":            "cfproxyhub",
+	}
+	if tunnelID, err := TunnelIDFromToken(token); err == nil {
+		labels[TunnelIDLabel] = tunnelID
+	}
+	return cmd, labels
+}
+
+// cloudflaredImage is the image of the cloudflared containers
+const cloudflaredImage = "cloudflare/cloudflared:latest"
+
+// pullCloudflaredImage pulls the cloudflared image, waiting for the pull to complete
+func (ds *DockerService) pullCloudflaredImage(ctx context.Context) error {
+	reader, err := ds.cli.ImagePull(ctx, cloudflaredImage, image.PullOptions{})
 	if err != nil {
-		return "", fmt.Errorf("failed to pull Cloudflare cloudflared image: %w", err)
+		return fmt.Errorf("failed to pull Cloudflare cloudflared image: %w", err)
 	}
+	defer reader.Close()
 
+	// The pull only progresses while its output is read
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return fmt.Errorf("failed to pull Cloudflare cloudflared image: %w", err)
+	}
+	return nil
+}
+
+// createTunnelContainer creates a cloudflared container with exactly the given name from the pulled image
+func (ds *DockerService) createTunnelContainer(ctx context.Context, containerName string, cmd []string, labels map[string]string, restartPolicy container.RestartPolicy) (string, error) {
 	// Create the Cloudflare tunnel container with multiple labels
 	resp, err := ds.cli.ContainerCreate(
 		ctx,
 		&container.Config{
-			Image: "cloudflare/cloudflared:latest",
-			Cmd:   cmd,
-			Labels: map[string]string{
-				"com.cloudflare.tunnel": "true",
-				"app":                   "cloudflared",
-				"service":               "tunnel",
-				"managed-by":            "cfproxyhub",
-			},
+			Image:  cloudflaredImage,
+			Cmd:    cmd,
+			Labels: labels,
 		},
 		&container.HostConfig{
 			RestartPolicy: restartPolicy,
@@ -223,32 +261,30 @@ func (ds *DockerService) CreateCloudflareTunnelContainer(ctx context.Context, pa
 
 // FindCloudflareTunnelContainers finds all containers running Cloudflare tunnels
 func (ds *DockerService) FindCloudflareTunnelContainers(ctx context.Context) ([]types.Container, error) {
-	// Try first with the label filter
-	args := filters.NewArgs()
-	args.Add("label", "com.cloudflare.tunnel=true")
-
-	// List containers with the filter
-	labeledContainers, err := ds.cli.ContainerList(ctx, container.ListOptions{
-		All:     true,
-		Filters: args,
+	allContainers, err := ds.cli.ContainerList(ctx, container.ListOptions{
+		All: true,
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error listing labeled containers: %w", err)
+		return nil, fmt.Errorf("error listing all containers: %w", err)
 	}
 
-	// If we found labeled containers, return them
-	if len(labeledContainers) > 0 {
-		return labeledContainers, nil
-	}
+	return FilterCloudflareTunnelContainers(allContainers), nil
+}
 
-	// As a fallback, look for cloudflare container names or images
-	allContainers, err := ds.cli.ContainerList(ctx, container.ListOptions{
-		All: true,
-	})
+// FilterCloudflareTunnelContainers picks the Cloudflare tunnel containers out of a container list
+// Containers labelled com.cloudflare.tunnel=true win; if there are none, fall back to image and name matching
+func FilterCloudflareTunnelContainers(allContainers []types.Container) []types.Container {
+	var labeledContainers []types.Container
+	for _, c := range allContainers {
+		if c.Labels["com.cloudflare.tunnel"] == "true" {
+			labeledContainers = append(labeledContainers, c)
+		}
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("error listing all containers: %w", err)
+	// If we found labeled containers, return them
+	if len(labeledContainers) > 0 {
+		return labeledContainers
 	}
 
 	var tunnelContainers []types.Container
@@ -273,7 +309,141 @@ func (ds *DockerService) FindCloudflareTunnelContainers(ctx context.Context) ([]
 		}
 	}
 
-	return tunnelContainers, nil
+	return tunnelContainers
+}
+
+// FindManagedTunnelContainers finds the cloudflared containers created by cfProxyHub that run a tunnel
+// Containers created before the tunnel ID label existed are matched by the token in their command
+func (ds *DockerService) FindManagedTunnelContainers(ctx context.Context, tunnelID string) ([]types.Container, error) {
+	args := filters.NewArgs()
+	args.Add("label", "managed-by=cfproxyhub")
+	args.Add("label", "com.cloudflare.tunnel=true")
+
+	containers, err := ds.cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: args,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing cloudflared containers: %w", err)
+	}
+
+	var matching []types.Container
+	for _, c := range containers {
+		if containerTunnelID(c) == tunnelID {
+			matching = append(matching, c)
+		}
+	}
+	return matching, nil
+}
+
+// containerTunnelID returns the ID of the tunnel a cloudflared container runs, empty if unknown
+func containerTunnelID(c types.Container) string {
+	if id := c.Labels[TunnelIDLabel]; id != "" {
+		return id
+	}
+
+	args := strings.Fields(c.Command)
+	for i, arg := range args {
+		token := ""
+		switch {
+		case arg == "--token" && i+1 < len(args):
+			token = args[i+1]
+		case strings.HasPrefix(arg, "--token="):
+			token = strings.TrimPrefix(arg, "--token=")
+		default:
+			continue
+		}
+		if id, err := TunnelIDFromToken(token); err == nil {
+			return id
+		}
+	}
+	return ""
+}
+
+// RecreateCloudflareTunnelContainer replaces a cloudflared container by one with the same name and restart policy running a new token
+// The new container is created under a temporary name and started if the old one was running, and only then takes the
+// name of the old one, which is removed. If any step fails the new container is removed and the old one left as it was.
+// Returns the ID of the new container
+func (ds *DockerService) RecreateCloudflareTunnelContainer(ctx context.Context, id, token string) (string, error) {
+	info, err := ds.cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %w", id, err)
+	}
+
+	name := strings.TrimPrefix(info.Name, "/")
+	restartPolicy := container.RestartPolicy{Name: container.RestartPolicyAlways}
+	if info.HostConfig != nil {
+		restartPolicy = info.HostConfig.RestartPolicy
+	}
+	running := info.State != nil && info.State.Running
+
+	if err := ds.pullCloudflaredImage(ctx); err != nil {
+		return "", err
+	}
+
+	cmd, labels := tunnelContainerConfig(token)
+	newID, err := ds.createTunnelContainer(ctx, name+"-recreated", cmd, labels, restartPolicy)
+	if err != nil {
+		return "", err
+	}
+
+	// discard removes the new container, leaving the old one in place
+	discard := func(cause error) (string, error) {
+		if err := ds.RemoveContainer(ctx, newID); err != nil {
+			return "", fmt.Errorf("%w, and the new container %s could not be removed: %v", cause, newID, err)
+		}
+		return "", cause
+	}
+
+	if running {
+		if err := ds.StartContainer(ctx, newID); err != nil {
+			return discard(fmt.Errorf("new container for %s failed to start, the old one was kept: %w", name, err))
+		}
+	}
+
+	// Swap the names, then the old container can go
+	if err := ds.cli.ContainerRename(ctx, id, name+"-replaced"); err != nil {
+		return discard(fmt.Errorf("failed to rename container %s, it was kept: %w", name, err))
+	}
+	if err := ds.cli.ContainerRename(ctx, newID, name); err != nil {
+		if restoreErr := ds.cli.ContainerRename(ctx, id, name); restoreErr != nil {
+			return discard(fmt.Errorf("failed to rename the new container to %s: %v, and the old one keeps the name %s-replaced: %w", name, err, name, restoreErr))
+		}
+		return discard(fmt.Errorf("failed to rename the new container to %s, the old one was kept: %w", name, err))
+	}
+
+	if err := ds.RemoveContainer(ctx, id); err != nil {
+		return newID, fmt.Errorf("container %s was recreated, but the old container %s-replaced could not be removed: %w", name, name, err)
+	}
+	return newID, nil
+}
+
+// GetContainer returns the list entry of a single container
+// The boolean result is false if the container no longer exists
+func (ds *DockerService) GetContainer(ctx context.Context, id string) (types.Container, bool, error) {
+	args := filters.NewArgs()
+	args.Add("id", id)
+
+	containers, err := ds.cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: args,
+	})
+	if err != nil {
+		return types.Container{}, false, fmt.Errorf("error listing container %s: %w", id, err)
+	}
+
+	for _, c := range containers {
+		if c.ID == id {
+			return c, true, nil
+		}
+	}
+
+	return types.Container{}, false, nil
+}
+
+// Events subscribes to the Docker events stream with the given filters
+func (ds *DockerService) Events(ctx context.Context, args filters.Args) (<-chan events.Message, <-chan error) {
+	return ds.cli.Events(ctx, events.ListOptions{Filters: args})
 }
 
 // InspectContainer gets detailed information about a container
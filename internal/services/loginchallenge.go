@@ -0,0 +1,95 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Two-factor login challenges expire quickly and allow only a few wrong codes
+const (
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+)
+
+// LoginChallenge is a password login waiting for its second factor
+// Enroll is set for users the policy requires to set up two-factor authentication first
+type LoginChallenge struct {
+	Username  string
+	Enroll    bool
+	ExpiresAt time.Time
+	attempts  int
+}
+
+// LoginChallengeStore holds the logins that passed the password check but still need a TOTP code
+type LoginChallengeStore struct {
+	mu         sync.Mutex
+	challenges map[string]*LoginChallenge
+}
+
+// NewLoginChallengeStore creates an in-memory challenge store
+func NewLoginChallengeStore() *LoginChallengeStore {
+	return &LoginChallengeStore{
+		challenges: make(map[string]*LoginChallenge),
+	}
+}
+
+// Create starts a challenge for the user and returns its token
+func (s *LoginChallengeStore) Create(username string, enroll bool) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate login challenge: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, challenge := range s.challenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(s.challenges, key)
+		}
+	}
+	s.challenges[hashToken(token)] = &LoginChallenge{
+		Username:  username,
+		Enroll:    enroll,
+		ExpiresAt: now.Add(loginChallengeTTL),
+	}
+	return token, nil
+}
+
+// Get returns the pending challenge of a token
+func (s *LoginChallengeStore) Get(token string) (LoginChallenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	challenge, ok := s.challenges[hashToken(token)]
+	if !ok || time.Now().After(challenge.ExpiresAt) {
+		return LoginChallenge{}, false
+	}
+	return *challenge, true
+}
+
+// Fail counts a wrong code and drops the challenge once it used up its attempts
+func (s *LoginChallengeStore) Fail(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hashToken(token)
+	if challenge, ok := s.challenges[key]; ok {
+		challenge.attempts++
+		if challenge.attempts >= loginChallengeMaxAttempts {
+			delete(s.challenges, key)
+		}
+	}
+}
+
+// Delete ends a challenge
+func (s *LoginChallengeStore) Delete(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.challenges, hashToken(token))
+}
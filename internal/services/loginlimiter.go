@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginLockedError is returned while a source IP or username is locked out after failed logins
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// loginFailures tracks the failed logins of one source IP or username
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginLimiter throttles password guessing per source IP and per username
+// Once a key has used up its free attempts, every further failure locks it out for twice as long
+// as the previous one, up to the maximum lockout. Failures are forgotten after a quiet period
+type LoginLimiter struct {
+	mu          sync.Mutex
+	failures    map[string]*loginFailures
+	maxPerUser  int
+	maxPerIP    int
+	maxLockout  time.Duration
+	resetAfter  time.Duration
+	baseLockout time.Duration
+}
+
+// NewLoginLimiter creates a login limiter
+// maxPerUser and maxPerIP are the failures allowed before lockouts start, zero disables that limit
+func NewLoginLimiter(maxPerUser, maxPerIP int, maxLockout time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		failures:    make(map[string]*loginFailures),
+		maxPerUser:  maxPerUser,
+		maxPerIP:    maxPerIP,
+		maxLockout:  maxLockout,
+		resetAfter:  maxLockout,
+		baseLockout: time.Second,
+	}
+}
+
+// Check returns a LoginLockedError if the source IP or the username is locked out
+func (l *LoginLimiter) Check(ip, username string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, key := range l.keys(ip, username) {
+		if f, ok := l.failures[key]; ok && now.Before(f.lockedUntil) {
+			if wait := f.lockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Failure records a failed login and returns the lockout it triggered, if any
+func (l *LoginLimiter) Failure(ip, username string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.pruneLocked(now)
+
+	var lockout time.Duration
+	for _, key := range l.keys(ip, username) {
+		f, ok := l.failures[key]
+		if !ok {
+			f = &loginFailures{}
+			l.failures[key] = f
+		}
+		f.count++
+		f.lastFailure = now
+
+		free := l.maxPerUser
+		if strings.HasPrefix(key, "ip:") {
+			free = l.maxPerIP
+		}
+		if f.count <= free {
+			continue
+		}
+
+		// 1s, 2s, 4s, ... capped at the maximum lockout
+		wait := l.maxLockout
+		if exponent := f.count - free - 1; exponent < 30 {
+			if backoff := l.baseLockout << exponent; backoff < wait {
+				wait = backoff
+			}
+		}
+		f.lockedUntil = now.Add(wait)
+		if wait > lockout {
+			lockout = wait
+		}
+	}
+	return lockout
+}
+
+// Success forgets the failed logins of the username
+// The source IP keeps its count, so logging into one account doesn't reset guesses at others
+func (l *LoginLimiter) Success(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, "user:"+strings.ToLower(username))
+}
+
+// keys returns the limiter keys that apply to a login attempt
+func (l *LoginLimiter) keys(ip, username string) []string {
+	var keys []string
+	if l.maxPerIP > 0 && ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	if l.maxPerUser > 0 && username != "" {
+		keys = append(keys, "user:"+strings.ToLower(username))
+	}
+	return keys
+}
+
+// pruneLocked forgets keys without failures during the quiet period
+func (l *LoginLimiter) pruneLocked(now time.Time) {
+	for key, f := range l.failures {
+		if now.After(f.lockedUntil) && now.Sub(f.lastFailure) > l.resetAfter {
+			delete(l.failures, key)
+		}
+	}
+}
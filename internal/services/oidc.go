@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cfProxyHub/internal/config"
+	"cfProxyHub/internal/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcLoginTimeout is how long a user has to complete the login at the identity provider
+const oidcLoginTimeout = 10 * time.Minute
+
+var (
+	// ErrOIDCInvalidState is returned when a callback doesn't belong to a login started by this server
+	ErrOIDCInvalidState = errors.New("invalid or expired login state")
+	// ErrOIDCNoRole is returned when none of the user's groups maps to a role and there is no default role
+	ErrOIDCNoRole = errors.New("none of your groups grants access")
+)
+
+// OIDCIdentity is a user authenticated by the identity provider
+type OIDCIdentity struct {
+	Username string
+	Groups   []string
+	Role     models.Role
+}
+
+// oidcPendingLogin is a login redirected to the identity provider, waiting for its callback
+type oidcPendingLogin struct {
+	nonce     string
+	verifier  string
+	expiresAt time.Time
+}
+
+// OIDCProvider signs users in through an OpenID Connect identity provider
+// using the authorization code flow with PKCE
+// The provider is discovered on first use so the server starts even when it is unreachable
+type OIDCProvider struct {
+	cfg *config.Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	pending  map[string]oidcPendingLogin
+}
+
+// NewOIDCProvider creates the OIDC provider, returns nil when single sign-on isn't configured
+func NewOIDCProvider(cfg *config.Config) (*OIDCProvider, error) {
+	if !cfg.OIDCEnabled() {
+		return nil, nil
+	}
+	if cfg.OIDCDefaultRole != "" && !models.Role(cfg.OIDCDefaultRole).Valid() {
+		return nil, fmt.Errorf("OIDC_DEFAULT_ROLE must be viewer, operator or admin")
+	}
+
+	return &OIDCProvider{
+		cfg:     cfg,
+		pending: make(map[string]oidcPendingLogin),
+	}, nil
+}
+
+// Name returns the display name of the identity provider
+func (p *OIDCProvider) Name() string {
+	return p.cfg.OIDCProviderName
+}
+
+// discover fetches the provider metadata once
+func (p *OIDCProvider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.cfg.OIDCIssuerURL)
+	if err != nil {
+		return fmt.Errorf("failed to discover OIDC provider %s: %w", p.cfg.OIDCIssuerURL, err)
+	}
+
+	p.provider = provider
+	p.oauth = oauth2.Config{
+		ClientID:     p.cfg.OIDCClientID,
+		ClientSecret: p.cfg.OIDCClientSecret,
+		RedirectURL:  p.cfg.OIDCRedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.OIDCScopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.OIDCClientID})
+	return nil
+}
+
+// StartLogin begins a login and returns its state and the URL to redirect the browser to
+func (p *OIDCProvider) StartLogin(ctx context.Context) (string, string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	p.mu.Lock()
+	p.prunePendingLocked()
+	p.pending[state] = oidcPendingLogin{
+		nonce:     nonce,
+		verifier:  verifier,
+		expiresAt: time.Now().Add(oidcLoginTimeout),
+	}
+	p.mu.Unlock()
+
+	url := p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return state, url, nil
+}
+
+// FinishLogin exchanges the authorization code of a callback and verifies the ID token
+func (p *OIDCProvider) FinishLogin(ctx context.Context, state, code string) (*OIDCIdentity, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(login.expiresAt) {
+		return nil, ErrOIDCInvalidState
+	}
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response contains no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+	if idToken.Nonce != login.nonce {
+		return nil, fmt.Errorf("ID token nonce does not match")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse ID token claims: %w", err)
+	}
+	return p.identity(claims)
+}
+
+// identity maps the ID token claims to a username and role
+func (p *OIDCProvider) identity(claims map[string]interface{}) (*OIDCIdentity, error) {
+	usernameClaim := p.cfg.OIDCUsernameClaim
+	username, _ := lookupClaim(claims, usernameClaim).(string)
+	if username == "" {
+		usernameClaim = "email"
+		username, _ = claims["email"].(string)
+	}
+	if username == "" {
+		return nil, fmt.Errorf("ID token has no %s or email claim", p.cfg.OIDCUsernameClaim)
+	}
+	if usernameClaim == "email" {
+		if verified, ok := claims["email_verified"].(bool); ok && !verified {
+			return nil, fmt.Errorf("email address %s is not verified", username)
+		}
+	}
+
+	groups := claimStrings(lookupClaim(claims, p.cfg.OIDCGroupsClaim))
+	role, ok := p.mapRole(groups)
+	if !ok {
+		return nil, ErrOIDCNoRole
+	}
+
+	return &OIDCIdentity{
+		Username: username,
+		Groups:   groups,
+		Role:     role,
+	}, nil
+}
+
+// mapRole returns the highest role granted by the groups, or the default role
+func (p *OIDCProvider) mapRole(groups []string) (models.Role, bool) {
+	return mapGroupsToRole(groups, []groupRole{
+		{models.RoleAdmin, p.cfg.OIDCAdminGroups},
+		{models.RoleOperator, p.cfg.OIDCOperatorGroups},
+		{models.RoleViewer, p.cfg.OIDCViewerGroups},
+	}, models.Role(p.cfg.OIDCDefaultRole))
+}
+
+// prunePendingLocked drops logins that were never completed
+func (p *OIDCProvider) prunePendingLocked() {
+	now := time.Now()
+	for state, login := range p.pending {
+		if now.After(login.expiresAt) {
+			delete(p.pending, state)
+		}
+	}
+}
+
+// groupRole lists the groups granting a role
+type groupRole struct {
+	role   models.Role
+	groups []string
+}
+
+// mapGroupsToRole returns the first role, ordered from highest, one of the groups grants
+// Falls back to the default role, if valid
+func mapGroupsToRole(groups []string, mapping []groupRole, defaultRole models.Role) (models.Role, bool) {
+	member := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		member[group] = true
+	}
+	for _, entry := range mapping {
+		for _, group := range entry.groups {
+			if member[group] {
+				return entry.role, true
+			}
+		}
+	}
+	if defaultRole.Valid() {
+		return defaultRole, true
+	}
+	return "", false
+}
+
+// lookupClaim resolves a claim name, dots descend into nested objects such as realm_access.roles
+func lookupClaim(claims map[string]interface{}, name string) interface{} {
+	if value, ok := claims[name]; ok {
+		return value
+	}
+	var value interface{} = claims
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	return value
+}
+
+// claimStrings converts a claim holding a string or a list of strings
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// randomToken returns 32 random bytes, base64url encoded
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
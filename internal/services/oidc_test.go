@@ -0,0 +1,403 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cfProxyHub/internal/config"
+	"cfProxyHub/internal/models"
+)
+
+// testSigner signs JWTs with an RSA key and serves the matching JWKS
+type testSigner struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// newTestSigner generates a signing key
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return &testSigner{key: key, kid: "test-key"}
+}
+
+// sign returns an RS256 JWT carrying the claims
+func (s *testSigner) sign(claims map[string]any) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.kid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// serveJWKS writes the public key as a JSON Web Key Set
+func (s *testSigner) serveJWKS(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": s.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+// testIssuerCode is an authorization code handed out by the test issuer
+type testIssuerCode struct {
+	challenge string
+	claims    map[string]any
+}
+
+// testIssuer is an OpenID Connect provider serving discovery, JWKS and token endpoints
+type testIssuer struct {
+	*httptest.Server
+	signer *testSigner
+
+	mu    sync.Mutex
+	codes map[string]testIssuerCode
+}
+
+// newTestIssuer starts the issuer
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	issuer := &testIssuer{signer: newTestSigner(t), codes: make(map[string]testIssuerCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                issuer.URL,
+			"authorization_endpoint":                issuer.URL + "/authorize",
+			"token_endpoint":                        issuer.URL + "/token",
+			"jwks_uri":                              issuer.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", issuer.signer.serveJWKS)
+	mux.HandleFunc("/token", issuer.token)
+
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// authorize stands in for the user signing in: it issues a code for the login of an authorization URL
+// The ID token of the code carries the claims, and the nonce of the login unless the claims set one
+func (i *testIssuer) authorize(t *testing.T, authURL string, claims map[string]any) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no S256 PKCE challenge: %s", authURL)
+	}
+
+	full := map[string]any{
+		"iss":   i.URL,
+		"aud":   query.Get("client_id"),
+		"sub":   "user-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		full[name] = value
+	}
+
+	code := "code-" + query.Get("state")
+	i.mu.Lock()
+	i.codes[code] = testIssuerCode{challenge: query.Get("code_challenge"), claims: full}
+	i.mu.Unlock()
+	return code
+}
+
+// token exchanges a code for an ID token after checking the PKCE verifier against the challenge
+func (i *testIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	i.mu.Lock()
+	code, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	digest := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(digest[:]) != code.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := i.signer.sign(code.claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// newTestOIDCProvider creates a provider using the issuer
+func newTestOIDCProvider(t *testing.T, issuer *testIssuer, configure func(*config.Config)) *OIDCProvider {
+	t.Helper()
+	cfg := &config.Config{
+		OIDCIssuerURL:     issuer.URL,
+		OIDCClientID:      "cfproxyhub",
+		OIDCClientSecret:  "secret",
+		OIDCRedirectURL:   "http://localhost/auth/oidc/callback",
+		OIDCScopes:        []string{"openid", "email"},
+		OIDCUsernameClaim: "preferred_username",
+		OIDCGroupsClaim:   "groups",
+		OIDCAdminGroups:   []string{"admins"},
+		OIDCViewerGroups:  []string{"staff"},
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	provider, err := NewOIDCProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return provider
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer, nil)
+	ctx := context.Background()
+
+	state, authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, map[string]any{"preferred_username": "alice", "groups": []string{"staff", "admins"}})
+
+	identity, err := provider.FinishLogin(ctx, state, code)
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if identity.Username != "alice" || identity.Role != models.RoleAdmin {
+		t.Errorf("identity = %+v, want alice as admin", identity)
+	}
+
+	// A state can only be used once
+	if _, err := provider.FinishLogin(ctx, state, code); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Errorf("reused state: got %v, want ErrOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCLoginStateMismatch(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer, nil)
+	ctx := context.Background()
+
+	_, authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, map[string]any{"preferred_username": "alice", "groups": "admins"})
+
+	if _, err := provider.FinishLogin(ctx, "forged-state", code); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Errorf("got %v, want ErrOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCLoginExpiredState(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer, nil)
+	ctx := context.Background()
+
+	state, authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, map[string]any{"preferred_username": "alice", "groups": "admins"})
+
+	provider.mu.Lock()
+	login := provider.pending[state]
+	login.expiresAt = time.Now().Add(-time.Second)
+	provider.pending[state] = login
+	provider.mu.Unlock()
+
+	if _, err := provider.FinishLogin(ctx, state, code); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Errorf("got %v, want ErrOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCLoginNonceMismatch(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer, nil)
+	ctx := context.Background()
+
+	state, authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, map[string]any{"preferred_username": "alice", "groups": "admins", "nonce": "replayed"})
+
+	_, err = provider.FinishLogin(ctx, state, code)
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("got %v, want a nonce mismatch", err)
+	}
+}
+
+func TestOIDCLoginSendsPKCEVerifier(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer, nil)
+	ctx := context.Background()
+
+	state, authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, map[string]any{"preferred_username": "alice", "groups": "admins"})
+
+	// A verifier not matching the challenge of the authorization URL is refused by the issuer
+	provider.mu.Lock()
+	login := provider.pending[state]
+	login.verifier = "not-the-verifier-of-the-challenge-not-the-verifier"
+	provider.pending[state] = login
+	provider.mu.Unlock()
+
+	if _, err := provider.FinishLogin(ctx, state, code); err == nil || !strings.Contains(err.Error(), "exchange") {
+		t.Errorf("got %v, want the code exchange to fail", err)
+	}
+}
+
+func TestOIDCLoginNestedGroupsClaim(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer, func(cfg *config.Config) {
+		cfg.OIDCGroupsClaim = "realm_access.roles"
+	})
+	ctx := context.Background()
+
+	state, authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, map[string]any{
+		"preferred_username": "bob",
+		"realm_access":       map[string]any{"roles": []string{"staff"}},
+	})
+
+	identity, err := provider.FinishLogin(ctx, state, code)
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if identity.Role != models.RoleViewer || !reflect.DeepEqual(identity.Groups, []string{"staff"}) {
+		t.Errorf("identity = %+v, want viewer from realm_access.roles", identity)
+	}
+}
+
+func TestOIDCLoginNoRole(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := newTestOIDCProvider(t, issuer, nil)
+	ctx := context.Background()
+
+	state, authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, map[string]any{"preferred_username": "eve", "groups": []string{"contractors"}})
+
+	if _, err := provider.FinishLogin(ctx, state, code); !errors.Is(err, ErrOIDCNoRole) {
+		t.Errorf("got %v, want ErrOIDCNoRole", err)
+	}
+}
+
+func TestMapGroupsToRole(t *testing.T) {
+	mapping := []groupRole{
+		{models.RoleAdmin, []string{"admins"}},
+		{models.RoleOperator, []string{"ops", "sre"}},
+		{models.RoleViewer, []string{"staff"}},
+	}
+
+	tests := []struct {
+		name        string
+		groups      []string
+		defaultRole models.Role
+		wantRole    models.Role
+		wantOK      bool
+	}{
+		{"highest role wins", []string{"staff", "sre", "admins"}, "", models.RoleAdmin, true},
+		{"any group of a role", []string{"sre"}, "", models.RoleOperator, true},
+		{"group names are case sensitive", []string{"Admins"}, "", "", false},
+		{"no group falls back to the default", []string{"contractors"}, models.RoleViewer, models.RoleViewer, true},
+		{"invalid default grants nothing", nil, "superuser", "", false},
+		{"no group and no default", nil, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, ok := mapGroupsToRole(tt.groups, mapping, tt.defaultRole)
+			if role != tt.wantRole || ok != tt.wantOK {
+				t.Errorf("got %q, %v, want %q, %v", role, ok, tt.wantRole, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLookupClaim(t *testing.T) {
+	claims := map[string]interface{}{
+		"groups":       []interface{}{"staff"},
+		"realm_access": map[string]interface{}{"roles": []interface{}{"admins"}},
+		"resource":     map[string]interface{}{"app": map[string]interface{}{"roles": "ops"}},
+		"dotted.claim": "literal",
+	}
+
+	tests := []struct {
+		name string
+		want interface{}
+	}{
+		{"groups", []interface{}{"staff"}},
+		{"realm_access.roles", []interface{}{"admins"}},
+		{"resource.app.roles", "ops"},
+		{"dotted.claim", "literal"},
+		{"realm_access.missing", nil},
+		{"groups.nested", nil},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lookupClaim(claims, tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookupClaim(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
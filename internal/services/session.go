@@ -0,0 +1,267 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cfProxyHub/internal/models"
+)
+
+// ErrInvalidSession is returned for tokens that are unknown, expired, idle for too long or revoked
+var ErrInvalidSession = errors.New("invalid session")
+
+// sessionTouchInterval throttles how often last-seen updates are written to the session file
+const sessionTouchInterval = time.Minute
+
+// Session is a logged-in user's session
+type Session struct {
+	Username   string      `json:"username"`
+	Role       models.Role `json:"role"`
+	CreatedAt  time.Time   `json:"created_at"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+	LastSeenAt time.Time   `json:"last_seen_at"`
+	RemoteAddr string      `json:"remote_addr,omitempty"`
+	UserAgent  string      `json:"user_agent,omitempty"`
+}
+
+// SessionStore issues random session tokens and tracks their expiry, idle timeout and revocation
+// Sessions live in memory and are optionally persisted to a JSON file so they survive restarts.
+// Only the SHA-256 hashes of tokens are kept, so the file can't be used to hijack sessions
+type SessionStore struct {
+	mu          sync.Mutex
+	sessions    map[string]*Session
+	ttl         time.Duration
+	idleTimeout time.Duration
+	path        string
+	savedAt     time.Time
+}
+
+// NewSessionStore creates a session store
+// A zero idleTimeout disables the idle check; an empty path keeps sessions in memory only
+func NewSessionStore(ttl, idleTimeout time.Duration, path string) (*SessionStore, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("session lifetime must be positive")
+	}
+
+	store := &SessionStore{
+		sessions:    make(map[string]*Session),
+		ttl:         ttl,
+		idleTimeout: idleTimeout,
+		path:        path,
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// TTL returns the lifetime of new sessions
+func (s *SessionStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Create starts a session for a user and returns its token
+// The role is fixed for the lifetime of the session, so role changes must revoke the user's sessions
+func (s *SessionStore) Create(username string, role models.Role, remoteAddr, userAgent string) (string, *Session, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("failed to generate session token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	session := &Session{
+		Username:   username,
+		Role:       role,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.ttl),
+		LastSeenAt: now,
+		RemoteAddr: remoteAddr,
+		UserAgent:  userAgent,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	s.sessions[hashToken(token)] = session
+	if err := s.saveLocked(); err != nil {
+		delete(s.sessions, hashToken(token))
+		return "", nil, err
+	}
+
+	copied := *session
+	return token, &copied, nil
+}
+
+// Validate returns the session of a token and marks it as used
+func (s *SessionStore) Validate(token string) (*Session, error) {
+	if token == "" {
+		return nil, ErrInvalidSession
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hashToken(token)
+	session, ok := s.sessions[key]
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+
+	now := time.Now()
+	if s.expired(session, now) {
+		delete(s.sessions, key)
+		if err := s.saveLocked(); err != nil {
+			log.Printf("Failed to save sessions: %v", err)
+		}
+		return nil, ErrInvalidSession
+	}
+
+	session.LastSeenAt = now
+	if s.path != "" && now.Sub(s.savedAt) > sessionTouchInterval {
+		if err := s.saveLocked(); err != nil {
+			log.Printf("Failed to save sessions: %v", err)
+		}
+	}
+
+	copied := *session
+	return &copied, nil
+}
+
+// Revoke ends the session of a token
+func (s *SessionStore) Revoke(token string) error {
+	if token == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hashToken(token)
+	if _, ok := s.sessions[key]; !ok {
+		return nil
+	}
+	delete(s.sessions, key)
+	return s.saveLocked()
+}
+
+// RevokeUser ends every session of a user and returns how many were ended
+func (s *SessionStore) RevokeUser(username string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revoked := 0
+	for key, session := range s.sessions {
+		if session.Username == username {
+			delete(s.sessions, key)
+			revoked++
+		}
+	}
+	if revoked == 0 {
+		return 0, nil
+	}
+	return revoked, s.saveLocked()
+}
+
+// expired reports whether a session is past its lifetime or has been idle for too long
+func (s *SessionStore) expired(session *Session, now time.Time) bool {
+	if now.After(session.ExpiresAt) {
+		return true
+	}
+	return s.idleTimeout > 0 && now.Sub(session.LastSeenAt) > s.idleTimeout
+}
+
+// pruneLocked drops expired sessions
+func (s *SessionStore) pruneLocked(now time.Time) {
+	for key, session := range s.sessions {
+		if s.expired(session, now) {
+			delete(s.sessions, key)
+		}
+	}
+}
+
+// load reads persisted sessions, dropping the ones that expired while the server was down
+func (s *SessionStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read session store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.sessions); err != nil {
+		return fmt.Errorf("failed to parse session store %s: %w", s.path, err)
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[string]*Session)
+	}
+	s.pruneLocked(time.Now())
+
+	log.Printf("Loaded %d sessions from %s", len(s.sessions), s.path)
+	return nil
+}
+
+// saveLocked writes the sessions to the session file, if one is configured
+func (s *SessionStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.sessions)
+	if err != nil {
+		return fmt.Errorf("failed to encode sessions: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to save sessions: %w", err)
+	}
+	s.savedAt = time.Now()
+	return nil
+}
+
+// hashToken returns the key a session or API token is stored under
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic replaces a file readable only by its owner, so readers never see a partial write
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
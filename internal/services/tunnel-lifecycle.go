@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"cfProxyHub/internal/models"
+)
+
+// TunnelLifecycle runs tunnel operations that span Cloudflare and the cloudflared containers running the tunnel
+type TunnelLifecycle struct {
+	cf *CloudflareService
+	// docker is nil when Docker isn't available, container steps are then skipped with a warning
+	docker *DockerService
+}
+
+// NewTunnelLifecycle creates a TunnelLifecycle, dockerService may be nil
+func NewTunnelLifecycle(cfService *CloudflareService, dockerService *DockerService) *TunnelLifecycle {
+	return &TunnelLifecycle{
+		cf:     cfService,
+		docker: dockerService,
+	}
+}
+
+// ForceDelete deletes a tunnel even if cloudflared connectors are still connected
+// It stops and removes the cfProxyHub-managed cloudflared containers running the tunnel, cleans up
+// its connections, deletes the CNAME records of its hostnames that point to it and then deletes the tunnel.
+// The result reports every step, also when the tunnel delete itself fails
+func (l *TunnelLifecycle) ForceDelete(ctx context.Context, accountID, tunnelID string) (*models.TunnelDeleteResult, error) {
+	result := &models.TunnelDeleteResult{
+		TunnelID:   tunnelID,
+		Containers: []models.TunnelContainerResult{},
+		DNSRecords: []models.TunnelDNSRecordResult{},
+	}
+
+	// Read the hostnames first, the configuration is gone with the tunnel
+	hostnames, err := l.cf.GetCloudflareTunnelIngressHostnames(ctx, accountID, tunnelID)
+	if err != nil {
+		result.Warnings = append(result.Warnings, "Could not read the tunnel's hostnames, no DNS records were removed: "+err.Error())
+	}
+
+	// Running connectors would reconnect right after their connections are cleaned up
+	result.Containers, err = l.removeTunnelContainers(ctx, tunnelID)
+	if err != nil {
+		result.Warnings = append(result.Warnings, "Cloudflared containers running the tunnel were not stopped: "+err.Error())
+	}
+
+	if err := l.cf.CleanupCloudflareTunnelConnections(ctx, accountID, tunnelID, ""); err != nil {
+		result.Warnings = append(result.Warnings, "Could not clean up the tunnel's connections: "+err.Error())
+	} else {
+		result.ConnectionsCleaned = true
+	}
+
+	if len(hostnames) > 0 {
+		result.DNSRecords = l.cf.DeleteTunnelCNAMERecords(ctx, accountID, tunnelID, hostnames)
+	}
+
+	if err := l.cf.DeleteCloudflareTunnel(ctx, accountID, tunnelID); err != nil {
+		return result, err
+	}
+	result.Deleted = true
+
+	log.Printf("Force deleted tunnel %s in account %s: %d container(s), %d DNS record(s)", tunnelID, accountID, len(result.Containers), len(result.DNSRecords))
+	return result, nil
+}
+
+// RotateSecret replaces the secret of a tunnel, revoking every token issued so far
+// The cfProxyHub-managed cloudflared containers running the tunnel are recreated with the new token, then the
+// connectors connected before the rotation are cleaned up so nothing keeps running on the old token
+func (l *TunnelLifecycle) RotateSecret(ctx context.Context, accountID, tunnelID string) (*models.TunnelRotateResult, error) {
+	result := &models.TunnelRotateResult{
+		TunnelID:   tunnelID,
+		Containers: []models.TunnelContainerResult{},
+	}
+
+	// Connectors are identified before the rotation, so the ones started with the new token are left alone
+	connections, connectionsErr := l.cf.GetCloudflareTunnelConnections(ctx, accountID, tunnelID)
+	if connectionsErr != nil {
+		result.Warnings = append(result.Warnings, "Could not read the tunnel's connections, connectors using the old token were not cleaned up: "+connectionsErr.Error())
+	}
+
+	token, err := l.cf.RotateCloudflareTunnelSecret(ctx, accountID, tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	result.Token = token
+
+	result.Containers, err = l.recreateTunnelContainers(ctx, tunnelID, token)
+	if err != nil {
+		result.Warnings = append(result.Warnings, "Cloudflared containers running the tunnel were not recreated: "+err.Error())
+	}
+
+	connectors := make(map[string]bool)
+	for _, conn := range connections {
+		connectors[conn.ConnectorID] = true
+	}
+	result.ConnectionsCleaned = connectionsErr == nil
+	for connectorID := range connectors {
+		if err := l.cf.CleanupCloudflareTunnelConnections(ctx, accountID, tunnelID, connectorID); err != nil {
+			result.ConnectionsCleaned = false
+			result.Warnings = append(result.Warnings, "Could not clean up connector "+connectorID+": "+err.Error())
+		}
+	}
+
+	log.Printf("Rotated the secret of tunnel %s in account %s: %d container(s) recreated", tunnelID, accountID, len(result.Containers))
+	return result, nil
+}
+
+// recreateTunnelContainers recreates the managed cloudflared containers running a tunnel with a new token
+func (l *TunnelLifecycle) recreateTunnelContainers(ctx context.Context, tunnelID, token string) ([]models.TunnelContainerResult, error) {
+	results := []models.TunnelContainerResult{}
+	if l.docker == nil {
+		return results, errors.New("Docker is not available")
+	}
+
+	containers, err := l.docker.FindManagedTunnelContainers(ctx, tunnelID)
+	if err != nil {
+		return results, err
+	}
+
+	for _, c := range containers {
+		result := models.TunnelContainerResult{ID: c.ID}
+		if len(c.Names) > 0 {
+			result.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		newID, err := l.docker.RecreateCloudflareTunnelContainer(ctx, c.ID, token)
+		result.NewID = newID
+		if err != nil {
+			result.Status = models.TunnelCleanupFailed
+			result.Error = err.Error()
+		} else {
+			result.Status = models.TunnelCleanupRecreated
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// removeTunnelContainers stops and removes the managed cloudflared containers running a tunnel
+func (l *TunnelLifecycle) removeTunnelContainers(ctx context.Context, tunnelID string) ([]models.TunnelContainerResult, error) {
+	results := []models.TunnelContainerResult{}
+	if l.docker == nil {
+		return results, errors.New("Docker is not available")
+	}
+
+	containers, err := l.docker.FindManagedTunnelContainers(ctx, tunnelID)
+	if err != nil {
+		return results, err
+	}
+
+	for _, c := range containers {
+		result := models.TunnelContainerResult{ID: c.ID}
+		if len(c.Names) > 0 {
+			result.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		if c.State == "running" {
+			if err := l.docker.StopContainer(ctx, c.ID); err != nil {
+				log.Printf("Warning: Could not stop cloudflared container %s, removing it anyway: %v", c.ID, err)
+			}
+		}
+		if err := l.docker.RemoveContainer(ctx, c.ID); err != nil {
+			result.Status = models.TunnelCleanupFailed
+			result.Error = err.Error()
+		} else {
+			result.Status = models.TunnelCleanupRemoved
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"cfProxyHub/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidCredentials is returned when a username or password doesn't match
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrUserNotFound is returned for unknown usernames
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when creating a user whose username is taken
+	ErrUserExists = errors.New("user already exists")
+	// ErrLastAdmin is returned when a change would leave no admin
+	ErrLastAdmin = errors.New("at least one admin is required")
+	// ErrUserProviderMismatch is returned when a single sign-on login matches a user of another provider
+	ErrUserProviderMismatch = errors.New("user exists with a different login provider")
+	// ErrPasswordNotLocal is returned when setting a password for a single sign-on user
+	ErrPasswordNotLocal = errors.New("passwords can only be set for local users")
+	// ErrTOTPNotLocal is returned when a single sign-on user tries to set up two-factor authentication
+	ErrTOTPNotLocal = errors.New("two-factor authentication is only available for local users")
+	// ErrTOTPEnabled is returned when enrolling a user who already has two-factor authentication
+	ErrTOTPEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTOTPNotEnrolling is returned when confirming an enrollment that wasn't started
+	ErrTOTPNotEnrolling = errors.New("two-factor enrollment has not been started")
+	// ErrTOTPNotEnabled is returned for users without two-factor authentication
+	ErrTOTPNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrTOTPRequired is returned when disabling two-factor authentication the policy requires
+	ErrTOTPRequired = errors.New("two-factor authentication is required for your role")
+	// ErrInvalidTOTPCode is returned for wrong, expired or reused codes
+	ErrInvalidTOTPCode = errors.New("invalid two-factor code")
+)
+
+// totpIssuer names cfProxyHub in authenticator apps
+const totpIssuer = "cfProxyHub"
+
+// userRecord is a user as stored, including the password hash and two-factor secrets
+type userRecord struct {
+	models.User
+	PasswordHash string `json:"password_hash"`
+
+	TOTPSecret         string   `json:"totp_secret,omitempty"`
+	TOTPPendingSecret  string   `json:"totp_pending_secret,omitempty"`
+	TOTPLastCounter    int64    `json:"totp_last_counter,omitempty"`
+	RecoveryCodeHashes []string `json:"recovery_code_hashes,omitempty"`
+}
+
+// userFile is the layout of the user file
+// Older files hold just the array of users
+type userFile struct {
+	RequireTOTP bool          `json:"require_totp"`
+	Users       []*userRecord `json:"users"`
+}
+
+// UserStore holds the users allowed to log in, with bcrypt-hashed passwords
+// Users live in memory and are optionally persisted to a JSON file
+type UserStore struct {
+	mu        sync.RWMutex
+	users     map[string]*userRecord
+	path      string
+	dummyHash []byte
+
+	// requireTOTP makes two-factor authentication mandatory for local admins and operators
+	requireTOTP bool
+}
+
+// NewUserStore creates a user store
+// When no users exist yet, an admin is created from the bootstrap credentials
+func NewUserStore(path, bootstrapUsername, bootstrapPassword string) (*UserStore, error) {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("cfproxyhub-dummy-password"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize user store: %w", err)
+	}
+
+	store := &UserStore{
+		users:     make(map[string]*userRecord),
+		path:      path,
+		dummyHash: dummyHash,
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	if len(store.users) == 0 {
+		if bootstrapUsername == "" || bootstrapPassword == "" {
+			return nil, fmt.Errorf("no users exist and no bootstrap admin credentials are configured")
+		}
+		if err := models.ValidatePassword(bootstrapPassword); err != nil {
+			log.Printf("Warning: bootstrap admin password is weak: %v", err)
+		}
+		// The bootstrap admin skips the password policy so existing ADMIN_PASSWORD values keep working
+		if _, err := store.add(models.UserCreateRequest{
+			Username: bootstrapUsername,
+			Password: bootstrapPassword,
+			Role:     models.RoleAdmin,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create bootstrap admin: %w", err)
+		}
+		log.Printf("Created bootstrap admin user %s", bootstrapUsername)
+	}
+
+	return store, nil
+}
+
+// Authenticate checks a username and password and returns the user
+func (s *UserStore) Authenticate(username, password string) (*models.User, error) {
+	s.mu.RLock()
+	record, ok := s.users[username]
+	s.mu.RUnlock()
+
+	if !ok || record.PasswordHash == "" {
+		// Compare against a dummy hash so unknown usernames take as long as wrong passwords
+		// Single sign-on users have no password and can't log in locally
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(record.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	user := record.User
+	return &user, nil
+}
+
+// List returns all users sorted by username
+func (s *UserStore) List() []models.User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, record := range s.users {
+		users = append(users, record.User)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users
+}
+
+// Get returns a user by username
+func (s *UserStore) Get(username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	user := record.User
+	return &user, nil
+}
+
+// Create adds a user
+func (s *UserStore) Create(req models.UserCreateRequest) (*models.User, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return s.add(req)
+}
+
+// add hashes the password and stores a new user
+func (s *UserStore) add(req models.UserCreateRequest) (*models.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[req.Username]; ok {
+		return nil, ErrUserExists
+	}
+
+	now := time.Now()
+	record := &userRecord{
+		User: models.User{
+			Username:  req.Username,
+			Role:      req.Role,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		PasswordHash: string(hash),
+	}
+	s.users[req.Username] = record
+	if err := s.saveLocked(); err != nil {
+		delete(s.users, req.Username)
+		return nil, err
+	}
+
+	user := record.User
+	return &user, nil
+}
+
+// Provision creates or updates a user logging in through an external identity provider
+// The role follows the provider on every login, except that the last admin is never demoted
+// Local users are never taken over by a provider login with the same username
+func (s *UserStore) Provision(username string, role models.Role, provider string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[username]
+	if !ok {
+		now := time.Now()
+		record = &userRecord{
+			User: models.User{
+				Username:  username,
+				Role:      role,
+				Provider:  provider,
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+		}
+		s.users[username] = record
+		if err := s.saveLocked(); err != nil {
+			delete(s.users, username)
+			return nil, err
+		}
+		user := record.User
+		return &user, nil
+	}
+
+	if record.Provider != provider {
+		return nil, ErrUserProviderMismatch
+	}
+	if record.Role != role {
+		if record.Role == models.RoleAdmin && s.adminCountLocked() == 1 {
+			log.Printf("Keeping %s as admin although %s maps them to %s: they are the last admin", username, provider, role)
+		} else {
+			previous := *record
+			record.Role = role
+			record.UpdatedAt = time.Now()
+			if err := s.saveLocked(); err != nil {
+				*record = previous
+				return nil, err
+			}
+		}
+	}
+
+	user := record.User
+	return &user, nil
+}
+
+// Update changes the password and/or role of a user, only local users have a password
+func (s *UserStore) Update(username string, req models.UserUpdateRequest) (*models.User, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	var hash []byte
+	if req.Password != "" {
+		var err error
+		hash, err = bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	// A password would let a single sign-on user bypass their identity provider
+	if hash != nil && record.Provider != "" {
+		return nil, ErrPasswordNotLocal
+	}
+	if req.Role != "" && req.Role != models.RoleAdmin && record.Role == models.RoleAdmin && s.adminCountLocked() == 1 {
+		return nil, ErrLastAdmin
+	}
+
+	previous := *record
+	if hash != nil {
+		record.PasswordHash = string(hash)
+	}
+	if req.Role != "" {
+		record.Role = req.Role
+	}
+	record.UpdatedAt = time.Now()
+
+	if err := s.saveLocked(); err != nil {
+		*record = previous
+		return nil, err
+	}
+
+	user := record.User
+	return &user, nil
+}
+
+// Delete removes a user
+func (s *UserStore) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if record.Role == models.RoleAdmin && s.adminCountLocked() == 1 {
+		return ErrLastAdmin
+	}
+
+	delete(s.users, username)
+	if err := s.saveLocked(); err != nil {
+		s.users[username] = record
+		return err
+	}
+	return nil
+}
+
+// adminCountLocked counts the users with the admin role
+func (s *UserStore) adminCountLocked() int {
+	count := 0
+	for _, record := range s.users {
+		if record.Role == models.RoleAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+// load reads persisted users
+func (s *UserStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read user store: %w", err)
+	}
+
+	var file userFile
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &file.Users)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse user store %s: %w", s.path, err)
+	}
+	for _, record := range file.Users {
+		s.users[record.Username] = record
+	}
+	s.requireTOTP = file.RequireTOTP
+
+	log.Printf("Loaded %d users from %s", len(s.users), s.path)
+	return nil
+}
+
+// saveLocked writes the users to the user file, if one is configured
+func (s *UserStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	records := make([]*userRecord, 0, len(s.users))
+	for _, record := range s.users {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Username < records[j].Username
+	})
+
+	data, err := json.MarshalIndent(userFile{RequireTOTP: s.requireTOTP, Users: records}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode users: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to save users: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"cfProxyHub/internal/models"
+)
+
+// newTestUserStore creates a store in a temporary directory with the bootstrap admin
+func newTestUserStore(t *testing.T) *UserStore {
+	t.Helper()
+	store, err := NewUserStore(filepath.Join(t.TempDir(), "users.json"), "admin", "bootstrap-password")
+	if err != nil {
+		t.Fatalf("NewUserStore: %v", err)
+	}
+	return store
+}
+
+func TestUserStoreUpdateRejectsPasswordOfSingleSignOnUsers(t *testing.T) {
+	store := newTestUserStore(t)
+
+	for _, provider := range []string{"oidc", CFAccessProvider} {
+		username := provider + "@example.com"
+		if _, err := store.Provision(username, models.RoleViewer, provider); err != nil {
+			t.Fatalf("Provision: %v", err)
+		}
+
+		if _, err := store.Update(username, models.UserUpdateRequest{Password: "a-new-password"}); !errors.Is(err, ErrPasswordNotLocal) {
+			t.Errorf("%s: got %v, want ErrPasswordNotLocal", provider, err)
+		}
+		if _, err := store.Authenticate(username, "a-new-password"); err == nil {
+			t.Errorf("%s: password login succeeded", provider)
+		}
+
+		// Roles of single sign-on users can still be changed
+		user, err := store.Update(username, models.UserUpdateRequest{Role: models.RoleOperator})
+		if err != nil || user.Role != models.RoleOperator {
+			t.Errorf("%s: role update got %+v, %v", provider, user, err)
+		}
+	}
+}
+
+func TestUserStoreUpdatePasswordOfLocalUser(t *testing.T) {
+	store := newTestUserStore(t)
+
+	if _, err := store.Update("admin", models.UserUpdateRequest{Password: "a-new-password"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := store.Authenticate("admin", "a-new-password"); err != nil {
+		t.Errorf("Authenticate with the new password: %v", err)
+	}
+}
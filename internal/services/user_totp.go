@@ -0,0 +1,220 @@
+package services
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"cfProxyHub/internal/models"
+)
+
+// TOTPRequiredByPolicy reports whether admins have made two-factor authentication mandatory for admins and operators
+func (s *UserStore) TOTPRequiredByPolicy() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.requireTOTP
+}
+
+// SetTOTPRequiredByPolicy changes whether two-factor authentication is mandatory for admins and operators
+func (s *UserStore) SetTOTPRequiredByPolicy(required bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.requireTOTP
+	s.requireTOTP = required
+	if err := s.saveLocked(); err != nil {
+		s.requireTOTP = previous
+		return err
+	}
+	return nil
+}
+
+// TOTPRequired reports whether the policy requires the user to use two-factor authentication
+// Single sign-on users are left to their identity provider
+func (s *UserStore) TOTPRequired(user *models.User) bool {
+	return user.Provider == "" && user.Role.Includes(models.RoleOperator) && s.TOTPRequiredByPolicy()
+}
+
+// BeginTOTPEnrollment creates a new secret for the user to add to their authenticator app
+// It only takes effect once ConfirmTOTPEnrollment sees a valid code
+// Returns the secret and its otpauth:// provisioning URI
+func (s *UserStore) BeginTOTPEnrollment(username string) (string, string, error) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[username]
+	if !ok {
+		return "", "", ErrUserNotFound
+	}
+	if record.Provider != "" {
+		return "", "", ErrTOTPNotLocal
+	}
+	if record.TOTPEnabled {
+		return "", "", ErrTOTPEnabled
+	}
+
+	previous := record.TOTPPendingSecret
+	record.TOTPPendingSecret = secret
+	if err := s.saveLocked(); err != nil {
+		record.TOTPPendingSecret = previous
+		return "", "", err
+	}
+	return secret, totpProvisioningURI(totpIssuer, username, secret), nil
+}
+
+// ConfirmTOTPEnrollment enables two-factor authentication once the user proves their app produces valid codes
+// Returns the user's recovery codes, which are only shown now
+func (s *UserStore) ConfirmTOTPEnrollment(username, code string) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if record.TOTPEnabled {
+		return nil, ErrTOTPEnabled
+	}
+	if record.TOTPPendingSecret == "" {
+		return nil, ErrTOTPNotEnrolling
+	}
+	counter, ok := validateTOTP(record.TOTPPendingSecret, code, 0, time.Now())
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	previous := *record
+	record.TOTPSecret = record.TOTPPendingSecret
+	record.TOTPPendingSecret = ""
+	record.TOTPLastCounter = counter
+	record.RecoveryCodeHashes = hashes
+	record.TOTPEnabled = true
+	record.UpdatedAt = time.Now()
+	if err := s.saveLocked(); err != nil {
+		*record = previous
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor checks a TOTP code or, failing that, consumes a recovery code
+func (s *UserStore) VerifySecondFactor(username, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if !record.TOTPEnabled {
+		return ErrTOTPNotEnabled
+	}
+
+	previous := *record
+	if counter, ok := validateTOTP(record.TOTPSecret, code, record.TOTPLastCounter, time.Now()); ok {
+		record.TOTPLastCounter = counter
+	} else if index := matchRecoveryCode(record.RecoveryCodeHashes, code); index >= 0 {
+		record.RecoveryCodeHashes = append(append([]string(nil), record.RecoveryCodeHashes[:index]...), record.RecoveryCodeHashes[index+1:]...)
+	} else {
+		return ErrInvalidTOTPCode
+	}
+
+	if err := s.saveLocked(); err != nil {
+		*record = previous
+		return err
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (s *UserStore) RegenerateRecoveryCodes(username string) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if !record.TOTPEnabled {
+		return nil, ErrTOTPNotEnabled
+	}
+
+	previous := record.RecoveryCodeHashes
+	record.RecoveryCodeHashes = hashes
+	if err := s.saveLocked(); err != nil {
+		record.RecoveryCodeHashes = previous
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes the user has
+func (s *UserStore) RecoveryCodesLeft(username string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if record, ok := s.users[username]; ok {
+		return len(record.RecoveryCodeHashes)
+	}
+	return 0
+}
+
+// DisableTOTP removes the user's two-factor authentication
+// Users can't disable it themselves while the policy requires it, admins resetting a lost device can
+func (s *UserStore) DisableTOTP(username string, enforcePolicy bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if !record.TOTPEnabled && record.TOTPPendingSecret == "" {
+		return ErrTOTPNotEnabled
+	}
+	if enforcePolicy && s.requireTOTP && record.Role.Includes(models.RoleOperator) {
+		return ErrTOTPRequired
+	}
+
+	previous := *record
+	record.TOTPSecret = ""
+	record.TOTPPendingSecret = ""
+	record.TOTPLastCounter = 0
+	record.RecoveryCodeHashes = nil
+	record.TOTPEnabled = false
+	record.UpdatedAt = time.Now()
+	if err := s.saveLocked(); err != nil {
+		*record = previous
+		return err
+	}
+	return nil
+}
+
+// matchRecoveryCode returns the index of the stored hash matching the code, or -1
+func matchRecoveryCode(hashes []string, code string) int {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return -1
+	}
+	hash := hashToken(code)
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			return i
+		}
+	}
+	return -1
+}
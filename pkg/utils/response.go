@@ -18,3 +18,11 @@ func ErrorResponse(c *gin.Context, message string, code int) {
 		"message": message,
 	})
 }
+
+func ErrorResponseWithData(c *gin.Context, message string, code int, data interface{}) {
+	c.JSON(code, gin.H{
+		"status":  "error",
+		"message": message,
+		"data":    data,
+	})
+}
@@ -29,12 +29,12 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Create the hostname parameter
-	hostnameParam := models.NewPublicHostnameIngressParam(hostname, "https://localhost:8080", "")
+	// Create the hostname rule
+	hostnameRule := models.NewPublicHostnameRule(models.NewPublicHostnameIngressParam(hostname, "https://localhost:8080", ""))
 
 	// Call the function we want to test
 	fmt.Printf("Adding hostname %s to tunnel %s in account %s...\n", hostname, tunnelID, accountID)
-	result, err := cfService.CreateCloudflareTunnelPublicHostnameWithDNS(ctx, accountID, tunnelID, hostname, hostnameParam)
+	result, err := cfService.CreateCloudflareTunnelPublicHostnameWithDNS(ctx, accountID, tunnelID, hostname, hostnameRule)
 	if err != nil {
 		log.Fatalf("Error creating public hostname with DNS: %v", err)
 	}
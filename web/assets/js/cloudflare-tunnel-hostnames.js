@@ -1,3 +1,8 @@
+// Configuration version the hostnames were loaded at, sent as If-Match on edits
+let configVersion = null;
+// Path of the rule being edited or deleted as stored in the tunnel, empty for rules without one
+let currentRulePath = '';
+
 $(document).ready(function() {
   let selectedAccountId = null;
   let selectedAccount = null;
@@ -42,6 +47,7 @@ $(document).ready(function() {
     const serviceType = $(this).data('service-type');
     const serviceUrl = $(this).data('service-url');
     const path = $(this).data('path');
+    currentRulePath = $(this).attr('data-rule-path') || '';
     
     console.log('Edit button clicked - hostname:', hostname);
     console.log('Edit button clicked - serviceType:', serviceType);
@@ -72,7 +78,8 @@ $(document).ready(function() {
   $(document).on('click', '.delete-hostname-btn', function() {
     const hostname = $(this).data('hostname');
     currentHostname = hostname;
-    $('#deleteHostnameText').text(hostname);
+    currentRulePath = $(this).attr('data-rule-path') || '';
+    $('#deleteHostnameText').text(hostname + currentRulePath);
     $('#deleteHostnameModal').modal('show');
   });
   
@@ -85,7 +92,7 @@ $(document).ready(function() {
   // Confirm delete hostname
   $('#confirmDeleteHostname').on('click', function() {
     if ($(this).prop('disabled')) return;
-    deleteHostname(currentHostname);
+    deleteHostname(currentHostname, currentRulePath);
   });
   
   // Form validation
@@ -373,6 +380,7 @@ function loadHostnames() {
   .then(data => {
     hideLoadingState();
     
+    configVersion = data.data && data.data.version !== undefined ? data.data.version : null;
     if (data.status === 'success' && data.data && data.data.hostnames) {
       if (data.data.hostnames.length > 0) {
         renderHostnames(data.data.hostnames);
@@ -403,7 +411,7 @@ function loadDomains() {
   
   console.log('Loading domains for account:', selectedAccountId);
   
-  return fetch(`/api/cloudflare/accounts/${selectedAccountId}/zones/dropdown?active_only=true&limit=50`, {
+  return fetch(`/api/cloudflare/accounts/${selectedAccountId}/zones/dropdown?active_only=true`, {
     method: 'GET',
     credentials: 'same-origin'
   })
@@ -554,6 +562,7 @@ function renderHostnames(hostnames) {
     const editServiceType = serviceType || 'http';
     const editServiceUrl = cleanUrl || '';
     const editPath = hostname.path || '/';
+    const rulePath = (hostname.path || '').replace(/"/g, '&quot;');
     
     console.log('Rendering hostname row:', {
       hostname: editHostname,
@@ -593,10 +602,11 @@ function renderHostnames(hostnames) {
                   data-hostname="${editHostname.replace(/"/g, '&quot;')}" 
                   data-service-type="${editServiceType}" 
                   data-service-url="${editServiceUrl.replace(/"/g, '&quot;')}" 
-                  data-path="${editPath.replace(/"/g, '&quot;')}">
+                  data-path="${editPath.replace(/"/g, '&quot;')}" 
+                  data-rule-path="${rulePath}">
             <i class="mdi mdi-pencil"></i> Edit
           </button>
-          <button class="btn btn-sm btn-danger delete-hostname-btn" data-hostname="${editHostname.replace(/"/g, '&quot;')}">
+          <button class="btn btn-sm btn-danger delete-hostname-btn" data-hostname="${editHostname.replace(/"/g, '&quot;')}" data-rule-path="${rulePath}">
             <i class="mdi mdi-delete"></i> Delete
           </button>
         </td>
@@ -884,7 +894,7 @@ function saveHostname() {
   console.log('New hostname:', fullHostname);
   
   const url = isEditMode ? 
-    `/api/cloudflare/accounts/${selectedAccountId}/tunnels/${selectedTunnelId}/hostnames/${encodeURIComponent(currentHostname)}` :
+    `/api/cloudflare/accounts/${selectedAccountId}/tunnels/${selectedTunnelId}/hostnames/${encodeURIComponent(currentHostname)}?path=${encodeURIComponent(currentRulePath)}` :
     `/api/cloudflare/accounts/${selectedAccountId}/tunnels/${selectedTunnelId}/hostnames`;
   
   console.log('Request URL:', url);
@@ -894,9 +904,7 @@ function saveHostname() {
   
   fetch(url, {
     method: method,
-    headers: {
-      'Content-Type': 'application/json',
-    },
+    headers: configHeaders(),
     credentials: 'same-origin',
     body: JSON.stringify(requestData)
   })
@@ -904,6 +912,10 @@ function saveHostname() {
     console.log('Response status:', response.status);
     console.log('Response headers:', response.headers);
     
+    if (response.status === 409) {
+      loadHostnames();
+      throw new Error('This tunnel was changed by someone else. The hostnames have been reloaded, please try again.');
+    }
     if (!response.ok) {
       // Try to get error message from response
       return response.json().then(errorData => {
@@ -948,8 +960,19 @@ function saveHostname() {
   });
 }
 
+// Request headers for tunnel configuration edits, guarded by the version the hostnames were loaded at
+function configHeaders() {
+  const headers = {
+    'Content-Type': 'application/json',
+  };
+  if (configVersion !== null) {
+    headers['If-Match'] = `"${configVersion}"`;
+  }
+  return headers;
+}
+
 // Delete hostname
-function deleteHostname(hostname) {
+function deleteHostname(hostname, rulePath) {
   if (!hostname) return;
   
   const button = $('#confirmDeleteHostname');
@@ -957,14 +980,16 @@ function deleteHostname(hostname) {
   const originalContent = button.html();
   button.html('<i class="mdi mdi-loading mdi-spin mr-2"></i>Deleting...');
   
-  fetch(`/api/cloudflare/accounts/${selectedAccountId}/tunnels/${selectedTunnelId}/hostnames/${encodeURIComponent(hostname)}`, {
+  fetch(`/api/cloudflare/accounts/${selectedAccountId}/tunnels/${selectedTunnelId}/hostnames/${encodeURIComponent(hostname)}?path=${encodeURIComponent(rulePath || '')}`, {
     method: 'DELETE',
-    headers: {
-      'Content-Type': 'application/json',
-    },
+    headers: configHeaders(),
     credentials: 'same-origin'
   })
   .then(response => {
+    if (response.status === 409) {
+      loadHostnames();
+      throw new Error('This tunnel was changed by someone else. The hostnames have been reloaded, please try again.');
+    }
     if (!response.ok) {
       throw new Error(`HTTP error! status: ${response.status}`);
     }
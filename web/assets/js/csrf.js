@@ -0,0 +1,24 @@
+// Adds the CSRF token to state-changing requests to the cfProxyHub API
+// The server sets the token in the csrf_token cookie and expects it back in the X-CSRF-Token header
+
+(function () {
+  function csrfToken() {
+    const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+    return match ? decodeURIComponent(match[1]) : '';
+  }
+
+  const originalFetch = window.fetch;
+  window.fetch = function (input, init) {
+    init = init || {};
+    const request = input instanceof Request ? input : null;
+    const method = (init.method || (request ? request.method : 'GET')).toUpperCase();
+    const url = new URL(request ? request.url : input, window.location.href);
+
+    if (!['GET', 'HEAD', 'OPTIONS'].includes(method) && url.origin === window.location.origin) {
+      const headers = new Headers(init.headers || (request ? request.headers : undefined));
+      headers.set('X-CSRF-Token', csrfToken());
+      init.headers = headers;
+    }
+    return originalFetch.call(this, input, init);
+  };
+})();